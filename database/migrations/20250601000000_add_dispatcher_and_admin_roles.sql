@@ -0,0 +1,19 @@
+-- +goose NO TRANSACTION
+
+-- +goose Up
+ALTER TYPE user_role ADD VALUE IF NOT EXISTS 'dispatcher';
+ALTER TYPE user_role ADD VALUE IF NOT EXISTS 'admin';
+
+-- +goose Down
+-- +goose StatementBegin
+-- Postgres can't drop enum values, so the type is recreated. Dispatchers and admins are demoted.
+UPDATE users SET role = 'citizen' WHERE role IN ('dispatcher', 'admin');
+
+ALTER TYPE user_role RENAME TO user_role_old;
+CREATE TYPE user_role AS ENUM('citizen', 'responder');
+
+ALTER TABLE users
+ALTER COLUMN role TYPE user_role USING role::text::user_role;
+
+DROP TYPE user_role_old;
+-- +goose StatementEnd
@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE reporters
+ADD COLUMN anonymous_id text;
+
+ALTER TABLE reporters
+ADD CONSTRAINT reporters_anonymous_id_unique UNIQUE (anonymous_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE reporters
+DROP CONSTRAINT reporters_anonymous_id_unique;
+
+ALTER TABLE reporters
+DROP COLUMN anonymous_id;
+-- +goose StatementEnd
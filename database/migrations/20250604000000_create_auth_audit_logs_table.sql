@@ -0,0 +1,22 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS auth_audit_logs (
+    auth_audit_log_id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+
+    created_at timestamptz NOT NULL DEFAULT now(),
+    event text NOT NULL,
+    user_id uuid,
+    email text,
+    ip_address text,
+    details jsonb NOT NULL DEFAULT '{}',
+
+    FOREIGN KEY(user_id) REFERENCES users(user_id) ON DELETE SET NULL
+);
+
+CREATE INDEX auth_audit_logs_created_at_idx ON auth_audit_logs (created_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE auth_audit_logs;
+-- +goose StatementEnd
@@ -0,0 +1,32 @@
+-- +goose Up
+-- +goose StatementBegin
+-- The secret is encrypted by the API with `TOTP_SECRET_KEY`
+ALTER TABLE users
+ADD COLUMN totp_secret_encrypted bytea,
+ADD COLUMN totp_enabled_at timestamptz;
+
+CREATE TABLE IF NOT EXISTS totp_recovery_codes (
+    totp_recovery_code_id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+
+    created_at timestamptz NOT NULL DEFAULT now(),
+    code_hash text NOT NULL,
+    used_at timestamptz,
+    user_id uuid NOT NULL,
+
+    FOREIGN KEY(user_id) REFERENCES users(user_id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS totp_required_roles (
+    role user_role PRIMARY KEY
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE totp_required_roles;
+DROP TABLE totp_recovery_codes;
+
+ALTER TABLE users
+DROP COLUMN totp_enabled_at,
+DROP COLUMN totp_secret_encrypted;
+-- +goose StatementEnd
@@ -0,0 +1,24 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS api_keys (
+    api_key_id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+
+    created_at timestamptz NOT NULL DEFAULT now(),
+    name text NOT NULL,
+    key_hash text NOT NULL UNIQUE,
+    prefix text NOT NULL,
+    scopes text[] NOT NULL DEFAULT '{}',
+    rate_limit integer NOT NULL, -- Requests per minute
+    last_used_at timestamptz,
+    expires_at timestamptz,
+    revoked_at timestamptz,
+    created_by uuid,
+
+    FOREIGN KEY(created_by) REFERENCES users(user_id) ON DELETE SET NULL
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE api_keys;
+-- +goose StatementEnd
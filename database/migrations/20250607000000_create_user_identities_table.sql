@@ -0,0 +1,31 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Accounts created through an identity provider don't always have these
+ALTER TABLE users
+ALTER COLUMN birth_date DROP NOT NULL;
+
+CREATE TABLE IF NOT EXISTS user_identities (
+    user_identity_id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+
+    created_at timestamptz NOT NULL DEFAULT now(),
+    issuer text NOT NULL,
+    subject text NOT NULL,
+    last_signed_in_at timestamptz NOT NULL DEFAULT now(),
+    -- Only the identity that created the account keeps its role in sync with
+    -- the provider
+    manages_role boolean NOT NULL DEFAULT false,
+
+    user_id uuid NOT NULL,
+
+    UNIQUE(issuer, subject),
+    FOREIGN KEY(user_id) REFERENCES users(user_id) ON DELETE CASCADE
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE user_identities;
+
+ALTER TABLE users
+ALTER COLUMN birth_date SET NOT NULL;
+-- +goose StatementEnd
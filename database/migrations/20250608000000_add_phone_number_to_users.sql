@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE users
+ALTER COLUMN email DROP NOT NULL,
+ADD COLUMN phone_number text UNIQUE, -- E.164
+ADD COLUMN phone_verified_at timestamptz,
+ADD CONSTRAINT users_email_or_phone_number_check CHECK (email IS NOT NULL OR phone_number IS NOT NULL);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM users WHERE email IS NULL;
+
+ALTER TABLE users
+DROP CONSTRAINT users_email_or_phone_number_check,
+DROP COLUMN phone_verified_at,
+DROP COLUMN phone_number,
+ALTER COLUMN email SET NOT NULL;
+-- +goose StatementEnd
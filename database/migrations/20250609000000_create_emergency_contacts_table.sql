@@ -0,0 +1,26 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS emergency_contacts (
+    emergency_contact_id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+
+    created_at timestamptz NOT NULL DEFAULT now(),
+    updated_at timestamptz NOT NULL DEFAULT now(),
+    name text NOT NULL,
+    relationship text,
+    phone_number text, -- E.164
+    email text,
+    verified_at timestamptz, -- Contacts are only notified once they agreed to it
+
+    user_id uuid NOT NULL,
+
+    CHECK (phone_number IS NOT NULL OR email IS NOT NULL),
+    FOREIGN KEY(user_id) REFERENCES users(user_id) ON DELETE CASCADE
+);
+
+CREATE INDEX emergency_contacts_user_id_idx ON emergency_contacts (user_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE emergency_contacts;
+-- +goose StatementEnd
@@ -0,0 +1,33 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS medical_profiles (
+    user_id uuid PRIMARY KEY,
+
+    created_at timestamptz NOT NULL DEFAULT now(),
+    updated_at timestamptz NOT NULL DEFAULT now(),
+    data bytea NOT NULL, -- Encrypted JSON, see `user.medicalProfile`
+
+    FOREIGN KEY(user_id) REFERENCES users(user_id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS medical_profile_access_logs (
+    medical_profile_access_log_id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+
+    created_at timestamptz NOT NULL DEFAULT now(),
+    user_id uuid NOT NULL, -- Owner of the profile
+    accessed_by uuid,
+    reporter_id uuid,
+
+    FOREIGN KEY(user_id) REFERENCES users(user_id) ON DELETE CASCADE,
+    FOREIGN KEY(accessed_by) REFERENCES users(user_id) ON DELETE SET NULL,
+    FOREIGN KEY(reporter_id) REFERENCES reporters(reporter_id) ON DELETE SET NULL
+);
+
+CREATE INDEX medical_profile_access_logs_user_id_idx ON medical_profile_access_logs (user_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE medical_profile_access_logs;
+DROP TABLE medical_profiles;
+-- +goose StatementEnd
@@ -0,0 +1,31 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS households (
+    household_id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+
+    created_at timestamptz NOT NULL DEFAULT now(),
+    name text NOT NULL,
+    invite_code text NOT NULL UNIQUE,
+    created_by uuid,
+
+    FOREIGN KEY(created_by) REFERENCES users(user_id) ON DELETE SET NULL
+);
+
+CREATE TABLE IF NOT EXISTS household_members (
+    household_id uuid NOT NULL,
+    user_id uuid NOT NULL,
+    joined_at timestamptz NOT NULL DEFAULT now(),
+
+    PRIMARY KEY(household_id, user_id),
+    FOREIGN KEY(household_id) REFERENCES households(household_id) ON DELETE CASCADE,
+    FOREIGN KEY(user_id) REFERENCES users(user_id) ON DELETE CASCADE
+);
+
+CREATE INDEX household_members_user_id_idx ON household_members (user_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE household_members;
+DROP TABLE households;
+-- +goose StatementEnd
@@ -0,0 +1,50 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TYPE report_state AS ENUM(
+    'reported',
+    'assigned',
+    'acknowledged',
+    'en_route',
+    'on_scene',
+    'rescued',
+    'resolved',
+    'cancelled'
+);
+
+ALTER TABLE disaster_reports
+ADD COLUMN state report_state NOT NULL DEFAULT 'reported';
+
+UPDATE disaster_reports SET state = 'assigned' WHERE responder_id IS NOT NULL;
+
+-- Every change of state, for the after-action reviews' response times
+CREATE TABLE IF NOT EXISTS report_events (
+    report_event_id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+
+    created_at timestamptz NOT NULL DEFAULT now(),
+    from_state report_state, -- Null for the report's creation
+    to_state report_state NOT NULL,
+    note text,
+    disaster_report_id uuid NOT NULL,
+    actor_user_id uuid,
+    actor_api_key_id uuid,
+
+    FOREIGN KEY(disaster_report_id) REFERENCES disaster_reports(disaster_report_id) ON DELETE CASCADE,
+    FOREIGN KEY(actor_user_id) REFERENCES users(user_id) ON DELETE SET NULL,
+    FOREIGN KEY(actor_api_key_id) REFERENCES api_keys(api_key_id) ON DELETE SET NULL
+);
+
+CREATE INDEX report_events_disaster_report_id_idx ON report_events (disaster_report_id, created_at);
+
+INSERT INTO report_events (created_at, to_state, disaster_report_id)
+SELECT created_at, 'reported', disaster_report_id FROM disaster_reports;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE report_events;
+
+ALTER TABLE disaster_reports
+DROP COLUMN state;
+
+DROP TYPE report_state;
+-- +goose StatementEnd
@@ -0,0 +1,44 @@
+-- +goose Up
+-- +goose StatementBegin
+-- `status` becomes the latest status, so the one the report was filed with is kept
+ALTER TABLE disaster_reports
+ADD COLUMN initial_status citizen_status;
+
+UPDATE disaster_reports SET initial_status = status;
+
+ALTER TABLE disaster_reports
+ALTER COLUMN initial_status SET NOT NULL;
+
+-- Follow-ups from the citizen on an open report. The report's status is the
+-- latest one they gave.
+CREATE TABLE IF NOT EXISTS report_updates (
+    report_update_id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+
+    created_at timestamptz NOT NULL DEFAULT now(),
+    status citizen_status, -- Null when the status didn't change
+    raw_situation text,
+    disaster_report_id uuid NOT NULL,
+
+    FOREIGN KEY(disaster_report_id) REFERENCES disaster_reports(disaster_report_id) ON DELETE CASCADE
+);
+
+CREATE INDEX report_updates_disaster_report_id_idx ON report_updates (disaster_report_id, created_at);
+
+ALTER TABLE disaster_photos
+ADD COLUMN report_update_id uuid,
+ADD CONSTRAINT fk_report_updates_disaster_photos
+FOREIGN KEY (report_update_id)
+REFERENCES report_updates(report_update_id) ON DELETE CASCADE;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE disaster_photos
+DROP CONSTRAINT fk_report_updates_disaster_photos,
+DROP COLUMN report_update_id;
+
+DROP TABLE report_updates;
+
+ALTER TABLE disaster_reports
+DROP COLUMN initial_status;
+-- +goose StatementEnd
@@ -0,0 +1,25 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Thread between a report's reporter and its assigned responder
+CREATE TABLE IF NOT EXISTS report_messages (
+    report_message_id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+
+    created_at timestamptz NOT NULL DEFAULT now(),
+    sender_role text NOT NULL CHECK (sender_role IN ('reporter', 'responder')),
+    body text NOT NULL,
+    delivered_at timestamptz,
+    read_at timestamptz,
+    disaster_report_id uuid NOT NULL,
+    sender_user_id uuid, -- Null for anonymous reporters
+
+    FOREIGN KEY(disaster_report_id) REFERENCES disaster_reports(disaster_report_id) ON DELETE CASCADE,
+    FOREIGN KEY(sender_user_id) REFERENCES users(user_id) ON DELETE SET NULL
+);
+
+CREATE INDEX report_messages_disaster_report_id_idx ON report_messages (disaster_report_id, created_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE report_messages;
+-- +goose StatementEnd
@@ -0,0 +1,14 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Structured summary of the situation, `ai_gen_situation` keeps its text
+ALTER TABLE disaster_reports
+ADD COLUMN ai_summary jsonb,
+ADD COLUMN ai_summarized_at timestamptz;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE disaster_reports
+DROP COLUMN ai_summary,
+DROP COLUMN ai_summarized_at;
+-- +goose StatementEnd
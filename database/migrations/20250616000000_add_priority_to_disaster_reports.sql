@@ -0,0 +1,41 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Computed from the report, see `disaster.PriorityWeights`. Time based rules
+-- are added to it when reading, as of the same time for every page of a list.
+ALTER TABLE disaster_reports
+ADD COLUMN base_priority double precision NOT NULL DEFAULT 0,
+-- When the citizen was last heard from, through the report or a follow-up
+ADD COLUMN last_heard_at timestamptz NOT NULL DEFAULT now();
+
+UPDATE disaster_reports
+SET last_heard_at = COALESCE(
+    (
+        SELECT max(created_at) FROM report_updates
+        WHERE report_updates.disaster_report_id = disaster_reports.disaster_report_id
+    ),
+    created_at
+);
+
+CREATE INDEX disaster_reports_base_priority_idx ON disaster_reports (base_priority DESC);
+
+-- Areas known to be dangerous, reports from inside them are prioritized.
+-- `polygon` is an array of [longitude, latitude] points.
+CREATE TABLE IF NOT EXISTS hazard_zones (
+    hazard_zone_id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+
+    created_at timestamptz NOT NULL DEFAULT now(),
+    name text NOT NULL,
+    polygon jsonb NOT NULL
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE hazard_zones;
+
+DROP INDEX disaster_reports_base_priority_idx;
+
+ALTER TABLE disaster_reports
+DROP COLUMN last_heard_at,
+DROP COLUMN base_priority;
+-- +goose StatementEnd
@@ -0,0 +1,54 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TYPE incident_type AS ENUM(
+    'flood',
+    'typhoon',
+    'earthquake',
+    'fire',
+    'landslide',
+    'tsunami',
+    'other'
+);
+
+CREATE TYPE incident_status AS ENUM('active', 'closed');
+
+-- A disaster and the area it hit. Reports from inside `geofence`, an array of
+-- [longitude, latitude] points, are grouped under it while it's active.
+CREATE TABLE IF NOT EXISTS incidents (
+    incident_id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+
+    created_at timestamptz NOT NULL DEFAULT now(),
+    updated_at timestamptz NOT NULL DEFAULT now(),
+    name text NOT NULL,
+    type incident_type NOT NULL,
+    geofence jsonb NOT NULL,
+    started_at timestamptz NOT NULL DEFAULT now(),
+    ended_at timestamptz,
+    status incident_status NOT NULL DEFAULT 'active'
+);
+
+ALTER TABLE disaster_reports
+ADD COLUMN incident_id uuid,
+-- Set when a dispatcher moved the report, so it's never linked automatically again
+ADD COLUMN is_incident_set_manually boolean NOT NULL DEFAULT FALSE,
+ADD CONSTRAINT fk_incidents_disaster_reports
+FOREIGN KEY (incident_id)
+REFERENCES incidents(incident_id) ON DELETE SET NULL;
+
+CREATE INDEX disaster_reports_incident_id_idx ON disaster_reports (incident_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX disaster_reports_incident_id_idx;
+
+ALTER TABLE disaster_reports
+DROP CONSTRAINT fk_incidents_disaster_reports,
+DROP COLUMN incident_id,
+DROP COLUMN is_incident_set_manually;
+
+DROP TABLE incidents;
+
+DROP TYPE incident_status;
+DROP TYPE incident_type;
+-- +goose StatementEnd
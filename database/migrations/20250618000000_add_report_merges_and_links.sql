@@ -0,0 +1,42 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Duplicates are merged into one primary report, and share its responder
+ALTER TABLE disaster_reports
+ADD COLUMN merged_into_id uuid,
+ADD CONSTRAINT fk_disaster_reports_merged_into
+FOREIGN KEY (merged_into_id)
+REFERENCES disaster_reports(disaster_report_id) ON DELETE SET NULL;
+
+CREATE INDEX disaster_reports_merged_into_id_idx ON disaster_reports (merged_into_id);
+
+-- Reports about the same emergency that are kept apart, e.g. two families in
+-- the same house
+CREATE TABLE IF NOT EXISTS report_links (
+    report_link_id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+
+    created_at timestamptz NOT NULL DEFAULT now(),
+    disaster_report_id uuid NOT NULL,
+    linked_report_id uuid NOT NULL,
+    actor_user_id uuid,
+
+    FOREIGN KEY(disaster_report_id) REFERENCES disaster_reports(disaster_report_id) ON DELETE CASCADE,
+    FOREIGN KEY(linked_report_id) REFERENCES disaster_reports(disaster_report_id) ON DELETE CASCADE,
+    FOREIGN KEY(actor_user_id) REFERENCES users(user_id) ON DELETE SET NULL,
+    -- Links go both ways, so each pair is stored once with the lowest ID first
+    CHECK (disaster_report_id < linked_report_id),
+    UNIQUE (disaster_report_id, linked_report_id)
+);
+
+CREATE INDEX report_links_linked_report_id_idx ON report_links (linked_report_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE report_links;
+
+DROP INDEX disaster_reports_merged_into_id_idx;
+
+ALTER TABLE disaster_reports
+DROP CONSTRAINT fk_disaster_reports_merged_into,
+DROP COLUMN merged_into_id;
+-- +goose StatementEnd
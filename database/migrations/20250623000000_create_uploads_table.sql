@@ -0,0 +1,39 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Photos by who uploaded them. Reports and follow-ups only take their
+-- uploader's photos, see `disaster.attachPhotos`. Anonymous uploads move to
+-- the account that claims them.
+CREATE TABLE IF NOT EXISTS uploads (
+    upload_key text PRIMARY KEY,
+
+    created_at timestamptz NOT NULL DEFAULT now(),
+    photo_url text NOT NULL UNIQUE,
+    user_id uuid REFERENCES users (user_id) ON DELETE CASCADE,
+    anonymous_id text,
+
+    CHECK ((user_id IS NULL) != (anonymous_id IS NULL))
+);
+
+CREATE INDEX uploads_anonymous_id_idx ON uploads (anonymous_id);
+
+-- Photos uploaded before belong to whoever first attached them to a report
+INSERT INTO uploads (upload_key, created_at, photo_url, user_id, anonymous_id)
+SELECT DISTINCT ON (disaster_photos.photo_url)
+    regexp_replace(disaster_photos.photo_url, '^.*/api/photos/', ''),
+    disaster_reports.created_at,
+    disaster_photos.photo_url,
+    reporters.user_id,
+    reporters.anonymous_id
+FROM disaster_photos
+JOIN disaster_reports ON disaster_reports.disaster_report_id = disaster_photos.disaster_report_id
+JOIN reporters ON reporters.reporter_id = disaster_reports.reporter_id
+WHERE disaster_photos.photo_url LIKE '%/api/photos/%'
+    AND (reporters.user_id IS NULL) != (reporters.anonymous_id IS NULL)
+ORDER BY disaster_photos.photo_url, disaster_reports.created_at
+ON CONFLICT DO NOTHING;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE uploads;
+-- +goose StatementEnd
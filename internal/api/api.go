@@ -3,12 +3,20 @@ package api
 import (
 	"log/slog"
 	"net/http"
+	"regexp"
 )
 
 type HTTPHandler func(w http.ResponseWriter, r *http.Request) Response
 
 func (fn HTTPHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	res := fn(w, r)
+	res := Response{
+		Code:    http.StatusNotFound,
+		Message: "Not found.",
+	}
+
+	if hasValidIDs(r) {
+		res = fn(w, r)
+	}
 
 	if res.Error != nil {
 		slog.Error(res.Error.Error())
@@ -18,3 +26,31 @@ func (fn HTTPHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		slog.Error(err.Error())
 	}
 }
+
+// Path wildcards holding row IDs. Rows are keyed by UUIDs, so anything else
+// can't name one and is answered with 404 instead of failing the query.
+var idWildcards = []string{
+	"reportId",
+	"linkedReportId",
+	"reporterId",
+	"incidentId",
+	"hazardZoneId",
+	"householdId",
+	"userId",
+	"contactId",
+	"apiKeyId",
+}
+
+var uuidPattern = regexp.MustCompile(
+	`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`,
+)
+
+func hasValidIDs(r *http.Request) bool {
+	for _, name := range idWildcards {
+		if id := r.PathValue(name); id != "" && !uuidPattern.MatchString(id) {
+			return false
+		}
+	}
+
+	return true
+}
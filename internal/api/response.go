@@ -9,10 +9,18 @@ type Response struct {
 	Code    int    `json:"code"`
 	Message string `json:"message"`
 	Data    any    `json:"data"`
+	Meta    *Meta  `json:"meta,omitempty"`
 
 	Error error `json:"-"`
 }
 
+// Meta is only set on paginated lists.
+type Meta struct {
+	// Passed as the `cursor` query parameter to get the next page, `nil` on the
+	// last page
+	NextCursor *string `json:"nextCursor"`
+}
+
 func (r Response) Encode(w http.ResponseWriter) error {
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("X-Content-Type-Options", "nosniff")
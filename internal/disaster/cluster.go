@@ -0,0 +1,365 @@
+package disaster
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"math"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/redis/go-redis/v9"
+)
+
+// Reports are likely duplicates when their reporters were last seen close to
+// each other, they were filed around the same time and they say similar things.
+// Neighbours and relatives often report the same household.
+const (
+	duplicateRadiusMeters = 100
+	duplicateWindow       = 12 * time.Hour
+	duplicateMinScore     = 0.55
+
+	// How much each signal counts towards the score, they add up to 1
+	proximityWeight  = 0.4
+	recencyWeight    = 0.2
+	similarityWeight = 0.4
+)
+
+// Words too common to tell two situations apart, in English and Filipino.
+// Words shorter than 3 letters are always left out.
+var stopWords = []string{
+	"and", "are", "but", "for", "from", "has", "have", "our", "the", "their",
+	"there", "they", "this", "was", "were", "with",
+	"ako", "ang", "kami", "kay", "mga", "na", "namin", "nang", "ngayon", "po",
+	"sila", "yung",
+}
+
+// Open reports that haven't been merged, the only ones worth comparing
+type clusterReport struct {
+	DisasterReportID string
+	CreatedAt        time.Time
+	ReporterID       string
+	RawSituation     string
+}
+
+const clusterReportColumns = `
+	disaster_report_id,
+	created_at,
+	reporter_id,
+	raw_situation
+`
+
+const isClusterable = `
+	merged_into_id IS NULL
+	AND state NOT IN ('resolved', 'cancelled')
+`
+
+type duplicatePair struct {
+	DisasterReportID  string  `json:"reportId"`
+	DuplicateReportID string  `json:"duplicateReportId"`
+	DistanceMeters    float64 `json:"distanceMeters"`
+	MinutesApart      float64 `json:"minutesApart"`
+	Similarity        float64 `json:"similarity"` // Of the raw situations, from 0 to 1
+	Score             float64 `json:"score"`      // From 0 to 1
+}
+
+// Reports linked by likely duplicates, directly or through another report
+type reportCluster struct {
+	ReportIDs []string        `json:"reportIds"`
+	Pairs     []duplicatePair `json:"pairs"`
+}
+
+func words(text string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	res := []string{}
+
+	for _, field := range fields {
+		if len([]rune(field)) < 3 || slices.Contains(stopWords, field) ||
+			slices.Contains(res, field) {
+			continue
+		}
+
+		res = append(res, field)
+	}
+
+	return res
+}
+
+// similarity is the Jaccard index of the texts' words.
+func similarity(a, b string) float64 {
+	wordsA, wordsB := words(a), words(b)
+	if len(wordsA) == 0 || len(wordsB) == 0 {
+		return 0
+	}
+
+	shared := 0
+	for _, word := range wordsA {
+		if slices.Contains(wordsB, word) {
+			shared++
+		}
+	}
+
+	return float64(shared) / float64(len(wordsA)+len(wordsB)-shared)
+}
+
+func round(value float64) float64 {
+	return math.Round(value*100) / 100
+}
+
+// compare scores `b` as a duplicate of `a`. `distance` is between their
+// reporters' last locations, in meters.
+func compare(a, b clusterReport, distance float64) (duplicatePair, bool) {
+	apart := a.CreatedAt.Sub(b.CreatedAt).Abs()
+	if distance > duplicateRadiusMeters || apart > duplicateWindow {
+		return duplicatePair{}, false
+	}
+
+	pair := duplicatePair{
+		DisasterReportID:  a.DisasterReportID,
+		DuplicateReportID: b.DisasterReportID,
+		DistanceMeters:    round(distance),
+		MinutesApart:      round(apart.Minutes()),
+		Similarity:        round(similarity(a.RawSituation, b.RawSituation)),
+	}
+
+	pair.Score = round(
+		proximityWeight*(1-distance/duplicateRadiusMeters) +
+			recencyWeight*(1-float64(apart)/float64(duplicateWindow)) +
+			similarityWeight*pair.Similarity,
+	)
+
+	return pair, pair.Score >= duplicateMinScore
+}
+
+// nearbyReporters returns the reporters last seen around the location, with
+// their distance in meters.
+func (r *repository) nearbyReporters(ctx context.Context, loc location) (map[string]float64, error) {
+	locations, err := r.redisClient.GeoSearchLocation(
+		ctx,
+		reporterLocationsKey,
+		&redis.GeoSearchLocationQuery{
+			GeoSearchQuery: redis.GeoSearchQuery{
+				Longitude:  float64(loc.Longitude),
+				Latitude:   float64(loc.Latitude),
+				Radius:     duplicateRadiusMeters,
+				RadiusUnit: "m",
+			},
+			WithDist: true,
+		},
+	).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	res := make(map[string]float64, len(locations))
+	for _, location := range locations {
+		res[location.Name] = location.Dist
+	}
+
+	return res, nil
+}
+
+// ListDuplicateCandidates returns the reports that are likely duplicates of
+// the report, the likeliest first.
+func (r *repository) ListDuplicateCandidates(
+	ctx context.Context,
+	reportID string,
+) ([]duplicatePair, error) {
+	query := `
+	SELECT ` + clusterReportColumns + `
+	FROM disaster_reports
+	WHERE disaster_report_id = ($1)
+	`
+
+	rows, err := r.querier.Query(ctx, query, reportID)
+	if err != nil {
+		return nil, err
+	}
+
+	report, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[clusterReport])
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, errReportNotFound
+		}
+
+		return nil, err
+	}
+
+	pairs := []duplicatePair{}
+
+	locations, err := r.getLocations(ctx, []string{report.ReporterID})
+	if err != nil {
+		return nil, err
+	}
+
+	loc := locations[report.ReporterID]
+	if loc == nil {
+		return pairs, nil
+	}
+
+	nearby, err := r.nearbyReporters(ctx, *loc)
+	if err != nil {
+		return nil, err
+	}
+
+	reporterIDs := make([]string, 0, len(nearby))
+	for reporterID := range nearby {
+		reporterIDs = append(reporterIDs, reporterID)
+	}
+
+	query = `
+	SELECT ` + clusterReportColumns + `
+	FROM disaster_reports
+	WHERE reporter_id::text = ANY($1)
+		AND disaster_report_id != ($2)
+		AND ` + isClusterable
+
+	rows, err = r.querier.Query(ctx, query, reporterIDs, reportID)
+	if err != nil {
+		return nil, err
+	}
+
+	candidates, err := pgx.CollectRows(rows, pgx.RowToStructByName[clusterReport])
+	if err != nil {
+		return nil, err
+	}
+
+	for _, candidate := range candidates {
+		if pair, ok := compare(report, candidate, nearby[candidate.ReporterID]); ok {
+			pairs = append(pairs, pair)
+		}
+	}
+
+	slices.SortFunc(pairs, func(a, b duplicatePair) int {
+		return cmp.Compare(b.Score, a.Score)
+	})
+
+	return pairs, nil
+}
+
+// ListReportClusters groups the open reports, of the incident if given, that
+// are likely duplicates of each other. Reports without duplicates are left out.
+func (r *repository) ListReportClusters(
+	ctx context.Context,
+	incidentID *string,
+) ([]reportCluster, error) {
+	query := `
+	SELECT ` + clusterReportColumns + `
+	FROM disaster_reports
+	WHERE (($1)::uuid IS NULL OR incident_id = ($1))
+		AND ` + isClusterable + `
+	ORDER BY created_at
+	`
+
+	rows, err := r.querier.Query(ctx, query, incidentID)
+	if err != nil {
+		return nil, err
+	}
+
+	reports, err := pgx.CollectRows(rows, pgx.RowToStructByName[clusterReport])
+	if err != nil {
+		return nil, err
+	}
+
+	byReporter := make(map[string][]clusterReport)
+	for _, report := range reports {
+		byReporter[report.ReporterID] = append(byReporter[report.ReporterID], report)
+	}
+
+	reporterIDs := make([]string, 0, len(byReporter))
+	for reporterID := range byReporter {
+		reporterIDs = append(reporterIDs, reporterID)
+	}
+
+	locations, err := r.getLocations(ctx, reporterIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	// Union-find of the reports, each cluster is named after its root
+	parents := make(map[string]string)
+
+	var root func(reportID string) string
+	root = func(reportID string) string {
+		parent, ok := parents[reportID]
+		if !ok || parent == reportID {
+			return reportID
+		}
+
+		parents[reportID] = root(parent)
+
+		return parents[reportID]
+	}
+
+	var pairs []duplicatePair
+
+	for reporterID, loc := range locations {
+		nearby, err := r.nearbyReporters(ctx, *loc)
+		if err != nil {
+			return nil, err
+		}
+
+		for otherID, distance := range nearby {
+			// Each pair of reporters is compared once
+			if otherID < reporterID {
+				continue
+			}
+
+			for i, a := range byReporter[reporterID] {
+				for j, b := range byReporter[otherID] {
+					if otherID == reporterID && j <= i {
+						continue
+					}
+
+					pair, ok := compare(a, b, distance)
+					if !ok {
+						continue
+					}
+
+					pairs = append(pairs, pair)
+					parents[root(b.DisasterReportID)] = root(a.DisasterReportID)
+				}
+			}
+		}
+	}
+
+	clusters := make(map[string]*reportCluster)
+	var roots []string
+
+	for _, pair := range pairs {
+		clusterID := root(pair.DisasterReportID)
+
+		cluster, ok := clusters[clusterID]
+		if !ok {
+			cluster = &reportCluster{ReportIDs: []string{}}
+			clusters[clusterID] = cluster
+			roots = append(roots, clusterID)
+		}
+
+		for _, reportID := range []string{pair.DisasterReportID, pair.DuplicateReportID} {
+			if !slices.Contains(cluster.ReportIDs, reportID) {
+				cluster.ReportIDs = append(cluster.ReportIDs, reportID)
+			}
+		}
+
+		cluster.Pairs = append(cluster.Pairs, pair)
+	}
+
+	res := make([]reportCluster, len(roots))
+	for i, clusterID := range roots {
+		res[i] = *clusters[clusterID]
+	}
+
+	// The biggest clusters waste the most trips
+	slices.SortStableFunc(res, func(a, b reportCluster) int {
+		return cmp.Compare(len(b.ReportIDs), len(a.ReportIDs))
+	})
+
+	return res, nil
+}
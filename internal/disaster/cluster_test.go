@@ -0,0 +1,50 @@
+package disaster
+
+import "testing"
+
+func TestSimilarity(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want float64
+	}{
+		{
+			name: "same words",
+			a:    "Flood water rising fast",
+			b:    "fast rising flood water",
+			want: 1,
+		},
+		{
+			name: "no shared words",
+			a:    "flood water rising",
+			b:    "fire spreading house",
+			want: 0,
+		},
+		{
+			name: "some shared words",
+			a:    "flood water rising",
+			b:    "flood water roof",
+			want: 0.5,
+		},
+		{
+			name: "stop words and short words ignored",
+			a:    "the flood is here",
+			b:    "flood",
+			want: 0.5,
+		},
+		{
+			name: "empty text",
+			a:    "",
+			b:    "flood",
+			want: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := similarity(tt.a, tt.b); got != tt.want {
+				t.Errorf("similarity = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
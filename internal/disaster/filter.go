@@ -0,0 +1,261 @@
+package disaster
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultReportsLimit = 50
+	maxReportsLimit     = 200
+)
+
+type reportSort string
+
+const (
+	sortBySeverity reportSort = "severity"
+	sortByAge      reportSort = "age"
+	sortByPriority reportSort = "priority"
+)
+
+var errInvalidReportFilter = errors.New("invalid report filter")
+
+// Bounding box of reporters' last known locations
+type boundingBox struct {
+	MinLongitude float64
+	MinLatitude  float64
+	MaxLongitude float64
+	MaxLatitude  float64
+}
+
+func (b boundingBox) contains(longitude, latitude float64) bool {
+	return longitude >= b.MinLongitude && longitude <= b.MaxLongitude &&
+		latitude >= b.MinLatitude && latitude <= b.MaxLatitude
+}
+
+// Filters for `ListDisasterReports`. They apply to the report picked for each
+// reporter, so a reporter whose worst report doesn't match isn't listed. The
+// incident is the exception, the report is picked among the incident's.
+type reportFilter struct {
+	IncidentID    *string
+	Statuses      []citizenStatus
+	States        []reportState
+	IsAssigned    *bool
+	ResponderID   *string
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	BoundingBox   *boundingBox
+
+	Sort       reportSort
+	Descending bool
+	Limit      int
+	Cursor     *reportCursor
+}
+
+// Position of the last report of a page. It's opaque to clients, who pass it
+// back as is to get the next page.
+type reportCursor struct {
+	Sort       reportSort `json:"sort"`
+	Descending bool       `json:"descending"`
+	Severity   int        `json:"severity"`
+	Priority   float64    `json:"priority"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	ReportID   string     `json:"reportId"`
+
+	// Priorities are computed as of the first page's time for every page, see
+	// `PriorityWeights.priorityExpression`
+	PriorityAt time.Time `json:"priorityAt"`
+}
+
+func (c reportCursor) encode() (string, error) {
+	byt, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(byt), nil
+}
+
+func decodeReportCursor(cursor string) (reportCursor, error) {
+	byt, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return reportCursor{}, err
+	}
+
+	var res reportCursor
+
+	if err := json.Unmarshal(byt, &res); err != nil {
+		return reportCursor{}, err
+	}
+
+	return res, nil
+}
+
+// parseReportFilter reads the filters from the query string:
+//
+//	incidentId=<id>
+//	status=in_danger,at_risk
+//	state=reported,assigned
+//	assigned=true
+//	responderId=<id>
+//	createdAfter=<RFC 3339>&createdBefore=<RFC 3339>
+//	bbox=<min longitude>,<min latitude>,<max longitude>,<max latitude>
+//	sort=severity|age|priority&order=asc|desc
+//	limit=50&cursor=<next cursor of the previous page>
+//
+// Reports are sorted by severity, worst first, unless asked otherwise. Sorting
+// by age in descending order lists the reports that waited the longest first.
+func parseReportFilter(r *http.Request) (reportFilter, error) {
+	query := r.URL.Query()
+
+	filter := reportFilter{
+		Sort:       sortBySeverity,
+		Descending: true,
+		Limit:      defaultReportsLimit,
+	}
+
+	if value := query.Get("incidentId"); value != "" {
+		filter.IncidentID = &value
+	}
+
+	if value := query.Get("status"); value != "" {
+		for status := range strings.SplitSeq(value, ",") {
+			status := citizenStatus(strings.TrimSpace(status))
+			if status.severity() == 0 {
+				return reportFilter{}, fmt.Errorf("%w: unknown status %q", errInvalidReportFilter, status)
+			}
+
+			filter.Statuses = append(filter.Statuses, status)
+		}
+	}
+
+	if value := query.Get("state"); value != "" {
+		for state := range strings.SplitSeq(value, ",") {
+			state := reportState(strings.TrimSpace(state))
+			if !state.isValid() {
+				return reportFilter{}, fmt.Errorf("%w: unknown state %q", errInvalidReportFilter, state)
+			}
+
+			filter.States = append(filter.States, state)
+		}
+	}
+
+	if value := query.Get("assigned"); value != "" {
+		isAssigned, err := strconv.ParseBool(value)
+		if err != nil {
+			return reportFilter{}, fmt.Errorf("%w: assigned: %w", errInvalidReportFilter, err)
+		}
+
+		filter.IsAssigned = &isAssigned
+	}
+
+	if value := query.Get("responderId"); value != "" {
+		filter.ResponderID = &value
+	}
+
+	for name, target := range map[string]**time.Time{
+		"createdAfter":  &filter.CreatedAfter,
+		"createdBefore": &filter.CreatedBefore,
+	} {
+		value := query.Get(name)
+		if value == "" {
+			continue
+		}
+
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return reportFilter{}, fmt.Errorf("%w: %s: %w", errInvalidReportFilter, name, err)
+		}
+
+		*target = &t
+	}
+
+	if value := query.Get("bbox"); value != "" {
+		box, err := parseBoundingBox(value)
+		if err != nil {
+			return reportFilter{}, err
+		}
+
+		filter.BoundingBox = &box
+	}
+
+	switch sort := reportSort(query.Get("sort")); sort {
+	case "", sortBySeverity:
+	case sortByAge, sortByPriority:
+		filter.Sort = sort
+	default:
+		return reportFilter{}, fmt.Errorf("%w: unknown sort %q", errInvalidReportFilter, sort)
+	}
+
+	switch order := query.Get("order"); order {
+	case "", "desc":
+	case "asc":
+		filter.Descending = false
+	default:
+		return reportFilter{}, fmt.Errorf("%w: unknown order %q", errInvalidReportFilter, order)
+	}
+
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxReportsLimit {
+			return reportFilter{}, fmt.Errorf("%w: limit %q", errInvalidReportFilter, value)
+		}
+
+		filter.Limit = limit
+	}
+
+	if value := query.Get("cursor"); value != "" {
+		cursor, err := decodeReportCursor(value)
+		if err != nil {
+			return reportFilter{}, fmt.Errorf("%w: cursor: %w", errInvalidReportFilter, err)
+		}
+
+		// A cursor only makes sense in the order it was made for
+		if cursor.Sort != filter.Sort || cursor.Descending != filter.Descending {
+			return reportFilter{}, fmt.Errorf("%w: cursor for another sort", errInvalidReportFilter)
+		}
+
+		filter.Cursor = &cursor
+	}
+
+	return filter, nil
+}
+
+func parseBoundingBox(value string) (boundingBox, error) {
+	parts := strings.Split(value, ",")
+	if len(parts) != 4 {
+		return boundingBox{}, fmt.Errorf("%w: bbox needs 4 coordinates", errInvalidReportFilter)
+	}
+
+	coords := make([]float64, len(parts))
+
+	for i, part := range parts {
+		coord, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return boundingBox{}, fmt.Errorf("%w: bbox: %w", errInvalidReportFilter, err)
+		}
+
+		coords[i] = coord
+	}
+
+	box := boundingBox{
+		MinLongitude: coords[0],
+		MinLatitude:  coords[1],
+		MaxLongitude: coords[2],
+		MaxLatitude:  coords[3],
+	}
+
+	if box.MinLongitude > box.MaxLongitude || box.MinLatitude > box.MaxLatitude ||
+		box.MinLongitude < -180 || box.MaxLongitude > 180 ||
+		box.MinLatitude < -85.05 || box.MaxLatitude > 85.05 {
+		return boundingBox{}, fmt.Errorf("%w: bbox out of range", errInvalidReportFilter)
+	}
+
+	return box, nil
+}
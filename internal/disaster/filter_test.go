@@ -0,0 +1,350 @@
+package disaster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestParseReportFilter(t *testing.T) {
+	createdAfter := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	cursor := reportCursor{Sort: sortByAge, Descending: true, ReportID: "report-1"}
+	encoded, err := cursor.encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		query   string
+		want    reportFilter
+		wantErr bool
+	}{
+		{
+			name:  "defaults",
+			query: "",
+			want: reportFilter{
+				Sort:       sortBySeverity,
+				Descending: true,
+				Limit:      defaultReportsLimit,
+			},
+		},
+		{
+			name: "every filter",
+			query: "incidentId=incident-1&status=in_danger,%20at_risk&state=reported,assigned" +
+				"&assigned=false&responderId=responder-1&createdAfter=2025-06-01T00:00:00Z" +
+				"&bbox=120,14,121,15&sort=priority&order=asc&limit=10",
+			want: reportFilter{
+				IncidentID:   ptr("incident-1"),
+				Statuses:     []citizenStatus{"in_danger", "at_risk"},
+				States:       []reportState{reported, assigned},
+				IsAssigned:   ptr(false),
+				ResponderID:  ptr("responder-1"),
+				CreatedAfter: &createdAfter,
+				BoundingBox: &boundingBox{
+					MinLongitude: 120,
+					MinLatitude:  14,
+					MaxLongitude: 121,
+					MaxLatitude:  15,
+				},
+				Sort:  sortByPriority,
+				Limit: 10,
+			},
+		},
+		{
+			name:  "cursor",
+			query: "sort=age&cursor=" + encoded,
+			want: reportFilter{
+				Sort:       sortByAge,
+				Descending: true,
+				Limit:      defaultReportsLimit,
+				Cursor:     &cursor,
+			},
+		},
+		{name: "cursor for another sort", query: "cursor=" + encoded, wantErr: true},
+		{name: "unknown status", query: "status=lost", wantErr: true},
+		{name: "unknown state", query: "state=lost", wantErr: true},
+		{name: "invalid assigned", query: "assigned=maybe", wantErr: true},
+		{name: "invalid date", query: "createdBefore=yesterday", wantErr: true},
+		{name: "bbox with 3 coordinates", query: "bbox=120,14,121", wantErr: true},
+		{name: "bbox out of range", query: "bbox=120,14,200,15", wantErr: true},
+		{name: "flipped bbox", query: "bbox=121,14,120,15", wantErr: true},
+		{name: "unknown sort", query: "sort=name", wantErr: true},
+		{name: "unknown order", query: "order=up", wantErr: true},
+		{name: "zero limit", query: "limit=0", wantErr: true},
+		{name: "limit over max", query: "limit=201", wantErr: true},
+		{name: "invalid cursor", query: "cursor=!!!", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/api/reports?"+tt.query, nil)
+
+			got, err := parseReportFilter(r)
+			if tt.wantErr {
+				if !errors.Is(err, errInvalidReportFilter) {
+					t.Fatalf("err = %v, want %v", err, errInvalidReportFilter)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("filter = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestListReportsQuery(t *testing.T) {
+	createdAfter := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	createdBefore := createdAfter.AddDate(0, 1, 0)
+
+	filter := reportFilter{
+		IncidentID:    ptr("incident-1"),
+		Statuses:      []citizenStatus{"in_danger"},
+		States:        []reportState{reported},
+		IsAssigned:    ptr(false),
+		ResponderID:   ptr("responder-1"),
+		CreatedAfter:  &createdAfter,
+		CreatedBefore: &createdBefore,
+		BoundingBox: &boundingBox{
+			MinLongitude: 120,
+			MinLatitude:  14,
+			MaxLongitude: 121,
+			MaxLatitude:  15,
+		},
+		Sort:       sortBySeverity,
+		Descending: true,
+		Limit:      10,
+		Cursor:     &reportCursor{Sort: sortBySeverity, Descending: true, ReportID: "report-1"},
+	}
+
+	query, args := listReportsQuery(filter, PriorityWeights{}, []string{"reporter-1"}, createdAfter)
+
+	// Everything before the outer `FROM worst` is the CTE picking each reporter's
+	// report, which must only see the reports the filter matches
+	cte, outer, ok := strings.Cut(query, "FROM worst")
+	if !ok {
+		t.Fatalf("query has no FROM worst:\n%s", query)
+	}
+
+	predicates := []string{
+		"disaster_reports.merged_into_id IS NULL",
+		"disaster_reports.incident_id::text = ",
+		"disaster_reports.status::text = ANY",
+		"disaster_reports.state::text = ANY",
+		"disaster_reports.responder_id IS NULL",
+		"disaster_reports.responder_id::text = ",
+		"disaster_reports.created_at >= ",
+		"disaster_reports.created_at < ",
+		"disaster_reports.reporter_id::text = ANY",
+	}
+
+	for _, predicate := range predicates {
+		if !strings.Contains(cte, predicate) {
+			t.Errorf("%q is not applied before DISTINCT ON", predicate)
+		}
+	}
+
+	if strings.Contains(outer, "disaster_reports.") {
+		t.Errorf("reports are filtered after DISTINCT ON:\n%s", outer)
+	}
+
+	if !strings.Contains(outer, "WHERE (worst.severity, worst.created_at, worst.disaster_report_id) < ") {
+		t.Errorf("cursor is not applied on worst:\n%s", outer)
+	}
+
+	// Postgres can't tell the type of a parameter the query doesn't use
+	for i := range args {
+		if !strings.Contains(query, fmt.Sprintf("($%d)", i+1)) {
+			t.Errorf("$%d is passed but not used", i+1)
+		}
+	}
+}
+
+// Needs a migrated database and Redis, the ones from `DATABASE_URL` and
+// `REDIS_URL` are used.
+func newTestRepository(t *testing.T) *repository {
+	t.Helper()
+
+	databaseURL, redisURL := os.Getenv("DATABASE_URL"), os.Getenv("REDIS_URL")
+	if databaseURL == "" || redisURL == "" {
+		t.Skip("DATABASE_URL or REDIS_URL is not set")
+	}
+
+	pool, err := pgxpool.New(context.Background(), databaseURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pool.Close)
+
+	opt, err := redis.ParseURL(redisURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	redisClient := redis.NewClient(opt)
+	t.Cleanup(func() { redisClient.Close() })
+
+	return &repository{querier: pool, redisClient: redisClient}
+}
+
+// Reports are created in 2099 so no others are listed along with them
+var testReportsCreatedAt = time.Date(2099, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// newTestReporter creates a reporter whose reports are deleted with it once the
+// test is done.
+func newTestReporter(t *testing.T, r *repository) string {
+	t.Helper()
+
+	ctx := context.Background()
+
+	var reporterID string
+
+	query := `INSERT INTO reporters (name) VALUES ('Juan') RETURNING reporter_id`
+	if err := r.querier.QueryRow(ctx, query).Scan(&reporterID); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		r.querier.Exec(ctx, `DELETE FROM disaster_reports WHERE reporter_id = ($1)`, reporterID)
+		r.querier.Exec(ctx, `DELETE FROM reporters WHERE reporter_id = ($1)`, reporterID)
+	})
+
+	return reporterID
+}
+
+func newTestReport(
+	t *testing.T,
+	r *repository,
+	reporterID string,
+	status citizenStatus,
+	state reportState,
+	responderID *string,
+) string {
+	t.Helper()
+
+	query := `
+	INSERT INTO disaster_reports (
+		created_at,
+		status,
+		state,
+		raw_situation,
+		reporter_id,
+		responder_id
+	)
+	VALUES ($1, $2, $3, '', $4, $5)
+	RETURNING disaster_report_id
+	`
+
+	var reportID string
+
+	row := r.querier.QueryRow(
+		context.Background(),
+		query,
+		testReportsCreatedAt,
+		status,
+		state,
+		reporterID,
+		responderID,
+	)
+	if err := row.Scan(&reportID); err != nil {
+		t.Fatal(err)
+	}
+
+	return reportID
+}
+
+func TestListDisasterReportsMixedReports(t *testing.T) {
+	r := newTestRepository(t)
+	ctx := context.Background()
+
+	var responderID string
+
+	query := `INSERT INTO responders (name) VALUES ('Maria') RETURNING responder_id`
+	if err := r.querier.QueryRow(ctx, query).Scan(&responderID); err != nil {
+		t.Fatal(err)
+	}
+	defer r.querier.Exec(ctx, `DELETE FROM responders WHERE responder_id = ($1)`, responderID)
+
+	type testReport struct {
+		status     citizenStatus
+		state      reportState
+		isAssigned bool
+	}
+
+	tests := []struct {
+		name   string
+		states []reportState
+		// Reports of one reporter, the one it should be listed by first
+		reports []testReport
+	}{
+		{
+			// The worst report doesn't match the filter, the other one does
+			name:   "filtered by state",
+			states: []reportState{reported},
+			reports: []testReport{
+				{status: "at_risk", state: reported},
+				{status: "in_danger", state: resolved},
+			},
+		},
+		{
+			// The closed report is worse and unassigned, but the reporter still
+			// needs help with the open one
+			name: "closed report",
+			reports: []testReport{
+				{status: "at_risk", state: assigned, isAssigned: true},
+				{status: "in_danger", state: cancelled},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reporterID := newTestReporter(t, r)
+
+			var reportIDs []string
+			for _, report := range tt.reports {
+				var reportResponderID *string
+				if report.isAssigned {
+					reportResponderID = &responderID
+				}
+
+				reportIDs = append(
+					reportIDs,
+					newTestReport(t, r, reporterID, report.status, report.state, reportResponderID),
+				)
+			}
+
+			page, err := r.ListDisasterReports(ctx, reportFilter{
+				States:       tt.states,
+				CreatedAfter: &testReportsCreatedAt,
+				Sort:         sortBySeverity,
+				Descending:   true,
+				Limit:        10,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(page.Reports) != 1 || page.Reports[0].DisasterReportID != reportIDs[0] {
+				t.Errorf("reports = %+v, want only %s", page.Reports, reportIDs[0])
+			}
+		})
+	}
+}
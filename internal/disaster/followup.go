@@ -0,0 +1,198 @@
+package disaster
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Follow-ups keep one evolving timeline per emergency instead of a new report
+// each time the citizen's situation changes.
+type reportUpdate struct {
+	ReportUpdateID   string         `json:"id"`
+	CreatedAt        time.Time      `json:"createdAt"`
+	DisasterReportID string         `json:"reportId"`
+	Status           *citizenStatus `json:"status"`
+	RawSituation     *string        `json:"rawSituation"`
+	PhotoURLs        []string       `json:"photoUrls"`
+
+	// The report's status before this update
+	PreviousStatus *citizenStatus `json:"-" db:"-"`
+}
+
+const reportUpdated = "disaster:report_updated" // Broadcast after every follow-up
+
+var (
+	errReportClosed      = errors.New("report is closed")
+	errNotOwnReport      = errors.New("report does not belong to caller")
+	errEmptyReportUpdate = errors.New("empty report update")
+)
+
+type addReportUpdateRequest struct {
+	DisasterReportID string         `json:"-"`
+	Status           *citizenStatus `json:"status"`
+	RawSituation     *string        `json:"rawSituation"`
+	PhotoIDs         []string       `json:"photoIds"` // Uploaded by the caller, see `UploadPhoto`
+}
+
+func (arg addReportUpdateRequest) isEmpty() bool {
+	return arg.Status == nil &&
+		(arg.RawSituation == nil || *arg.RawSituation == "") &&
+		len(arg.PhotoIDs) == 0
+}
+
+// AddReportUpdate appends a follow-up to the caller's open report, the one they
+// filed as `caller`. Follow-ups to a merged report go to the report it's merged
+// into.
+func (r *repository) AddReportUpdate(
+	ctx context.Context,
+	arg addReportUpdateRequest,
+	caller reporterIdentity,
+) (reportUpdate, error) {
+	if arg.isEmpty() {
+		return reportUpdate{}, errEmptyReportUpdate
+	}
+
+	tx, err := r.querier.Begin(ctx)
+	if err != nil {
+		return reportUpdate{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+	SELECT target.disaster_report_id, target.state, own.status
+	FROM disaster_reports AS own
+	JOIN reporters ON reporters.reporter_id = own.reporter_id
+	JOIN disaster_reports AS target
+		ON target.disaster_report_id = COALESCE(own.merged_into_id, own.disaster_report_id)
+	WHERE own.disaster_report_id = ($1)
+		AND (reporters.user_id = ($2) OR reporters.anonymous_id = ($3))
+	FOR UPDATE OF target
+	`
+
+	var state reportState
+	var previousStatus citizenStatus
+
+	row := tx.QueryRow(ctx, query, arg.DisasterReportID, caller.UserID, caller.AnonymousID)
+	if err := row.Scan(&arg.DisasterReportID, &state, &previousStatus); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return reportUpdate{}, errNotOwnReport
+		}
+
+		return reportUpdate{}, err
+	}
+
+	if state.isClosed() {
+		return reportUpdate{}, errReportClosed
+	}
+
+	update, err := insertReportUpdate(ctx, tx, arg, caller)
+	if err != nil {
+		return reportUpdate{}, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return reportUpdate{}, err
+	}
+
+	update.PreviousStatus = &previousStatus
+
+	if err := r.updatePriorities(ctx, arg.DisasterReportID); err != nil {
+		return reportUpdate{}, err
+	}
+
+	if err := r.broadcast(ctx, arg.DisasterReportID, reportUpdated, update); err != nil {
+		return reportUpdate{}, err
+	}
+
+	if err := r.enqueueSummary(ctx, arg.DisasterReportID); err != nil {
+		return reportUpdate{}, err
+	}
+
+	return update, nil
+}
+
+// insertReportUpdate also makes the update's status the report's current one.
+// The photos must be uploaded by `owner`. The report must be locked by `tx`.
+func insertReportUpdate(
+	ctx context.Context,
+	tx pgx.Tx,
+	arg addReportUpdateRequest,
+	owner reporterIdentity,
+) (reportUpdate, error) {
+	query := `
+	INSERT INTO report_updates (status, raw_situation, disaster_report_id)
+	VALUES ($1, $2, $3)
+	RETURNING report_update_id, created_at, disaster_report_id, status, raw_situation
+	`
+
+	var update reportUpdate
+
+	row := tx.QueryRow(ctx, query, arg.Status, arg.RawSituation, arg.DisasterReportID)
+	if err := row.Scan(
+		&update.ReportUpdateID,
+		&update.CreatedAt,
+		&update.DisasterReportID,
+		&update.Status,
+		&update.RawSituation,
+	); err != nil {
+		return reportUpdate{}, err
+	}
+
+	photoURLs, err := attachPhotos(
+		ctx,
+		tx,
+		owner,
+		arg.PhotoIDs,
+		arg.DisasterReportID,
+		&update.ReportUpdateID,
+	)
+	if err != nil {
+		return reportUpdate{}, err
+	}
+
+	update.PhotoURLs = photoURLs
+
+	query = `
+	UPDATE disaster_reports
+	SET status = COALESCE(($1), status), updated_at = NOW()
+	WHERE disaster_report_id = ($2)
+	`
+
+	if _, err := tx.Exec(ctx, query, arg.Status, arg.DisasterReportID); err != nil {
+		return reportUpdate{}, err
+	}
+
+	return update, nil
+}
+
+func (r *repository) listReportUpdates(ctx context.Context, reportID string) ([]reportUpdate, error) {
+	query := `
+	SELECT
+		report_updates.report_update_id,
+		report_updates.created_at,
+		report_updates.disaster_report_id,
+		report_updates.status,
+		report_updates.raw_situation,
+		COALESCE(
+			(
+				SELECT array_agg(photo_url)
+				FROM disaster_photos
+				WHERE disaster_photos.report_update_id = report_updates.report_update_id
+			),
+			'{}'
+		) AS photo_urls
+	FROM report_updates
+	WHERE report_updates.disaster_report_id = ($1)
+	ORDER BY report_updates.created_at
+	`
+
+	rows, err := r.querier.Query(ctx, query, reportID)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, pgx.RowToStructByName[reportUpdate])
+}
@@ -0,0 +1,469 @@
+package disaster
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+type incidentType string
+
+const (
+	flood      incidentType = "flood"
+	typhoon    incidentType = "typhoon"
+	earthquake incidentType = "earthquake"
+	fire       incidentType = "fire"
+	landslide  incidentType = "landslide"
+	tsunami    incidentType = "tsunami"
+	other      incidentType = "other"
+)
+
+func (t incidentType) isValid() bool {
+	return slices.Contains(
+		[]incidentType{flood, typhoon, earthquake, fire, landslide, tsunami, other},
+		t,
+	)
+}
+
+type incidentStatus string
+
+const (
+	incidentActive incidentStatus = "active"
+	incidentClosed incidentStatus = "closed"
+)
+
+func (s incidentStatus) isValid() bool {
+	return s == incidentActive || s == incidentClosed
+}
+
+// Reports are grouped by incident so each disaster gets its own list, while
+// those outside every incident's area stay ungrouped.
+type incident struct {
+	IncidentID string         `json:"id"`
+	CreatedAt  time.Time      `json:"createdAt"`
+	UpdatedAt  time.Time      `json:"updatedAt"`
+	Name       string         `json:"name"`
+	Type       incidentType   `json:"type"`
+	Geofence   polygon        `json:"geofence"`
+	StartedAt  time.Time      `json:"startedAt"`
+	EndedAt    *time.Time     `json:"endedAt"`
+	Status     incidentStatus `json:"status"`
+}
+
+const incidentColumns = `
+	incident_id,
+	created_at,
+	updated_at,
+	name,
+	type,
+	geofence,
+	started_at,
+	ended_at,
+	status
+`
+
+// Only active incidents that already started and haven't ended get new reports
+const isIncidentActive = `
+	status = 'active'
+	AND started_at <= NOW()
+	AND (ended_at IS NULL OR ended_at > NOW())
+`
+
+// Broadcast when a report is linked to an incident, or moved out of one
+const reportIncidentChanged = "disaster:report_incident_changed"
+
+var (
+	errIncidentNotFound = errors.New("incident not found")
+	errInvalidIncident  = errors.New("invalid incident")
+)
+
+type reportIncidentChange struct {
+	DisasterReportID string  `json:"reportId"`
+	IncidentID       *string `json:"incidentId"`
+}
+
+func (r *repository) ListIncidents(ctx context.Context, status *incidentStatus) ([]incident, error) {
+	query := `
+	SELECT ` + incidentColumns + `
+	FROM incidents
+	WHERE ($1)::incident_status IS NULL OR status = ($1)
+	ORDER BY started_at DESC
+	`
+
+	rows, err := r.querier.Query(ctx, query, status)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, pgx.RowToStructByName[incident])
+}
+
+func (r *repository) GetIncident(ctx context.Context, incidentID string) (incident, error) {
+	query := `
+	SELECT ` + incidentColumns + `
+	FROM incidents
+	WHERE incident_id = ($1)
+	`
+
+	rows, err := r.querier.Query(ctx, query, incidentID)
+	if err != nil {
+		return incident{}, err
+	}
+
+	res, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[incident])
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return incident{}, errIncidentNotFound
+		}
+
+		return incident{}, err
+	}
+
+	return res, nil
+}
+
+type createIncidentRequest struct {
+	Name      string       `json:"name"`
+	Type      incidentType `json:"type"`
+	Geofence  polygon      `json:"geofence"`
+	StartedAt *time.Time   `json:"startedAt"` // Now when not given
+}
+
+// CreateIncident also links the open reports already inside the incident's area.
+func (r *repository) CreateIncident(
+	ctx context.Context,
+	arg createIncidentRequest,
+) (incident, error) {
+	arg.Name = strings.TrimSpace(arg.Name)
+	if arg.Name == "" || !arg.Type.isValid() || !arg.Geofence.isValid() {
+		return incident{}, errInvalidIncident
+	}
+
+	query := `
+	INSERT INTO incidents (name, type, geofence, started_at)
+	VALUES ($1, $2, $3, COALESCE(($4), NOW()))
+	RETURNING ` + incidentColumns
+
+	rows, err := r.querier.Query(ctx, query, arg.Name, arg.Type, arg.Geofence, arg.StartedAt)
+	if err != nil {
+		return incident{}, err
+	}
+
+	res, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[incident])
+	if err != nil {
+		return incident{}, err
+	}
+
+	if err := r.linkReportsInArea(ctx, res); err != nil {
+		return incident{}, err
+	}
+
+	return res, nil
+}
+
+// Only the fields given are changed. Closing an incident ends it now unless
+// told otherwise, and reopening it clears its end.
+type updateIncidentRequest struct {
+	IncidentID string          `json:"-"`
+	Name       *string         `json:"name"`
+	Type       *incidentType   `json:"type"`
+	Geofence   *polygon        `json:"geofence"`
+	StartedAt  *time.Time      `json:"startedAt"`
+	EndedAt    *time.Time      `json:"endedAt"`
+	Status     *incidentStatus `json:"status"`
+}
+
+func (arg updateIncidentRequest) isValid() bool {
+	if arg.Name != nil && strings.TrimSpace(*arg.Name) == "" {
+		return false
+	}
+
+	if arg.Type != nil && !arg.Type.isValid() {
+		return false
+	}
+
+	if arg.Geofence != nil && !arg.Geofence.isValid() {
+		return false
+	}
+
+	return arg.Status == nil || arg.Status.isValid()
+}
+
+// UpdateIncident links the open reports inside the incident's area again, in
+// case it grew or was reopened. Reports already linked stay, even outside it.
+func (r *repository) UpdateIncident(
+	ctx context.Context,
+	arg updateIncidentRequest,
+) (incident, error) {
+	if !arg.isValid() {
+		return incident{}, errInvalidIncident
+	}
+
+	if arg.Name != nil {
+		name := strings.TrimSpace(*arg.Name)
+		arg.Name = &name
+	}
+
+	query := `
+	UPDATE incidents
+	SET
+		name = COALESCE(($1), name),
+		type = COALESCE(($2), type),
+		geofence = COALESCE(($3), geofence),
+		started_at = COALESCE(($4), started_at),
+		ended_at = CASE ($6)::incident_status
+			WHEN 'active' THEN ($5)
+			WHEN 'closed' THEN COALESCE(($5), ended_at, NOW())
+			ELSE COALESCE(($5), ended_at)
+		END,
+		status = COALESCE(($6), status),
+		updated_at = NOW()
+	WHERE incident_id = ($7)
+	RETURNING ` + incidentColumns
+
+	rows, err := r.querier.Query(
+		ctx,
+		query,
+		arg.Name,
+		arg.Type,
+		arg.Geofence,
+		arg.StartedAt,
+		arg.EndedAt,
+		arg.Status,
+		arg.IncidentID,
+	)
+	if err != nil {
+		return incident{}, err
+	}
+
+	res, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[incident])
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return incident{}, errIncidentNotFound
+		}
+
+		return incident{}, err
+	}
+
+	if err := r.linkReportsInArea(ctx, res); err != nil {
+		return incident{}, err
+	}
+
+	return res, nil
+}
+
+// DeleteIncident leaves its reports ungrouped, they aren't deleted.
+func (r *repository) DeleteIncident(ctx context.Context, incidentID string) error {
+	query := `DELETE FROM incidents WHERE incident_id = ($1)`
+
+	tag, err := r.querier.Exec(ctx, query, incidentID)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return errIncidentNotFound
+	}
+
+	return nil
+}
+
+type setReportIncidentRequest struct {
+	DisasterReportID string  `json:"-"`
+	IncidentID       *string `json:"incidentId"` // Nil to ungroup the report
+}
+
+// SetReportIncident moves the report for good, it's never linked automatically
+// again. Clients subscribed to either incident are told.
+func (r *repository) SetReportIncident(
+	ctx context.Context,
+	arg setReportIncidentRequest,
+) (reportIncidentChange, error) {
+	tx, err := r.querier.Begin(ctx)
+	if err != nil {
+		return reportIncidentChange{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	if arg.IncidentID != nil {
+		query := `SELECT EXISTS (SELECT 1 FROM incidents WHERE incident_id = ($1))`
+
+		var exists bool
+
+		row := tx.QueryRow(ctx, query, arg.IncidentID)
+		if err := row.Scan(&exists); err != nil {
+			return reportIncidentChange{}, err
+		}
+
+		if !exists {
+			return reportIncidentChange{}, errIncidentNotFound
+		}
+	}
+
+	query := `SELECT incident_id FROM disaster_reports WHERE disaster_report_id = ($1) FOR UPDATE`
+
+	var previousID *string
+
+	row := tx.QueryRow(ctx, query, arg.DisasterReportID)
+	if err := row.Scan(&previousID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return reportIncidentChange{}, errReportNotFound
+		}
+
+		return reportIncidentChange{}, err
+	}
+
+	query = `
+	UPDATE disaster_reports
+	SET incident_id = ($1), is_incident_set_manually = TRUE, updated_at = NOW()
+	WHERE disaster_report_id = ($2)
+	`
+
+	if _, err := tx.Exec(ctx, query, arg.IncidentID, arg.DisasterReportID); err != nil {
+		return reportIncidentChange{}, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return reportIncidentChange{}, err
+	}
+
+	change := reportIncidentChange{
+		DisasterReportID: arg.DisasterReportID,
+		IncidentID:       arg.IncidentID,
+	}
+
+	if err := r.publish(ctx, arg.IncidentID, reportIncidentChanged, change); err != nil {
+		return reportIncidentChange{}, err
+	}
+
+	if previousID != nil && (arg.IncidentID == nil || *previousID != *arg.IncidentID) {
+		if err := r.publish(ctx, previousID, reportIncidentChanged, change); err != nil {
+			return reportIncidentChange{}, err
+		}
+	}
+
+	return change, nil
+}
+
+// findIncident returns the active incident the location is in, the latest to
+// start if there's more than one.
+func (r *repository) findIncident(ctx context.Context, loc location) (*string, error) {
+	query := `
+	SELECT ` + incidentColumns + `
+	FROM incidents
+	WHERE ` + isIncidentActive + `
+	ORDER BY started_at DESC
+	`
+
+	rows, err := r.querier.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	incidents, err := pgx.CollectRows(rows, pgx.RowToStructByName[incident])
+	if err != nil {
+		return nil, err
+	}
+
+	for _, incident := range incidents {
+		if incident.Geofence.contains(float64(loc.Longitude), float64(loc.Latitude)) {
+			return &incident.IncidentID, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// linkReporter links the reporter's open reports to the incident they're in.
+// Reports already in an incident, or moved by a dispatcher, aren't touched.
+func (r *repository) linkReporter(ctx context.Context, reporterID string, loc location) error {
+	incidentID, err := r.findIncident(ctx, loc)
+	if err != nil || incidentID == nil {
+		return err
+	}
+
+	return r.linkReports(ctx, *incidentID, []string{reporterID})
+}
+
+// linkReportsInArea links the open reports of the reporters last seen inside an
+// active incident's area.
+func (r *repository) linkReportsInArea(ctx context.Context, inc incident) error {
+	now := time.Now()
+	if inc.Status != incidentActive || inc.StartedAt.After(now) ||
+		(inc.EndedAt != nil && !inc.EndedAt.After(now)) {
+		return nil
+	}
+
+	box := boundingBox{
+		MinLongitude: inc.Geofence[0][0],
+		MinLatitude:  inc.Geofence[0][1],
+		MaxLongitude: inc.Geofence[0][0],
+		MaxLatitude:  inc.Geofence[0][1],
+	}
+
+	for _, point := range inc.Geofence {
+		box.MinLongitude = min(box.MinLongitude, point[0])
+		box.MinLatitude = min(box.MinLatitude, point[1])
+		box.MaxLongitude = max(box.MaxLongitude, point[0])
+		box.MaxLatitude = max(box.MaxLatitude, point[1])
+	}
+
+	reporterIDs, err := r.searchReporterLocations(ctx, box)
+	if err != nil {
+		return err
+	}
+
+	locations, err := r.getLocations(ctx, reporterIDs)
+	if err != nil {
+		return err
+	}
+
+	inside := []string{}
+
+	for reporterID, loc := range locations {
+		if inc.Geofence.contains(float64(loc.Longitude), float64(loc.Latitude)) {
+			inside = append(inside, reporterID)
+		}
+	}
+
+	return r.linkReports(ctx, inc.IncidentID, inside)
+}
+
+func (r *repository) linkReports(ctx context.Context, incidentID string, reporterIDs []string) error {
+	if len(reporterIDs) == 0 {
+		return nil
+	}
+
+	query := `
+	UPDATE disaster_reports
+	SET incident_id = ($1), updated_at = NOW()
+	WHERE reporter_id::text = ANY($2)
+		AND incident_id IS NULL
+		AND NOT is_incident_set_manually
+		AND state NOT IN ('resolved', 'cancelled')
+	RETURNING disaster_report_id
+	`
+
+	rows, err := r.querier.Query(ctx, query, incidentID, reporterIDs)
+	if err != nil {
+		return err
+	}
+
+	reportIDs, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return err
+	}
+
+	for _, reportID := range reportIDs {
+		change := reportIncidentChange{DisasterReportID: reportID, IncidentID: &incidentID}
+		if err := r.publish(ctx, &incidentID, reportIncidentChanged, change); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
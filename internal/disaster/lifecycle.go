@@ -0,0 +1,348 @@
+package disaster
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/InternalPointerVariable/ResQLink-Backend/internal/user"
+	"github.com/InternalPointerVariable/ResQLink-Backend/internal/ws"
+	"github.com/jackc/pgx/v5"
+)
+
+// Where a report is in the response, as opposed to `citizenStatus` which is how
+// the citizen says they're doing.
+type reportState string
+
+const (
+	reported     reportState = "reported"
+	assigned     reportState = "assigned"
+	acknowledged reportState = "acknowledged"
+	enRoute      reportState = "en_route"
+	onScene      reportState = "on_scene"
+	rescued      reportState = "rescued"
+	resolved     reportState = "resolved"
+	cancelled    reportState = "cancelled"
+)
+
+// States each state can move to. Resolved and cancelled reports are closed.
+// Reports are assigned through `SetResponder`, not a transition.
+var transitions = map[reportState][]reportState{
+	reported:     {cancelled},
+	assigned:     {acknowledged, cancelled},
+	acknowledged: {enRoute, onScene, cancelled},
+	enRoute:      {onScene, cancelled},
+	onScene:      {rescued, resolved, cancelled},
+	rescued:      {resolved},
+}
+
+func (s reportState) isValid() bool {
+	_, ok := transitions[s]
+	return ok || s == resolved || s == cancelled
+}
+
+func (s reportState) isClosed() bool {
+	return s == resolved || s == cancelled
+}
+
+func (s reportState) canTransitionTo(to reportState) bool {
+	return slices.Contains(transitions[s], to)
+}
+
+var (
+	errInvalidTransition   = errors.New("invalid report state transition")
+	errNotAssignedToCaller = errors.New("report is not assigned to caller")
+)
+
+const reportTransitioned = "disaster:report_transitioned" // Broadcast after every transition
+
+// Who moved the report. Partner agencies act through API keys, and reports'
+// creations by anonymous citizens have no actor.
+type reportActor struct {
+	UserID   *string
+	APIKeyID *string
+	Role     user.Role
+}
+
+func actorFromSession(caller user.SessionValidationResponse) reportActor {
+	if caller.APIKey != nil {
+		return reportActor{APIKeyID: &caller.APIKey.APIKeyID}
+	}
+
+	if caller.IsAnonymous {
+		return reportActor{Role: user.Anonymous}
+	}
+
+	return reportActor{UserID: &caller.User.UserID, Role: caller.Role()}
+}
+
+type reportEvent struct {
+	ReportEventID    string       `json:"id"`
+	CreatedAt        time.Time    `json:"createdAt"`
+	DisasterReportID string       `json:"reportId"`
+	FromState        *reportState `json:"fromState"`
+	ToState          reportState  `json:"toState"`
+	Note             *string      `json:"note"`
+	ActorUserID      *string      `json:"actorUserId"`
+	ActorAPIKeyID    *string      `json:"actorApiKeyId"`
+}
+
+const reportEventColumns = `
+	report_event_id,
+	created_at,
+	disaster_report_id,
+	from_state,
+	to_state,
+	note,
+	actor_user_id,
+	actor_api_key_id
+`
+
+type transitionReportRequest struct {
+	DisasterReportID string      `json:"reportId"`
+	State            reportState `json:"state"`
+	Note             *string     `json:"note"`
+
+	Actor reportActor `json:"-"`
+}
+
+// TransitionReport moves the report to the requested state and broadcasts the
+// event. Responders can only move the reports assigned to them. Reports merged
+// into it follow it, and can't be moved on their own.
+func (r *repository) TransitionReport(
+	ctx context.Context,
+	arg transitionReportRequest,
+) (reportEvent, error) {
+	tx, err := r.querier.Begin(ctx)
+	if err != nil {
+		return reportEvent{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+	SELECT disaster_reports.state, disaster_reports.merged_into_id, responders.user_id
+	FROM disaster_reports
+	LEFT JOIN responders ON responders.responder_id = disaster_reports.responder_id
+	WHERE disaster_reports.disaster_report_id = ($1)
+	FOR UPDATE OF disaster_reports
+	`
+
+	var from reportState
+	var mergedIntoID, responderUserID *string
+
+	row := tx.QueryRow(ctx, query, arg.DisasterReportID)
+	if err := row.Scan(&from, &mergedIntoID, &responderUserID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return reportEvent{}, errReportNotFound
+		}
+
+		return reportEvent{}, err
+	}
+
+	if mergedIntoID != nil {
+		return reportEvent{}, fmt.Errorf("%w: merged into %s", errInvalidTransition, *mergedIntoID)
+	}
+
+	if arg.Actor.Role == user.Responder {
+		if responderUserID == nil || *responderUserID != *arg.Actor.UserID {
+			return reportEvent{}, errNotAssignedToCaller
+		}
+	}
+
+	if !from.canTransitionTo(arg.State) {
+		return reportEvent{}, fmt.Errorf("%w from %s to %s", errInvalidTransition, from, arg.State)
+	}
+
+	query = `
+	UPDATE disaster_reports SET state = ($1), updated_at = NOW()
+	WHERE disaster_report_id = ($2)
+	`
+
+	if _, err := tx.Exec(ctx, query, arg.State, arg.DisasterReportID); err != nil {
+		return reportEvent{}, err
+	}
+
+	event, err := insertReportEvent(
+		ctx,
+		tx,
+		arg.DisasterReportID,
+		&from,
+		arg.State,
+		arg.Note,
+		arg.Actor,
+	)
+	if err != nil {
+		return reportEvent{}, err
+	}
+
+	mergedEvents, err := syncMergedReports(ctx, tx, arg.DisasterReportID, arg.Note, arg.Actor)
+	if err != nil {
+		return reportEvent{}, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return reportEvent{}, err
+	}
+
+	reportIDs := []string{arg.DisasterReportID}
+	for _, mergedEvent := range mergedEvents {
+		reportIDs = append(reportIDs, mergedEvent.DisasterReportID)
+	}
+
+	if err := r.updatePriorities(ctx, reportIDs...); err != nil {
+		return reportEvent{}, err
+	}
+
+	for _, event := range append([]reportEvent{event}, mergedEvents...) {
+		if err := r.broadcast(ctx, event.DisasterReportID, reportTransitioned, event); err != nil {
+			return reportEvent{}, err
+		}
+	}
+
+	return event, nil
+}
+
+// syncMergedReports moves the reports merged into the report to its state, so
+// they're closed along with it. Merged reports closed on their own before the
+// merge are left alone. The report must be locked by `tx`.
+func syncMergedReports(
+	ctx context.Context,
+	tx pgx.Tx,
+	reportID string,
+	note *string,
+	actor reportActor,
+) ([]reportEvent, error) {
+	query := `
+	UPDATE disaster_reports
+	SET state = primary_report.state, updated_at = NOW()
+	FROM
+		disaster_reports AS primary_report,
+		(
+			SELECT disaster_report_id, state
+			FROM disaster_reports
+			WHERE merged_into_id = ($1)
+				AND state NOT IN ('resolved', 'cancelled')
+			FOR UPDATE
+		) AS previous
+	WHERE primary_report.disaster_report_id = ($1)
+		AND disaster_reports.disaster_report_id = previous.disaster_report_id
+		AND previous.state != primary_report.state
+	RETURNING disaster_reports.disaster_report_id, previous.state, disaster_reports.state
+	`
+
+	rows, err := tx.Query(ctx, query, reportID)
+	if err != nil {
+		return nil, err
+	}
+
+	type change struct {
+		DisasterReportID string
+		From             reportState
+		To               reportState
+	}
+
+	changes, err := pgx.CollectRows(rows, pgx.RowToStructByPos[change])
+	if err != nil {
+		return nil, err
+	}
+
+	events := make([]reportEvent, 0, len(changes))
+
+	for _, change := range changes {
+		event, err := insertReportEvent(
+			ctx,
+			tx,
+			change.DisasterReportID,
+			&change.From,
+			change.To,
+			note,
+			actor,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		events = append(events, event)
+	}
+
+	return events, nil
+}
+
+func insertReportEvent(
+	ctx context.Context,
+	tx pgx.Tx,
+	reportID string,
+	from *reportState,
+	to reportState,
+	note *string,
+	actor reportActor,
+) (reportEvent, error) {
+	query := `
+	INSERT INTO report_events (
+		disaster_report_id,
+		from_state,
+		to_state,
+		note,
+		actor_user_id,
+		actor_api_key_id
+	)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	RETURNING ` + reportEventColumns
+
+	rows, err := tx.Query(ctx, query, reportID, from, to, note, actor.UserID, actor.APIKeyID)
+	if err != nil {
+		return reportEvent{}, err
+	}
+
+	return pgx.CollectOneRow(rows, pgx.RowToStructByName[reportEvent])
+}
+
+func (r *repository) listReportEvents(ctx context.Context, reportID string) ([]reportEvent, error) {
+	query := `
+	SELECT ` + reportEventColumns + `
+	FROM report_events
+	WHERE disaster_report_id = ($1)
+	ORDER BY created_at
+	`
+
+	rows, err := r.querier.Query(ctx, query, reportID)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, pgx.RowToStructByName[reportEvent])
+}
+
+// broadcast sends `data` about the report to everyone connected to any hub, see
+// `ws.BroadcastChannel`. Only the clients subscribed to the report's incident,
+// if any, or to no incident get it.
+func (r *repository) broadcast(ctx context.Context, reportID, event string, data any) error {
+	query := `SELECT incident_id FROM disaster_reports WHERE disaster_report_id = ($1)`
+
+	var incidentID *string
+
+	row := r.querier.QueryRow(ctx, query, reportID)
+	if err := row.Scan(&incidentID); err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return err
+	}
+
+	return r.publish(ctx, incidentID, event, data)
+}
+
+// publish is `broadcast` for when the incident is already known.
+func (r *repository) publish(ctx context.Context, incidentID *string, event string, data any) error {
+	byt, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	msg, err := json.Marshal(ws.Message{Event: event, Data: byt, IncidentID: incidentID})
+	if err != nil {
+		return err
+	}
+
+	return r.redisClient.Publish(ctx, ws.BroadcastChannel, msg).Err()
+}
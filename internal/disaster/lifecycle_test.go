@@ -0,0 +1,48 @@
+package disaster
+
+import "testing"
+
+func TestCanTransitionTo(t *testing.T) {
+	tests := []struct {
+		from reportState
+		to   reportState
+		want bool
+	}{
+		{reported, cancelled, true},
+		{reported, acknowledged, false},
+		{reported, assigned, false}, // Only through `SetResponder`
+		{assigned, acknowledged, true},
+		{acknowledged, enRoute, true},
+		{acknowledged, onScene, true},
+		{enRoute, onScene, true},
+		{enRoute, rescued, false},
+		{onScene, rescued, true},
+		{onScene, resolved, true},
+		{rescued, resolved, true},
+		{rescued, cancelled, false},
+		{resolved, reported, false},
+		{cancelled, reported, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.from)+" to "+string(tt.to), func(t *testing.T) {
+			if got := tt.from.canTransitionTo(tt.to); got != tt.want {
+				t.Errorf("canTransitionTo = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReportStateIsValid(t *testing.T) {
+	for _, state := range []reportState{
+		reported, assigned, acknowledged, enRoute, onScene, rescued, resolved, cancelled,
+	} {
+		if !state.isValid() {
+			t.Errorf("%s isn't valid", state)
+		}
+	}
+
+	if reportState("lost").isValid() {
+		t.Error("unknown state is valid")
+	}
+}
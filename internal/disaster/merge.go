@@ -0,0 +1,347 @@
+package disaster
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	reportsMerged = "disaster:reports_merged" // Broadcast after every merge
+	reportsLinked = "disaster:reports_linked" // Broadcast after every link
+)
+
+var (
+	errInvalidMerge          = errors.New("invalid report merge")
+	errConflictingResponders = errors.New("reports have different responders")
+	errInvalidLink           = errors.New("invalid report link")
+	errLinkNotFound          = errors.New("report link not found")
+)
+
+type mergeReportsRequest struct {
+	DisasterReportID string   `json:"-"`         // The report the others are merged into
+	ReportIDs        []string `json:"reportIds"` // Duplicates of the report
+
+	Actor reportActor `json:"-"`
+}
+
+type reportsMerge struct {
+	DisasterReportID string     `json:"reportId"`
+	ReportIDs        []string   `json:"reportIds"`
+	Responder        *responder `json:"responder"`
+}
+
+// MergeReports makes the duplicates point to the report, whose responder they
+// all share, see `SetResponder`, and whose state they follow from then on. When
+// only a duplicate has a responder, the report is given it, but reports with
+// different responders can't be merged. Reports merged into a duplicate move
+// along with it.
+func (r *repository) MergeReports(
+	ctx context.Context,
+	arg mergeReportsRequest,
+) (reportsMerge, error) {
+	if len(arg.ReportIDs) == 0 || slices.Contains(arg.ReportIDs, arg.DisasterReportID) {
+		return reportsMerge{}, errInvalidMerge
+	}
+
+	tx, err := r.querier.Begin(ctx)
+	if err != nil {
+		return reportsMerge{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+	SELECT merged_into_id, responder_id
+	FROM disaster_reports
+	WHERE disaster_report_id = ($1)
+	FOR UPDATE
+	`
+
+	var mergedIntoID, responderID *string
+
+	row := tx.QueryRow(ctx, query, arg.DisasterReportID)
+	if err := row.Scan(&mergedIntoID, &responderID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return reportsMerge{}, errReportNotFound
+		}
+
+		return reportsMerge{}, err
+	}
+
+	// Merges are one level deep, the report must be a primary itself
+	if mergedIntoID != nil {
+		return reportsMerge{}, errInvalidMerge
+	}
+
+	query = `
+	SELECT disaster_report_id, responder_id
+	FROM disaster_reports
+	WHERE disaster_report_id::text = ANY($1)
+	ORDER BY created_at
+	FOR UPDATE
+	`
+
+	rows, err := tx.Query(ctx, query, arg.ReportIDs)
+	if err != nil {
+		return reportsMerge{}, err
+	}
+
+	type duplicate struct {
+		DisasterReportID string
+		ResponderID      *string
+	}
+
+	duplicates, err := pgx.CollectRows(rows, pgx.RowToStructByName[duplicate])
+	if err != nil {
+		return reportsMerge{}, err
+	}
+
+	if len(duplicates) != len(slices.Compact(slices.Sorted(slices.Values(arg.ReportIDs)))) {
+		return reportsMerge{}, errReportNotFound
+	}
+
+	for _, duplicate := range duplicates {
+		if duplicate.ResponderID == nil {
+			continue
+		}
+
+		if responderID != nil && *responderID != *duplicate.ResponderID {
+			return reportsMerge{}, errConflictingResponders
+		}
+
+		responderID = duplicate.ResponderID
+	}
+
+	query = `
+	UPDATE disaster_reports
+	SET merged_into_id = ($1), updated_at = NOW()
+	WHERE disaster_report_id::text = ANY($2) OR merged_into_id::text = ANY($2)
+	RETURNING disaster_report_id
+	`
+
+	rows, err = tx.Query(ctx, query, arg.DisasterReportID, arg.ReportIDs)
+	if err != nil {
+		return reportsMerge{}, err
+	}
+
+	mergedIDs, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return reportsMerge{}, err
+	}
+
+	var events []reportEvent
+
+	if responderID != nil {
+		_, events, err = assignReports(
+			ctx,
+			tx,
+			*responderID,
+			append([]string{arg.DisasterReportID}, mergedIDs...),
+			arg.Actor,
+		)
+		if err != nil {
+			return reportsMerge{}, err
+		}
+	}
+
+	mergedEvents, err := syncMergedReports(ctx, tx, arg.DisasterReportID, nil, arg.Actor)
+	if err != nil {
+		return reportsMerge{}, err
+	}
+
+	events = append(events, mergedEvents...)
+
+	res := reportsMerge{DisasterReportID: arg.DisasterReportID, ReportIDs: mergedIDs}
+
+	if responderID != nil {
+		query = `SELECT responder_id, created_at, name FROM responders WHERE responder_id = ($1)`
+
+		var resp responder
+
+		row := tx.QueryRow(ctx, query, responderID)
+		if err := row.Scan(&resp.ResponderID, &resp.CreatedAt, &resp.Name); err != nil {
+			return reportsMerge{}, err
+		}
+
+		res.Responder = &resp
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return reportsMerge{}, err
+	}
+
+	if err := r.updatePriorities(ctx, append([]string{arg.DisasterReportID}, mergedIDs...)...); err != nil {
+		return reportsMerge{}, err
+	}
+
+	for _, event := range events {
+		if err := r.broadcast(ctx, event.DisasterReportID, reportTransitioned, event); err != nil {
+			return reportsMerge{}, err
+		}
+	}
+
+	if err := r.broadcast(ctx, arg.DisasterReportID, reportsMerged, res); err != nil {
+		return reportsMerge{}, err
+	}
+
+	return res, nil
+}
+
+// assignReports gives the open reports without a responder the responder, and
+// moves the ones still reported to assigned. It returns the IDs of the reports
+// given the responder. The reports must be locked by `tx`.
+func assignReports(
+	ctx context.Context,
+	tx pgx.Tx,
+	responderID string,
+	reportIDs []string,
+	actor reportActor,
+) ([]string, []reportEvent, error) {
+	// Closed reports are left alone, a responder on them would still be given
+	// access to the reporter, e.g. to their medical profile
+	query := `
+	UPDATE disaster_reports
+	SET
+		responder_id = ($1),
+		state = CASE WHEN state = 'reported' THEN 'assigned' ELSE state END,
+		updated_at = NOW()
+	WHERE disaster_report_id::text = ANY($2)
+		AND responder_id IS NULL
+		AND state NOT IN ('resolved', 'cancelled')
+	RETURNING disaster_report_id, state
+	`
+
+	rows, err := tx.Query(ctx, query, responderID, reportIDs)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	type assignedReport struct {
+		DisasterReportID string
+		State            reportState
+	}
+
+	updated, err := pgx.CollectRows(rows, pgx.RowToStructByName[assignedReport])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	updatedIDs := make([]string, len(updated))
+	var events []reportEvent
+
+	for i, report := range updated {
+		updatedIDs[i] = report.DisasterReportID
+
+		if report.State != assigned {
+			continue
+		}
+
+		from := reported
+		event, err := insertReportEvent(ctx, tx, report.DisasterReportID, &from, assigned, nil, actor)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		events = append(events, event)
+	}
+
+	return updatedIDs, events, nil
+}
+
+type linkReportsRequest struct {
+	DisasterReportID string `json:"-"`
+	LinkedReportID   string `json:"reportId"`
+
+	Actor reportActor `json:"-"`
+}
+
+type reportLink struct {
+	ReportLinkID     string    `json:"id"`
+	CreatedAt        time.Time `json:"createdAt"`
+	DisasterReportID string    `json:"reportId"`
+	LinkedReportID   string    `json:"linkedReportId"`
+	ActorUserID      *string   `json:"actorUserId"`
+}
+
+const reportLinkColumns = `
+	report_link_id,
+	created_at,
+	disaster_report_id,
+	linked_report_id,
+	actor_user_id
+`
+
+// LinkReports relates two reports about the same emergency that are kept apart,
+// unlike merged ones. Linking them again does nothing.
+func (r *repository) LinkReports(ctx context.Context, arg linkReportsRequest) (reportLink, error) {
+	if arg.LinkedReportID == "" || arg.LinkedReportID == arg.DisasterReportID {
+		return reportLink{}, errInvalidLink
+	}
+
+	// Each pair is stored once, lowest ID first
+	first, second := strings.ToLower(arg.DisasterReportID), strings.ToLower(arg.LinkedReportID)
+	if second < first {
+		first, second = second, first
+	}
+
+	query := `
+	SELECT COUNT(*) FROM disaster_reports WHERE disaster_report_id::text = ANY($1)
+	`
+
+	var count int
+
+	row := r.querier.QueryRow(ctx, query, []string{first, second})
+	if err := row.Scan(&count); err != nil {
+		return reportLink{}, err
+	}
+
+	if count != 2 {
+		return reportLink{}, errReportNotFound
+	}
+
+	query = `
+	INSERT INTO report_links (disaster_report_id, linked_report_id, actor_user_id)
+	VALUES ($1, $2, $3)
+	ON CONFLICT (disaster_report_id, linked_report_id) DO UPDATE
+		SET disaster_report_id = EXCLUDED.disaster_report_id
+	RETURNING ` + reportLinkColumns
+
+	rows, err := r.querier.Query(ctx, query, first, second, arg.Actor.UserID)
+	if err != nil {
+		return reportLink{}, err
+	}
+
+	link, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[reportLink])
+	if err != nil {
+		return reportLink{}, err
+	}
+
+	if err := r.broadcast(ctx, arg.DisasterReportID, reportsLinked, link); err != nil {
+		return reportLink{}, err
+	}
+
+	return link, nil
+}
+
+func (r *repository) UnlinkReports(ctx context.Context, reportID, linkedReportID string) error {
+	query := `
+	DELETE FROM report_links
+	WHERE (disaster_report_id = ($1) AND linked_report_id = ($2))
+		OR (disaster_report_id = ($2) AND linked_report_id = ($1))
+	`
+
+	tag, err := r.querier.Exec(ctx, query, reportID, linkedReportID)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return errLinkNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,364 @@
+package disaster
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/InternalPointerVariable/ResQLink-Backend/internal/ws"
+	"github.com/jackc/pgx/v5"
+)
+
+// Messages between a report's reporter and its assigned responder, for when
+// calls don't go through. They're only sent to the two of them.
+const (
+	sendMessage  = "disaster:send_message"
+	markMessages = "disaster:mark_messages"
+
+	defaultMessagesLimit = 50
+	maxMessagesLimit     = 200
+	maxMessageLength     = 2000
+)
+
+type senderRole string
+
+const (
+	reporterSender  senderRole = "reporter"
+	responderSender senderRole = "responder"
+)
+
+type receiptType string
+
+const (
+	delivered receiptType = "delivered"
+	read      receiptType = "read"
+)
+
+var (
+	errNotParticipant = errors.New("caller is not a participant of the report")
+	errInvalidMessage = errors.New("invalid message")
+	errInvalidReceipt = errors.New("invalid message receipt")
+)
+
+type reportMessage struct {
+	ReportMessageID  string     `json:"id"`
+	CreatedAt        time.Time  `json:"createdAt"`
+	DisasterReportID string     `json:"reportId"`
+	SenderRole       senderRole `json:"senderRole"`
+	Body             string     `json:"body"`
+	DeliveredAt      *time.Time `json:"deliveredAt"`
+	ReadAt           *time.Time `json:"readAt"`
+}
+
+const reportMessageColumns = `
+	report_message_id,
+	created_at,
+	disaster_report_id,
+	sender_role,
+	body,
+	delivered_at,
+	read_at
+`
+
+// IDs the reporter and responder are connected with. Anonymous reporters are
+// connected with their anonymous ID.
+type reportParticipants struct {
+	ReporterID          string
+	IsReporterAnonymous bool
+	ResponderID         *string
+}
+
+// An anonymous caller can only be the reporter, and only of a report filed
+// anonymously, whatever their ID looks like.
+func (p reportParticipants) roleOf(caller reporterIdentity) (senderRole, error) {
+	reporterID := caller.UserID
+	if p.IsReporterAnonymous {
+		reporterID = caller.AnonymousID
+	}
+
+	if reporterID != nil && *reporterID == p.ReporterID {
+		return reporterSender, nil
+	}
+
+	if p.ResponderID != nil && caller.UserID != nil && *caller.UserID == *p.ResponderID {
+		return responderSender, nil
+	}
+
+	return "", errNotParticipant
+}
+
+func (p reportParticipants) recipients() (userIDs, anonymousIDs []string) {
+	if p.IsReporterAnonymous {
+		anonymousIDs = append(anonymousIDs, p.ReporterID)
+	} else {
+		userIDs = append(userIDs, p.ReporterID)
+	}
+
+	if p.ResponderID != nil {
+		userIDs = append(userIDs, *p.ResponderID)
+	}
+
+	return userIDs, anonymousIDs
+}
+
+func (r *repository) getReportParticipants(
+	ctx context.Context,
+	reportID string,
+) (reportParticipants, error) {
+	query := `
+	SELECT
+		COALESCE(reporters.user_id::text, reporters.anonymous_id),
+		reporters.user_id IS NULL,
+		responders.user_id::text
+	FROM disaster_reports
+	JOIN reporters ON reporters.reporter_id = disaster_reports.reporter_id
+	LEFT JOIN responders ON responders.responder_id = disaster_reports.responder_id
+	WHERE disaster_reports.disaster_report_id = ($1)
+	`
+
+	var res reportParticipants
+
+	row := r.querier.QueryRow(ctx, query, reportID)
+	if err := row.Scan(&res.ReporterID, &res.IsReporterAnonymous, &res.ResponderID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return reportParticipants{}, errReportNotFound
+		}
+
+		return reportParticipants{}, err
+	}
+
+	return res, nil
+}
+
+type sendMessageRequest struct {
+	DisasterReportID string `json:"reportId"`
+	Body             string `json:"body"`
+}
+
+// SendMessage stores the message and sends it to both participants, so the
+// sender's other devices get it too.
+func (r *repository) SendMessage(
+	ctx context.Context,
+	arg sendMessageRequest,
+	caller reporterIdentity,
+) (reportMessage, error) {
+	arg.Body = strings.TrimSpace(arg.Body)
+	if arg.Body == "" || len(arg.Body) > maxMessageLength {
+		return reportMessage{}, errInvalidMessage
+	}
+
+	participants, err := r.getReportParticipants(ctx, arg.DisasterReportID)
+	if err != nil {
+		return reportMessage{}, err
+	}
+
+	role, err := participants.roleOf(caller)
+	if err != nil {
+		return reportMessage{}, err
+	}
+
+	// Anonymous IDs aren't users, so anonymous reporters are left without one
+	senderUserID := caller.UserID
+
+	query := `
+	INSERT INTO report_messages (disaster_report_id, sender_role, sender_user_id, body)
+	VALUES ($1, $2, $3, $4)
+	RETURNING ` + reportMessageColumns
+
+	rows, err := r.querier.Query(ctx, query, arg.DisasterReportID, role, senderUserID, arg.Body)
+	if err != nil {
+		return reportMessage{}, err
+	}
+
+	msg, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[reportMessage])
+	if err != nil {
+		return reportMessage{}, err
+	}
+
+	if err := r.sendDirect(ctx, participants, sendMessage, msg); err != nil {
+		return reportMessage{}, err
+	}
+
+	return msg, nil
+}
+
+type messagesPage struct {
+	Messages   []reportMessage
+	NextCursor *string
+}
+
+// ListMessages returns the thread newest first. `before` is the ID of the
+// oldest message already fetched.
+func (r *repository) ListMessages(
+	ctx context.Context,
+	reportID string,
+	caller reporterIdentity,
+	before *string,
+	limit int,
+) (messagesPage, error) {
+	participants, err := r.getReportParticipants(ctx, reportID)
+	if err != nil {
+		return messagesPage{}, err
+	}
+
+	if _, err := participants.roleOf(caller); err != nil {
+		return messagesPage{}, err
+	}
+
+	query := `
+	SELECT ` + reportMessageColumns + `
+	FROM report_messages
+	WHERE disaster_report_id = ($1)
+		AND (
+			($2)::uuid IS NULL
+			OR (created_at, report_message_id) < (
+				SELECT created_at, report_message_id
+				FROM report_messages
+				WHERE report_message_id = ($2)
+			)
+		)
+	ORDER BY created_at DESC, report_message_id DESC
+	LIMIT ($3)
+	`
+
+	rows, err := r.querier.Query(ctx, query, reportID, before, limit+1)
+	if err != nil {
+		return messagesPage{}, err
+	}
+
+	messages, err := pgx.CollectRows(rows, pgx.RowToStructByName[reportMessage])
+	if err != nil {
+		return messagesPage{}, err
+	}
+
+	var page messagesPage
+
+	if len(messages) > limit {
+		messages = messages[:limit]
+		page.NextCursor = &messages[len(messages)-1].ReportMessageID
+	}
+
+	page.Messages = messages
+
+	return page, nil
+}
+
+// Marks every message the other participant sent up to `MessageID`
+type markMessagesRequest struct {
+	DisasterReportID string      `json:"reportId"`
+	MessageID        string      `json:"messageId"`
+	Receipt          receiptType `json:"receipt"`
+}
+
+type messageReceipt struct {
+	DisasterReportID string      `json:"reportId"`
+	MessageIDs       []string    `json:"messageIds"`
+	Receipt          receiptType `json:"receipt"`
+	At               time.Time   `json:"at"`
+}
+
+// MarkMessages records the receipt and sends it to both participants. Reading
+// a message also delivers it.
+func (r *repository) MarkMessages(
+	ctx context.Context,
+	arg markMessagesRequest,
+	caller reporterIdentity,
+) (messageReceipt, error) {
+	if arg.Receipt != delivered && arg.Receipt != read {
+		return messageReceipt{}, errInvalidReceipt
+	}
+
+	participants, err := r.getReportParticipants(ctx, arg.DisasterReportID)
+	if err != nil {
+		return messageReceipt{}, err
+	}
+
+	role, err := participants.roleOf(caller)
+	if err != nil {
+		return messageReceipt{}, err
+	}
+
+	column := "delivered_at"
+	if arg.Receipt == read {
+		column = "read_at"
+	}
+
+	query := `
+	UPDATE report_messages
+	SET
+		delivered_at = COALESCE(delivered_at, NOW()),
+		read_at = CASE WHEN ($4) THEN COALESCE(read_at, NOW()) ELSE read_at END
+	WHERE disaster_report_id = ($1)
+		AND sender_role != ($2)
+		AND ` + column + ` IS NULL
+		AND (created_at, report_message_id) <= (
+			SELECT created_at, report_message_id
+			FROM report_messages
+			WHERE report_message_id = ($3) AND disaster_report_id = ($1)
+		)
+	RETURNING report_message_id
+	`
+
+	rows, err := r.querier.Query(
+		ctx,
+		query,
+		arg.DisasterReportID,
+		role,
+		arg.MessageID,
+		arg.Receipt == read,
+	)
+	if err != nil {
+		return messageReceipt{}, err
+	}
+
+	messageIDs, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return messageReceipt{}, err
+	}
+
+	receipt := messageReceipt{
+		DisasterReportID: arg.DisasterReportID,
+		MessageIDs:       messageIDs,
+		Receipt:          arg.Receipt,
+		At:               time.Now(),
+	}
+
+	if len(messageIDs) == 0 {
+		return receipt, nil
+	}
+
+	if err := r.sendDirect(ctx, participants, markMessages, receipt); err != nil {
+		return messageReceipt{}, err
+	}
+
+	return receipt, nil
+}
+
+// sendDirect sends `data` to the users wherever they're connected, see
+// `ws.DirectChannel`.
+func (r *repository) sendDirect(
+	ctx context.Context,
+	participants reportParticipants,
+	event string,
+	data any,
+) error {
+	byt, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	userIDs, anonymousIDs := participants.recipients()
+
+	msg, err := json.Marshal(ws.DirectMessage{
+		UserIDs:      userIDs,
+		AnonymousIDs: anonymousIDs,
+		Message:      ws.Message{Event: event, Data: byt},
+	})
+	if err != nil {
+		return err
+	}
+
+	return r.redisClient.Publish(ctx, ws.DirectChannel, msg).Err()
+}
@@ -0,0 +1,282 @@
+package disaster
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/InternalPointerVariable/ResQLink-Backend/internal/situation"
+	"github.com/jackc/pgx/v5"
+)
+
+// PriorityWeights are the points each rule adds to a report's priority, higher
+// is more urgent. Time based rules add points for every minute, up to a max.
+// They're added when reading, see `priorityExpression`, while the others are
+// stored as the report's base priority.
+type PriorityWeights struct {
+	Status map[citizenStatus]float64 `json:"status"`
+
+	// Since the citizen was last heard from, through the report or a follow-up
+	PerMinuteSinceUpdate float64 `json:"perMinuteSinceUpdate"`
+	MaxSinceUpdate       float64 `json:"maxSinceUpdate"`
+
+	// Since the report was created, until a responder is assigned
+	PerMinuteUnassigned float64 `json:"perMinuteUnassigned"`
+	MaxUnassigned       float64 `json:"maxUnassigned"`
+
+	// For everyone but the reporter
+	PerExtraPerson float64 `json:"perExtraPerson"`
+	MaxPeople      float64 `json:"maxPeople"`
+
+	// For each kind of vulnerable person, injury or hazard mentioned
+	Vulnerable float64 `json:"vulnerable"`
+	Injury     float64 `json:"injury"`
+	Hazard     float64 `json:"hazard"`
+
+	// When the reporter's last location is inside any hazard zone
+	HazardZone float64 `json:"hazardZone"`
+}
+
+func DefaultPriorityWeights() PriorityWeights {
+	return PriorityWeights{
+		Status: map[citizenStatus]float64{
+			safe:     0,
+			atRisk:   30,
+			inDanger: 60,
+		},
+		PerMinuteSinceUpdate: 0.5,
+		MaxSinceUpdate:       20,
+		PerMinuteUnassigned:  0.5,
+		MaxUnassigned:        30,
+		PerExtraPerson:       2,
+		MaxPeople:            20,
+		Vulnerable:           10,
+		Injury:               10,
+		Hazard:               5,
+		HazardZone:           15,
+	}
+}
+
+// LoadPriorityWeights reads the weights to change from a JSON file, the others
+// keep their default.
+func LoadPriorityWeights(path string) (PriorityWeights, error) {
+	byt, err := os.ReadFile(path)
+	if err != nil {
+		return PriorityWeights{}, err
+	}
+
+	weights := DefaultPriorityWeights()
+
+	if err := json.Unmarshal(byt, &weights); err != nil {
+		return PriorityWeights{}, err
+	}
+
+	for status := range weights.Status {
+		if status.severity() == 0 {
+			return PriorityWeights{}, fmt.Errorf("priority weights: unknown status %q", status)
+		}
+	}
+
+	return weights, nil
+}
+
+// What a report's priority is computed from
+type priorityInput struct {
+	DisasterReportID string
+	CreatedAt        time.Time
+	Status           citizenStatus
+	State            reportState
+	ReporterID       string
+	ResponderID      *string
+	LastHeardAt      time.Time
+	AISummary        *situation.Summary
+	RawSituation     string
+	Updates          []string
+}
+
+// summary falls back to keywords until the report is summarized.
+func (i priorityInput) summary() situation.Summary {
+	if i.AISummary != nil {
+		return *i.AISummary
+	}
+
+	summary, _ := situation.Stub{}.Summarize(context.Background(), situation.Report{
+		Status:       string(i.Status),
+		RawSituation: i.RawSituation,
+		Updates:      i.Updates,
+	})
+
+	return summary
+}
+
+// baseScore leaves out the time based rules. Closed reports have nothing left
+// to prioritize.
+func (w PriorityWeights) baseScore(input priorityInput, isInHazardZone bool) float64 {
+	if input.State.isClosed() {
+		return 0
+	}
+
+	score := w.Status[input.Status]
+
+	summary := input.summary()
+
+	score += min(float64(max(summary.PeopleCount-1, 0))*w.PerExtraPerson, w.MaxPeople)
+	score += float64(len(summary.Vulnerable)) * w.Vulnerable
+	score += float64(len(summary.Injuries)) * w.Injury
+	score += float64(len(summary.Hazards)) * w.Hazard
+
+	if isInHazardZone {
+		score += w.HazardZone
+	}
+
+	return math.Round(score*100) / 100
+}
+
+// priorityExpression is the SQL for the priority of a `disaster_reports` row as
+// of `asOf`, a timestamptz. It adds the time based rules to the base priority,
+// so the priority never has to be refreshed as time passes, and a list ranked
+// as of one time keeps its order across pages.
+func (w PriorityWeights) priorityExpression(asOf string) string {
+	return fmt.Sprintf(`
+	CASE WHEN disaster_reports.state IN ('resolved', 'cancelled') THEN 0
+	ELSE round((
+		disaster_reports.base_priority
+		+ least(
+			greatest(extract(epoch FROM %[1]s - disaster_reports.last_heard_at), 0) / 60 * %[2]s,
+			%[3]s
+		)
+		+ CASE WHEN disaster_reports.responder_id IS NULL THEN least(
+			greatest(extract(epoch FROM %[1]s - disaster_reports.created_at), 0) / 60 * %[4]s,
+			%[5]s
+		) ELSE 0 END
+	)::numeric, 2)::double precision
+	END`,
+		asOf,
+		sqlFloat(w.PerMinuteSinceUpdate),
+		sqlFloat(w.MaxSinceUpdate),
+		sqlFloat(w.PerMinuteUnassigned),
+		sqlFloat(w.MaxUnassigned),
+	)
+}
+
+func sqlFloat(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+// updatePriorities recomputes the reports' base priority. It's called after
+// every change to them.
+func (r *repository) updatePriorities(ctx context.Context, reportIDs ...string) error {
+	if len(reportIDs) == 0 {
+		return nil
+	}
+
+	return r.reprioritize(ctx, "disaster_reports.disaster_report_id::text = ANY($1)", reportIDs)
+}
+
+// refreshPriorities recomputes every open report's base priority, for changes
+// outside of reports like hazard zones.
+func (r *repository) refreshPriorities(ctx context.Context) error {
+	return r.reprioritize(ctx, "disaster_reports.state NOT IN ('resolved', 'cancelled')")
+}
+
+func (r *repository) reprioritize(ctx context.Context, where string, args ...any) error {
+	query := `
+	SELECT
+		disaster_reports.disaster_report_id,
+		disaster_reports.created_at,
+		disaster_reports.status,
+		disaster_reports.state,
+		disaster_reports.reporter_id,
+		disaster_reports.responder_id,
+		COALESCE(
+			(
+				SELECT MAX(created_at)
+				FROM report_updates
+				WHERE report_updates.disaster_report_id = disaster_reports.disaster_report_id
+			),
+			disaster_reports.created_at
+		) AS last_heard_at,
+		disaster_reports.ai_summary,
+		disaster_reports.raw_situation,
+		COALESCE(
+			(
+				SELECT array_agg(raw_situation ORDER BY created_at)
+				FROM report_updates
+				WHERE report_updates.disaster_report_id = disaster_reports.disaster_report_id
+					AND raw_situation IS NOT NULL
+			),
+			'{}'
+		) AS updates
+	FROM disaster_reports
+	WHERE ` + where
+
+	rows, err := r.querier.Query(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	inputs, err := pgx.CollectRows(rows, pgx.RowToStructByName[priorityInput])
+	if err != nil {
+		return err
+	}
+
+	if len(inputs) == 0 {
+		return nil
+	}
+
+	zones, err := r.ListHazardZones(ctx)
+	if err != nil {
+		return err
+	}
+
+	var locations map[string]*location
+
+	if len(zones) > 0 {
+		reporterIDs := make([]string, len(inputs))
+		for i, input := range inputs {
+			reporterIDs[i] = input.ReporterID
+		}
+
+		locations, err = r.getLocations(ctx, reporterIDs)
+		if err != nil {
+			return err
+		}
+	}
+
+	reportIDs := make([]string, len(inputs))
+	priorities := make([]float64, len(inputs))
+	lastHeardAts := make([]time.Time, len(inputs))
+
+	for i, input := range inputs {
+		isInHazardZone := false
+
+		if location := locations[input.ReporterID]; location != nil {
+			for _, zone := range zones {
+				if zone.Polygon.contains(float64(location.Longitude), float64(location.Latitude)) {
+					isInHazardZone = true
+					break
+				}
+			}
+		}
+
+		reportIDs[i] = input.DisasterReportID
+		priorities[i] = r.priorityWeights.baseScore(input, isInHazardZone)
+		lastHeardAts[i] = input.LastHeardAt
+	}
+
+	query = `
+	UPDATE disaster_reports
+	SET base_priority = computed.base_priority, last_heard_at = computed.last_heard_at
+	FROM unnest(($1)::uuid[], ($2)::double precision[], ($3)::timestamptz[])
+		AS computed(disaster_report_id, base_priority, last_heard_at)
+	WHERE disaster_reports.disaster_report_id = computed.disaster_report_id
+	`
+
+	_, err = r.querier.Exec(ctx, query, reportIDs, priorities, lastHeardAts)
+
+	return err
+}
@@ -0,0 +1,210 @@
+package disaster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+type personalDataExport struct {
+	// Reports filed by the user, along with their last known location
+	Reporter *reportsByReporterResponse `json:"reporter"`
+	// Reports the user was assigned to as a responder
+	RespondedReports []respondedReport `json:"respondedReports"`
+	// Messages the user sent in reports' threads
+	Messages []reportMessage `json:"messages"`
+	// Photos the user uploaded, attached to a report or not
+	Uploads []exportedUpload `json:"uploads"`
+}
+
+type exportedUpload struct {
+	UploadKey string    `json:"key"`
+	CreatedAt time.Time `json:"createdAt"`
+	PhotoURL  string    `json:"url"`
+}
+
+type respondedReport struct {
+	DisasterReportID string        `json:"id"`
+	CreatedAt        time.Time     `json:"createdAt"`
+	Status           citizenStatus `json:"status"`
+	ReporterID       string        `json:"reporterId"`
+}
+
+// ExportPersonalData is used by `user.Server` for data privacy requests.
+func (r *repository) ExportPersonalData(ctx context.Context, userID string) (any, error) {
+	var export personalDataExport
+
+	query := `SELECT reporter_id FROM reporters WHERE user_id = ($1)`
+
+	var reporterID string
+
+	row := r.querier.QueryRow(ctx, query, userID)
+	if err := row.Scan(&reporterID); err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, err
+	}
+
+	if reporterID != "" {
+		reports, err := r.ListDisasterReportsByReporter(ctx, reporterID)
+		if err != nil && !errors.Is(err, errReporterNotFound) {
+			return nil, err
+		}
+
+		if err == nil {
+			export.Reporter = &reports
+		}
+	}
+
+	query = `
+	SELECT 
+		disaster_reports.disaster_report_id,
+		disaster_reports.created_at,
+		disaster_reports.status,
+		disaster_reports.reporter_id
+	FROM disaster_reports
+	JOIN responders ON responders.responder_id = disaster_reports.responder_id
+	WHERE responders.user_id = ($1)
+	ORDER BY disaster_reports.created_at DESC
+	`
+
+	rows, err := r.querier.Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	export.RespondedReports, err = pgx.CollectRows(rows, pgx.RowToStructByName[respondedReport])
+	if err != nil {
+		return nil, err
+	}
+
+	query = `
+	SELECT ` + reportMessageColumns + `
+	FROM report_messages
+	WHERE sender_user_id = ($1)
+	ORDER BY created_at DESC
+	`
+
+	rows, err = r.querier.Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	export.Messages, err = pgx.CollectRows(rows, pgx.RowToStructByName[reportMessage])
+	if err != nil {
+		return nil, err
+	}
+
+	query = `
+	SELECT upload_key, created_at, photo_url
+	FROM uploads
+	WHERE user_id = ($1)
+	ORDER BY created_at DESC
+	`
+
+	rows, err = r.querier.Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	export.Uploads, err = pgx.CollectRows(rows, pgx.RowToStructByName[exportedUpload])
+	if err != nil {
+		return nil, err
+	}
+
+	return export, nil
+}
+
+// ErasePersonalData deletes everything the user reported and uploaded. Reports
+// the user responded to belong to other citizens, so the responder is only
+// anonymized.
+func (r *repository) ErasePersonalData(ctx context.Context, userID string) error {
+	query := `SELECT upload_key FROM uploads WHERE user_id = ($1)`
+
+	rows, err := r.querier.Query(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+
+	uploadKeys, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return err
+	}
+
+	tx, err := r.querier.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	query = `
+	DELETE FROM disaster_photos
+	USING disaster_reports, reporters
+	WHERE disaster_photos.disaster_report_id = disaster_reports.disaster_report_id
+		AND disaster_reports.reporter_id = reporters.reporter_id
+		AND reporters.user_id = ($1)
+	`
+
+	if _, err := tx.Exec(ctx, query, userID); err != nil {
+		return err
+	}
+
+	query = `
+	DELETE FROM disaster_reports
+	USING reporters
+	WHERE disaster_reports.reporter_id = reporters.reporter_id
+		AND reporters.user_id = ($1)
+	`
+
+	if _, err := tx.Exec(ctx, query, userID); err != nil {
+		return err
+	}
+
+	query = `DELETE FROM uploads WHERE user_id = ($1)`
+
+	if _, err := tx.Exec(ctx, query, userID); err != nil {
+		return err
+	}
+
+	query = `DELETE FROM reporters WHERE user_id = ($1) RETURNING reporter_id`
+
+	var reporterID string
+
+	row := tx.QueryRow(ctx, query, userID)
+	if err := row.Scan(&reporterID); err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return err
+	}
+
+	query = `
+	UPDATE responders SET user_id = NULL, name = 'Deleted responder'
+	WHERE user_id = ($1)
+	`
+
+	if _, err := tx.Exec(ctx, query, userID); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+
+	// Files can't be deleted in the transaction, so they go once the rows are
+	for _, key := range uploadKeys {
+		if err := r.storage.Delete(ctx, key); err != nil {
+			return fmt.Errorf("delete upload %s: %w", key, err)
+		}
+	}
+
+	if reporterID == "" {
+		return nil
+	}
+
+	pipe := r.redisClient.TxPipeline()
+	pipe.Del(ctx, fmt.Sprintf(locationFmt, reporterID))
+	pipe.ZRem(ctx, reporterLocationsKey, reporterID)
+
+	_, err = pipe.Exec(ctx)
+
+	return err
+}
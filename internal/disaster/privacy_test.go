@@ -0,0 +1,105 @@
+package disaster
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/InternalPointerVariable/ResQLink-Backend/internal/storage"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Needs a migrated database, the one from `DATABASE_URL` is used. The user it
+// creates is erased by the test itself.
+func TestPersonalDataUploads(t *testing.T) {
+	databaseURL := os.Getenv("DATABASE_URL")
+	if databaseURL == "" {
+		t.Skip("DATABASE_URL is not set")
+	}
+
+	ctx := context.Background()
+
+	pool, err := pgxpool.New(ctx, databaseURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	query := `
+	INSERT INTO users (
+		email,
+		password_hash,
+		first_name,
+		last_name,
+		birth_date,
+		role,
+		status_update_frequency,
+		is_location_shared
+	)
+	VALUES (
+		'privacy-test-' || gen_random_uuid() || '@example.com',
+		'',
+		'Juan',
+		'Dela Cruz',
+		'1990-01-01',
+		'citizen',
+		'5 minutes',
+		TRUE
+	)
+	RETURNING user_id
+	`
+
+	var userID string
+	if err := pool.QueryRow(ctx, query).Scan(&userID); err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Exec(ctx, `DELETE FROM users WHERE user_id = ($1)`, userID)
+
+	photos := storage.NewLocal(t.TempDir())
+
+	const key = "privacy-test.jpg"
+	const url = "http://localhost:3002/api/photos/" + key
+
+	if err := photos.Put(ctx, key, "image/jpeg", strings.NewReader("photo"), 5); err != nil {
+		t.Fatal(err)
+	}
+
+	query = `INSERT INTO uploads (upload_key, photo_url, user_id) VALUES ($1, $2, $3)`
+
+	if _, err := pool.Exec(ctx, query, key, url, userID); err != nil {
+		t.Fatal(err)
+	}
+
+	r := &repository{querier: pool, storage: photos}
+
+	exported, err := r.ExportPersonalData(ctx, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	uploads := exported.(personalDataExport).Uploads
+	if len(uploads) != 1 || uploads[0].UploadKey != key || uploads[0].PhotoURL != url {
+		t.Errorf("exported uploads = %+v, want only %s at %s", uploads, key, url)
+	}
+
+	if err := r.ErasePersonalData(ctx, userID); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := photos.Get(ctx, key); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("Get() after erasure: err = %v, want %v", err, storage.ErrNotFound)
+	}
+
+	var count int
+
+	query = `SELECT count(*) FROM uploads WHERE user_id = ($1)`
+	if err := pool.QueryRow(ctx, query, userID).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+
+	if count != 0 {
+		t.Errorf("%d uploads left after erasure, want 0", count)
+	}
+}
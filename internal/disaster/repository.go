@@ -5,33 +5,108 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
+	"strings"
 	"time"
 
+	"github.com/InternalPointerVariable/ResQLink-Backend/internal/situation"
+	"github.com/InternalPointerVariable/ResQLink-Backend/internal/storage"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/redis/go-redis/v9"
 )
 
 type Repository interface {
-	CreateDisasterReport(ctx context.Context, arg createReportRequest) error
-	ListDisasterReports(ctx context.Context) ([]basicReport, error)
+	CreateDisasterReport(ctx context.Context, arg createReportRequest) (createReportResponse, error)
+	ListDisasterReports(ctx context.Context, filter reportFilter) (reportsPage, error)
+	GetDisasterReport(ctx context.Context, reportID string) (fullReport, error)
 	ListDisasterReportsByReporter(
 		ctx context.Context,
 		reporterID string,
 	) (reportsByReporterResponse, error)
-	SaveLocation(ctx context.Context, arg saveLocationRequest) error
+	IsOwnReporter(ctx context.Context, reporterID string, caller reporterIdentity) (bool, error)
+	CreateUpload(ctx context.Context, photo uploadedPhoto, owner reporterIdentity) error
+	GetUpload(ctx context.Context, photoID string) (upload, error)
+	SaveLocation(
+		ctx context.Context,
+		arg saveLocationRequest,
+		caller reporterIdentity,
+	) (*string, error)
 	SetResponder(ctx context.Context, arg setResponderRequest) (setResponderResponse, error)
+	TransitionReport(ctx context.Context, arg transitionReportRequest) (reportEvent, error)
+	AddReportUpdate(
+		ctx context.Context,
+		arg addReportUpdateRequest,
+		caller reporterIdentity,
+	) (reportUpdate, error)
+	SendMessage(
+		ctx context.Context,
+		arg sendMessageRequest,
+		caller reporterIdentity,
+	) (reportMessage, error)
+	ListMessages(
+		ctx context.Context,
+		reportID string,
+		caller reporterIdentity,
+		before *string,
+		limit int,
+	) (messagesPage, error)
+	MarkMessages(
+		ctx context.Context,
+		arg markMessagesRequest,
+		caller reporterIdentity,
+	) (messageReceipt, error)
+
+	ListIncidents(ctx context.Context, status *incidentStatus) ([]incident, error)
+	GetIncident(ctx context.Context, incidentID string) (incident, error)
+	CreateIncident(ctx context.Context, arg createIncidentRequest) (incident, error)
+	UpdateIncident(ctx context.Context, arg updateIncidentRequest) (incident, error)
+	DeleteIncident(ctx context.Context, incidentID string) error
+	SetReportIncident(
+		ctx context.Context,
+		arg setReportIncidentRequest,
+	) (reportIncidentChange, error)
+
+	ListHazardZones(ctx context.Context) ([]hazardZone, error)
+	CreateHazardZone(ctx context.Context, arg createHazardZoneRequest) (hazardZone, error)
+	DeleteHazardZone(ctx context.Context, zoneID string) error
+
+	ListDuplicateCandidates(ctx context.Context, reportID string) ([]duplicatePair, error)
+	ListReportClusters(ctx context.Context, incidentID *string) ([]reportCluster, error)
+	MergeReports(ctx context.Context, arg mergeReportsRequest) (reportsMerge, error)
+	LinkReports(ctx context.Context, arg linkReportsRequest) (reportLink, error)
+	UnlinkReports(ctx context.Context, reportID, linkedReportID string) error
+
+	getSituation(ctx context.Context, reportID string) (situation.Report, time.Time, error)
+	saveSummary(
+		ctx context.Context,
+		reportID string,
+		summary situation.Summary,
+		readAt time.Time,
+	) error
+
+	ExportPersonalData(ctx context.Context, userID string) (any, error)
+	ErasePersonalData(ctx context.Context, userID string) error
 }
 
 type repository struct {
-	querier     *pgxpool.Pool
-	redisClient *redis.Client
+	querier         *pgxpool.Pool
+	redisClient     *redis.Client
+	storage         storage.Storage // Only used to delete erased users' uploads
+	priorityWeights PriorityWeights
 }
 
-func NewRepository(querier *pgxpool.Pool, redisClient *redis.Client) Repository {
+func NewRepository(
+	querier *pgxpool.Pool,
+	redisClient *redis.Client,
+	storage storage.Storage,
+	priorityWeights PriorityWeights,
+) Repository {
 	return &repository{
-		querier:     querier,
-		redisClient: redisClient,
+		querier:         querier,
+		redisClient:     redisClient,
+		storage:         storage,
+		priorityWeights: priorityWeights,
 	}
 }
 
@@ -43,6 +118,20 @@ const (
 	inDanger citizenStatus = "in_danger"
 )
 
+// Higher is worse, used to tell when a citizen's situation escalates
+func (s citizenStatus) severity() int {
+	switch s {
+	case safe:
+		return 1
+	case atRisk:
+		return 2
+	case inDanger:
+		return 3
+	}
+
+	return 0
+}
+
 type reporter struct {
 	ReporterID string    `json:"id"`
 	CreatedAt  time.Time `json:"createdAt"`
@@ -66,6 +155,9 @@ type basicReport struct {
 	CreatedAt        time.Time     `json:"createdAt"`
 	UpdatedAt        time.Time     `json:"updatedAt"`
 	Status           citizenStatus `json:"status"`
+	State            reportState   `json:"state"`
+	Priority         float64       `json:"priority"` // Higher is more urgent, see `PriorityWeights`
+	IncidentID       *string       `json:"incidentId"`
 	Reporter         reporter      `json:"reporter"`
 	Responder        *responder    `json:"responder"`
 	Location         *location     `json:"location"  db:"-"`
@@ -74,20 +166,255 @@ type basicReport struct {
 type fullReport struct {
 	basicReport
 
-	RawSituation   string   `json:"rawSituation"`
-	AIGenSituation *string  `json:"aiGenSituation"`
-	PhotoURLs      []string `json:"photoUrls"`
+	RawSituation   string             `json:"rawSituation"`
+	AIGenSituation *string            `json:"aiGenSituation"`
+	AISummary      *situation.Summary `json:"aiSummary"` // Nil until summarized, see `SummaryWorker`
+	PhotoURLs      []string           `json:"photoUrls"`
+	StatusHistory  []statusChange     `json:"statusHistory"`
+	Events         []reportEvent      `json:"events" db:"-"`
+	Updates        []reportUpdate     `json:"updates" db:"-"`
+
+	// See `MergeReports` and `LinkReports`
+	MergedIntoID    *string  `json:"mergedIntoId"`
+	MergedReportIDs []string `json:"mergedReportIds"`
+	LinkedReportIDs []string `json:"linkedReportIds"`
 }
 
-const locationFmt = "reporter:%s:location"
+// The status the report was filed with, then each follow-up that gave one.
+type statusChange struct {
+	ReportUpdateID *string       `json:"updateId"` // Nil for the report itself
+	CreatedAt      time.Time     `json:"createdAt"`
+	Status         citizenStatus `json:"status"`
+}
 
-func (r *repository) ListDisasterReports(ctx context.Context) ([]basicReport, error) {
-	query := `
-	SELECT DISTINCT ON (disaster_reports.reporter_id)
-		disaster_reports.disaster_report_id,
-		disaster_reports.created_at,
-		disaster_reports.updated_at,
-		disaster_reports.status,
+const (
+	locationFmt = "reporter:%s:location"
+	// Geo index of every reporter's last location, for searching by area
+	reporterLocationsKey = "reporter_locations"
+)
+
+type reportsPage struct {
+	Reports    []basicReport
+	NextCursor *string
+}
+
+func (r *repository) ListDisasterReports(
+	ctx context.Context,
+	filter reportFilter,
+) (reportsPage, error) {
+	var reporterIDs []string
+
+	if filter.BoundingBox != nil {
+		var err error
+
+		reporterIDs, err = r.searchReporterLocations(ctx, *filter.BoundingBox)
+		if err != nil {
+			return reportsPage{}, err
+		}
+	}
+
+	// Every page is ranked as of the first one's time
+	priorityAt := time.Now()
+	if filter.Cursor != nil && !filter.Cursor.PriorityAt.IsZero() {
+		priorityAt = filter.Cursor.PriorityAt
+	}
+
+	query, args := listReportsQuery(filter, r.priorityWeights, reporterIDs, priorityAt)
+
+	rows, err := r.querier.Query(ctx, query, args...)
+	if err != nil {
+		return reportsPage{}, err
+	}
+
+	reports, err := pgx.CollectRows(rows, pgx.RowToStructByName[basicReport])
+	if err != nil {
+		return reportsPage{}, err
+	}
+
+	var page reportsPage
+
+	if len(reports) > filter.Limit {
+		reports = reports[:filter.Limit]
+		last := reports[len(reports)-1]
+
+		cursor, err := reportCursor{
+			Sort:       filter.Sort,
+			Descending: filter.Descending,
+			Severity:   last.Status.severity(),
+			Priority:   last.Priority,
+			CreatedAt:  last.CreatedAt,
+			ReportID:   last.DisasterReportID,
+			PriorityAt: priorityAt,
+		}.encode()
+		if err != nil {
+			return reportsPage{}, err
+		}
+
+		page.NextCursor = &cursor
+	}
+
+	if err := r.setLocations(ctx, reports); err != nil {
+		return reportsPage{}, err
+	}
+
+	page.Reports = reports
+
+	return page, nil
+}
+
+// listReportsQuery builds the query of `ListDisasterReports`. Each reporter is
+// listed by their worst report among the ones the filter matches, so the filter
+// applies before `DISTINCT ON` and only the cursor after it. `reporterIDs` are
+// the ones found in the filter's bounding box.
+func listReportsQuery(
+	filter reportFilter,
+	weights PriorityWeights,
+	reporterIDs []string,
+	priorityAt time.Time,
+) (string, []any) {
+	var args []any
+
+	arg := func(value any) string {
+		args = append(args, value)
+		return fmt.Sprintf("($%d)", len(args))
+	}
+
+	// Merged reports are listed through the report they're merged into
+	filters := []string{"disaster_reports.merged_into_id IS NULL"}
+
+	if filter.IncidentID != nil {
+		filters = append(filters, "disaster_reports.incident_id::text = "+arg(*filter.IncidentID))
+	}
+
+	if len(filter.Statuses) > 0 {
+		statuses := make([]string, len(filter.Statuses))
+		for i, status := range filter.Statuses {
+			statuses[i] = string(status)
+		}
+
+		filters = append(filters, "disaster_reports.status::text = ANY"+arg(statuses))
+	}
+
+	if len(filter.States) > 0 {
+		states := make([]string, len(filter.States))
+		for i, state := range filter.States {
+			states[i] = string(state)
+		}
+
+		filters = append(filters, "disaster_reports.state::text = ANY"+arg(states))
+	}
+
+	if filter.IsAssigned != nil {
+		if *filter.IsAssigned {
+			filters = append(filters, "disaster_reports.responder_id IS NOT NULL")
+		} else {
+			filters = append(filters, "disaster_reports.responder_id IS NULL")
+		}
+	}
+
+	if filter.ResponderID != nil {
+		filters = append(filters, "disaster_reports.responder_id::text = "+arg(*filter.ResponderID))
+	}
+
+	if filter.CreatedAfter != nil {
+		filters = append(filters, "disaster_reports.created_at >= "+arg(*filter.CreatedAfter))
+	}
+
+	if filter.CreatedBefore != nil {
+		filters = append(filters, "disaster_reports.created_at < "+arg(*filter.CreatedBefore))
+	}
+
+	if filter.BoundingBox != nil {
+		filters = append(filters, "disaster_reports.reporter_id::text = ANY"+arg(reporterIDs))
+	}
+
+	priority := weights.priorityExpression(arg(priorityAt) + "::timestamptz")
+
+	// Keyset pagination, every column is sorted the same way so the position can
+	// be compared as a row
+	columns := "worst.severity, worst.created_at, worst.disaster_report_id"
+	switch filter.Sort {
+	case sortByAge:
+		columns = "worst.created_at, worst.disaster_report_id"
+	case sortByPriority:
+		columns = "worst.priority, worst.created_at, worst.disaster_report_id"
+	}
+
+	// The oldest reports have the highest age
+	descending := filter.Descending
+	if filter.Sort == sortByAge {
+		descending = !descending
+	}
+
+	direction, comparison := "ASC", ">"
+	if descending {
+		direction, comparison = "DESC", "<"
+	}
+
+	cursor := ""
+	if filter.Cursor != nil {
+		var position string
+		switch filter.Sort {
+		case sortBySeverity:
+			position = fmt.Sprintf(
+				"(%s, %s, %s)",
+				arg(filter.Cursor.Severity),
+				arg(filter.Cursor.CreatedAt),
+				arg(filter.Cursor.ReportID),
+			)
+		case sortByPriority:
+			position = fmt.Sprintf(
+				"(%s, %s, %s)",
+				arg(filter.Cursor.Priority),
+				arg(filter.Cursor.CreatedAt),
+				arg(filter.Cursor.ReportID),
+			)
+		default:
+			position = fmt.Sprintf("(%s, %s)", arg(filter.Cursor.CreatedAt), arg(filter.Cursor.ReportID))
+		}
+
+		cursor = fmt.Sprintf("WHERE (%s) %s %s", columns, comparison, position)
+	}
+
+	orderBy := strings.ReplaceAll(columns, ",", " "+direction+",") + " " + direction
+
+	// One more than the limit tells if there's a next page
+	limit := arg(filter.Limit + 1)
+
+	query := fmt.Sprintf(`
+	WITH worst AS (
+		SELECT DISTINCT ON (disaster_reports.reporter_id)
+			disaster_reports.disaster_report_id,
+			disaster_reports.created_at,
+			disaster_reports.updated_at,
+			disaster_reports.status,
+			disaster_reports.state,
+			%s AS priority,
+			disaster_reports.incident_id,
+			disaster_reports.reporter_id,
+			disaster_reports.responder_id,
+			CASE disaster_reports.status
+				WHEN 'in_danger' THEN 3
+				WHEN 'at_risk' THEN 2
+				WHEN 'safe' THEN 1
+				ELSE 0 -- For unexpected status values
+			END AS severity
+		FROM disaster_reports
+		WHERE %s
+		ORDER BY 
+			disaster_reports.reporter_id,
+			disaster_reports.state IN ('resolved', 'cancelled'), -- Open reports first
+			disaster_reports.responder_id NULLS FIRST,
+			priority DESC
+	)
+	SELECT
+		worst.disaster_report_id,
+		worst.created_at,
+		worst.updated_at,
+		worst.status,
+		worst.state,
+		worst.priority,
+		worst.incident_id,
 		jsonb_build_object(
 			'id', reporters.reporter_id,
 			'createdAt', reporters.created_at,
@@ -107,48 +434,63 @@ func (r *repository) ListDisasterReports(ctx context.Context) ([]basicReport, er
 			)
 		ELSE NULL
 		END AS responder
-	FROM disaster_reports
-	JOIN reporters ON reporters.reporter_id = disaster_reports.reporter_id
-	LEFT JOIN responders ON responders.responder_id = disaster_reports.responder_id
+	FROM worst
+	JOIN reporters ON reporters.reporter_id = worst.reporter_id
+	LEFT JOIN responders ON responders.responder_id = worst.responder_id
 	LEFT JOIN users urep ON urep.user_id = reporters.user_id
 	LEFT JOIN users ures ON ures.user_id = responders.user_id
-	ORDER BY 
-		disaster_reports.reporter_id,
-		disaster_reports.responder_id NULLS FIRST,
-		CASE disaster_reports.status
-			WHEN 'in_danger' THEN 1
-			WHEN 'at_risk' THEN 2
-			WHEN 'safe' THEN 3
-			ELSE 4 -- For unexpected status values
-		END
-	`
+	%s
+	ORDER BY %s
+	LIMIT %s
+	`, priority, strings.Join(filters, " AND "), cursor, orderBy, limit)
 
-	rows, err := r.querier.Query(ctx, query)
-	if err != nil {
-		return nil, err
+	return query, args
+}
+
+func (r *repository) setLocations(ctx context.Context, reports []basicReport) error {
+	reporterIDs := make([]string, len(reports))
+	for i, report := range reports {
+		reporterIDs[i] = report.Reporter.ReporterID
 	}
 
-	reports, err := pgx.CollectRows(rows, pgx.RowToStructByName[basicReport])
+	locations, err := r.getLocations(ctx, reporterIDs)
 	if err != nil {
-		return nil, err
+		return err
+	}
+
+	for i := range reports {
+		reports[i].Location = locations[reports[i].Reporter.ReporterID]
+	}
+
+	return nil
+}
+
+// getLocations returns the last location of each reporter that has one.
+func (r *repository) getLocations(
+	ctx context.Context,
+	reporterIDs []string,
+) (map[string]*location, error) {
+	locations := make(map[string]*location)
+
+	if len(reporterIDs) == 0 {
+		return locations, nil
 	}
 
 	pipe := r.redisClient.Pipeline()
 	cmds := make(map[string]*redis.JSONCmd)
 
-	for _, report := range reports {
-		key := fmt.Sprintf(locationFmt, report.Reporter.ReporterID)
-		cmds[report.Reporter.ReporterID] = pipe.JSONGet(ctx, key)
+	for _, reporterID := range reporterIDs {
+		key := fmt.Sprintf(locationFmt, reporterID)
+		cmds[reporterID] = pipe.JSONGet(ctx, key)
 	}
 
 	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
 		return nil, err
 	}
 
-	for i := range reports {
-		report := &reports[i]
-		result, err := cmds[report.Reporter.ReporterID].Result()
-		if err != nil {
+	for reporterID, cmd := range cmds {
+		result, err := cmd.Result()
+		if err != nil && !errors.Is(err, redis.Nil) {
 			return nil, err
 		}
 
@@ -156,31 +498,227 @@ func (r *repository) ListDisasterReports(ctx context.Context) ([]basicReport, er
 			continue
 		}
 
-		if err := json.Unmarshal([]byte(result), &report.Location); err != nil {
+		var loc location
+
+		if err := json.Unmarshal([]byte(result), &loc); err != nil {
 			return nil, err
 		}
+
+		locations[reporterID] = &loc
+	}
+
+	return locations, nil
+}
+
+// searchReporterLocations returns the reporters whose last location is in `box`.
+// Redis searches a box around a center, so the box is made wide enough for
+// the whole area and the results are checked against the exact bounds.
+func (r *repository) searchReporterLocations(
+	ctx context.Context,
+	box boundingBox,
+) ([]string, error) {
+	const kmPerDegree = 111.32
+
+	// Parallels are the longest closest to the equator
+	widestLatitude := min(math.Abs(box.MinLatitude), math.Abs(box.MaxLatitude))
+	if box.MinLatitude < 0 && box.MaxLatitude > 0 {
+		widestLatitude = 0
+	}
+
+	width := (box.MaxLongitude - box.MinLongitude) * kmPerDegree *
+		math.Cos(widestLatitude*math.Pi/180)
+	height := (box.MaxLatitude - box.MinLatitude) * kmPerDegree
+
+	locations, err := r.redisClient.GeoSearchLocation(
+		ctx,
+		reporterLocationsKey,
+		&redis.GeoSearchLocationQuery{
+			GeoSearchQuery: redis.GeoSearchQuery{
+				Longitude: (box.MinLongitude + box.MaxLongitude) / 2,
+				Latitude:  (box.MinLatitude + box.MaxLatitude) / 2,
+				// Rounded up, the search is only narrowed down afterwards
+				BoxWidth:  width*1.01 + 0.01,
+				BoxHeight: height*1.01 + 0.01,
+				BoxUnit:   "km",
+			},
+			WithCoord: true,
+		},
+	).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	reporterIDs := []string{}
+
+	for _, location := range locations {
+		if box.contains(location.Longitude, location.Latitude) {
+			reporterIDs = append(reporterIDs, location.Name)
+		}
+	}
+
+	return reporterIDs, nil
+}
+
+var errReportNotFound = errors.New("disaster report not found")
+
+func (r *repository) GetDisasterReport(ctx context.Context, reportID string) (fullReport, error) {
+	query := `
+	SELECT
+		disaster_reports.disaster_report_id,
+		disaster_reports.created_at,
+		disaster_reports.updated_at,
+		disaster_reports.status,
+		disaster_reports.state,
+		` + r.priorityWeights.priorityExpression("now()") + ` AS priority,
+		disaster_reports.incident_id,
+		jsonb_build_object(
+			'id', reporters.reporter_id,
+			'createdAt', reporters.created_at,
+			'name', COALESCE(
+				TRIM(CONCAT(urep.last_name, ', ', urep.first_name, ' ', urep.middle_name)),
+				reporters.name
+			)
+		) AS reporter,
+		CASE WHEN responders.responder_id IS NOT NULL THEN
+			jsonb_build_object(
+				'id', responders.responder_id,
+				'createdAt', responders.created_at,
+				'name', COALESCE(
+					TRIM(CONCAT(ures.last_name, ', ', ures.first_name, ' ', ures.middle_name)),
+					responders.name
+				)
+			)
+		ELSE NULL
+		END AS responder,
+		disaster_reports.raw_situation,
+		disaster_reports.ai_gen_situation,
+		disaster_reports.ai_summary,
+		COALESCE(
+			(
+				SELECT array_agg(photo_url)
+				FROM disaster_photos
+				WHERE disaster_photos.disaster_report_id = disaster_reports.disaster_report_id
+					AND disaster_photos.report_update_id IS NULL
+			),
+			'{}'
+		) AS photo_urls,
+		(
+			SELECT jsonb_agg(
+				jsonb_build_object(
+					'updateId', history.report_update_id,
+					'createdAt', history.created_at,
+					'status', history.status
+				)
+				ORDER BY history.created_at
+			)
+			FROM (
+				SELECT
+					NULL::uuid AS report_update_id,
+					disaster_reports.created_at,
+					disaster_reports.initial_status AS status
+				UNION ALL
+				SELECT report_update_id, created_at, status
+				FROM report_updates
+				WHERE report_updates.disaster_report_id = disaster_reports.disaster_report_id
+					AND report_updates.status IS NOT NULL
+			) history
+		) AS status_history,
+		disaster_reports.merged_into_id,
+		COALESCE(
+			(
+				SELECT array_agg(merged.disaster_report_id ORDER BY merged.created_at)
+				FROM disaster_reports merged
+				WHERE merged.merged_into_id = disaster_reports.disaster_report_id
+			),
+			'{}'
+		) AS merged_report_ids,
+		COALESCE(
+			(
+				SELECT array_agg(
+					CASE WHEN report_links.disaster_report_id = disaster_reports.disaster_report_id
+						THEN report_links.linked_report_id
+						ELSE report_links.disaster_report_id
+					END
+					ORDER BY report_links.created_at
+				)
+				FROM report_links
+				WHERE disaster_reports.disaster_report_id
+					IN (report_links.disaster_report_id, report_links.linked_report_id)
+			),
+			'{}'
+		) AS linked_report_ids
+	FROM disaster_reports
+	JOIN reporters ON reporters.reporter_id = disaster_reports.reporter_id
+	LEFT JOIN responders ON responders.responder_id = disaster_reports.responder_id
+	LEFT JOIN users urep ON urep.user_id = reporters.user_id
+	LEFT JOIN users ures ON ures.user_id = responders.user_id
+	WHERE disaster_reports.disaster_report_id = ($1)
+	`
+
+	rows, err := r.querier.Query(ctx, query, reportID)
+	if err != nil {
+		return fullReport{}, err
+	}
+
+	report, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[fullReport])
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return fullReport{}, errReportNotFound
+		}
+
+		return fullReport{}, err
+	}
+
+	report.Events, err = r.listReportEvents(ctx, reportID)
+	if err != nil {
+		return fullReport{}, err
+	}
+
+	report.Updates, err = r.listReportUpdates(ctx, reportID)
+	if err != nil {
+		return fullReport{}, err
+	}
+
+	key := fmt.Sprintf(locationFmt, report.Reporter.ReporterID)
+	result, err := r.redisClient.JSONGet(ctx, key).Result()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return fullReport{}, err
+	}
+
+	if result != "" {
+		if err := json.Unmarshal([]byte(result), &report.Location); err != nil {
+			return fullReport{}, err
+		}
 	}
 
-	return reports, nil
+	return report, nil
 }
 
 type userReport struct {
-	DisasterReportID string        `json:"id"`
-	CreatedAt        time.Time     `json:"createdAt"`
-	UpdatedAt        time.Time     `json:"updatedAt"`
-	Status           citizenStatus `json:"status"`
-	Responder        *responder    `json:"responder"`
-	RawSituation     string        `json:"rawSituation"`
-	AIGenSituation   *string       `json:"aiGenSituation"`
-	PhotoURLs        []string      `json:"photoUrls"`
+	DisasterReportID string         `json:"id"`
+	CreatedAt        time.Time      `json:"createdAt"`
+	UpdatedAt        time.Time      `json:"updatedAt"`
+	Status           citizenStatus  `json:"status"`
+	State            reportState    `json:"state"`
+	IncidentID       *string        `json:"incidentId"`
+	Responder        *responder     `json:"responder"`
+	RawSituation     string         `json:"rawSituation"`
+	AIGenSituation   *string        `json:"aiGenSituation"`
+	PhotoURLs        []string       `json:"photoUrls"`
+	Updates          []reportUpdate `json:"updates"`
 }
 
 type reportsByReporterResponse struct {
 	Reports  []userReport `json:"reports"`
 	Reporter reporter     `json:"reporter"`
 	Location *location    `json:"location" db:"-"`
+
+	// Only set for the reporter's assigned responder, see `MedicalProfileStore`
+	MedicalProfile any `json:"medicalProfile,omitempty" db:"-"`
 }
 
+var errReporterNotFound = errors.New("reporter not found")
+
 // TODO: Ordering and filtering
 func (r *repository) ListDisasterReportsByReporter(
 	ctx context.Context,
@@ -192,6 +730,7 @@ func (r *repository) ListDisasterReportsByReporter(
 			disaster_report_id,
 			array_agg(photo_url) FILTER (WHERE photo_url IS NOT NULL) AS photo_urls
 		FROM disaster_photos
+		WHERE report_update_id IS NULL
 		GROUP BY disaster_report_id
 	),
 	user_reports AS (
@@ -202,9 +741,36 @@ func (r *repository) ListDisasterReportsByReporter(
 					'createdAt', disaster_reports.created_at,
 					'updatedAt', disaster_reports.updated_at,
 					'status', disaster_reports.status,
+					'state', disaster_reports.state,
+					'incidentId', disaster_reports.incident_id,
 					'rawSituation', disaster_reports.raw_situation,
 					'aiGenSituation', disaster_reports.ai_gen_situation,
 					'photoUrls', photos.photo_urls,
+					'updates', (
+						SELECT COALESCE(
+							jsonb_agg(
+								jsonb_build_object(
+									'id', report_updates.report_update_id,
+									'createdAt', report_updates.created_at,
+									'reportId', report_updates.disaster_report_id,
+									'status', report_updates.status,
+									'rawSituation', report_updates.raw_situation,
+									'photoUrls', COALESCE(
+										(
+											SELECT array_agg(photo_url)
+											FROM disaster_photos
+											WHERE disaster_photos.report_update_id = report_updates.report_update_id
+										),
+										'{}'
+									)
+								)
+								ORDER BY report_updates.created_at
+							),
+							'[]'
+						)
+						FROM report_updates
+						WHERE report_updates.disaster_report_id = disaster_reports.disaster_report_id
+					),
 					'responder', CASE WHEN responders.responder_id IS NOT NULL THEN
 						jsonb_build_object(
 							'id', responders.responder_id,
@@ -247,12 +813,16 @@ func (r *repository) ListDisasterReportsByReporter(
 
 	disaster, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[reportsByReporterResponse])
 	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return reportsByReporterResponse{}, errReporterNotFound
+		}
+
 		return reportsByReporterResponse{}, err
 	}
 
 	key := fmt.Sprintf(locationFmt, reporterID)
 	result, err := r.redisClient.JSONGet(ctx, key).Result()
-	if err != nil {
+	if err != nil && !errors.Is(err, redis.Nil) {
 		return reportsByReporterResponse{}, err
 	}
 
@@ -265,73 +835,213 @@ func (r *repository) ListDisasterReportsByReporter(
 	return disaster, nil
 }
 
+// IsOwnReporter reports whether `reporterID` is the caller's own reporter row.
+func (r *repository) IsOwnReporter(
+	ctx context.Context,
+	reporterID string,
+	caller reporterIdentity,
+) (bool, error) {
+	query := `
+	SELECT EXISTS (
+		SELECT 1
+		FROM reporters
+		WHERE reporters.reporter_id = ($1)
+			AND (reporters.user_id = ($2) OR reporters.anonymous_id = ($3))
+	)
+	`
+
+	var isOwn bool
+
+	row := r.querier.QueryRow(ctx, query, reporterID, caller.UserID, caller.AnonymousID)
+	if err := row.Scan(&isOwn); err != nil {
+		return false, err
+	}
+
+	return isOwn, nil
+}
+
+type createReportResponse struct {
+	DisasterReportID string `json:"id"`
+	ReporterID       string `json:"reporterId"`
+
+	// Set when the report was added to the reporter's open report
+	ReportUpdateID *string `json:"updateId,omitempty"`
+
+	// Status of the reporter's report before this one, if any
+	PreviousStatus *citizenStatus `json:"-"`
+}
+
+// What the feed is told of a new report. Dashboards fetch the rest through
+// `GET /api/reports/{reportId}`, so the feed never carries what the citizen sent.
+type reportCreated struct {
+	DisasterReportID string        `json:"id"`
+	ReporterID       string        `json:"reporterId"`
+	Status           citizenStatus `json:"status"`
+}
+
+// A reporter's open report quiet for longer than this is likely a forgotten
+// one, so a new emergency gets its own report instead of joining it.
+const followUpWindow = 6 * time.Hour
+
+// CreateDisasterReport adds the report as a follow-up to the reporter's latest
+// report while it's still open and was active within `followUpWindow`, so one
+// emergency stays one report. Follow-ups to a merged report go to the report
+// it's merged into, the one responders see.
 func (r *repository) CreateDisasterReport(
 	ctx context.Context,
 	arg createReportRequest,
-) error {
+) (createReportResponse, error) {
 	tx, err := r.querier.Begin(ctx)
 	if err != nil {
-		return err
+		return createReportResponse{}, err
 	}
 	defer tx.Rollback(ctx)
 
-	query := `
-	INSERT INTO reporters (name, user_id)
-	VALUES ($1, $2)
-	ON CONFLICT (user_id) DO UPDATE
+	conflictTarget := "user_id"
+	if arg.UserID == nil {
+		conflictTarget = "anonymous_id"
+	}
+
+	query := fmt.Sprintf(`
+	INSERT INTO reporters (name, user_id, anonymous_id)
+	VALUES ($1, $2, $3)
+	ON CONFLICT (%s) DO UPDATE
 		SET name = EXCLUDED.name
 	RETURNING reporter_id
+	`, conflictTarget)
+
+	var res createReportResponse
+
+	row := tx.QueryRow(ctx, query, arg.Name, arg.UserID, arg.AnonymousID)
+	if err := row.Scan(&res.ReporterID); err != nil {
+		return createReportResponse{}, err
+	}
+
+	query = `
+	SELECT
+		target.disaster_report_id,
+		latest.status,
+		target.state,
+		COALESCE(
+			(
+				SELECT max(created_at) FROM report_updates
+				WHERE report_updates.disaster_report_id = target.disaster_report_id
+			),
+			target.created_at
+		)
+	FROM disaster_reports AS latest
+	JOIN disaster_reports AS target
+		ON target.disaster_report_id = COALESCE(latest.merged_into_id, latest.disaster_report_id)
+	WHERE latest.reporter_id = ($1)
+	ORDER BY latest.created_at DESC
+	LIMIT 1
+	FOR UPDATE OF target
 	`
 
-	var reporterID string
+	var latestID string
+	var latestState reportState
+	var latestActivity time.Time
 
-	row := tx.QueryRow(ctx, query, arg.Name, arg.UserID)
-	if err := row.Scan(&reporterID); err != nil {
-		return err
+	row = tx.QueryRow(ctx, query, res.ReporterID)
+	err = row.Scan(&latestID, &res.PreviousStatus, &latestState, &latestActivity)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return createReportResponse{}, err
+	}
+
+	owner := reporterIdentity{UserID: arg.UserID, AnonymousID: arg.AnonymousID}
+
+	if latestID != "" && !latestState.isClosed() && time.Since(latestActivity) < followUpWindow {
+		update, err := insertReportUpdate(ctx, tx, addReportUpdateRequest{
+			DisasterReportID: latestID,
+			Status:           &arg.Status,
+			RawSituation:     &arg.RawSituation,
+			PhotoIDs:         arg.PhotoIDs,
+		}, owner)
+		if err != nil {
+			return createReportResponse{}, err
+		}
+
+		if err := tx.Commit(ctx); err != nil {
+			return createReportResponse{}, err
+		}
+
+		if err := r.broadcast(ctx, latestID, reportUpdated, update); err != nil {
+			return createReportResponse{}, err
+		}
+
+		if err := r.updatePriorities(ctx, latestID); err != nil {
+			return createReportResponse{}, err
+		}
+
+		if err := r.enqueueSummary(ctx, latestID); err != nil {
+			return createReportResponse{}, err
+		}
+
+		res.DisasterReportID = latestID
+		res.ReportUpdateID = &update.ReportUpdateID
+
+		return res, nil
 	}
 
 	query = `
         INSERT INTO disaster_reports (
             status,
+            initial_status,
             raw_situation,
             reporter_id
         )
-        VALUES ($1, $2, $3)
+        VALUES ($1, $1, $2, $3)
         RETURNING disaster_report_id
     `
 
-	var disasterReportID string
-
-	row = tx.QueryRow(ctx, query, arg.Status, arg.RawSituation, reporterID)
-	if err := row.Scan(&disasterReportID); err != nil {
-		return err
+	row = tx.QueryRow(ctx, query, arg.Status, arg.RawSituation, res.ReporterID)
+	if err := row.Scan(&res.DisasterReportID); err != nil {
+		return createReportResponse{}, err
 	}
 
-	query = `
-    INSERT INTO disaster_photos (photo_url, disaster_report_id)
-    VALUES ($1, $2)
-    `
+	actor := reportActor{UserID: arg.UserID}
+	if _, err := insertReportEvent(ctx, tx, res.DisasterReportID, nil, reported, nil, actor); err != nil {
+		return createReportResponse{}, err
+	}
 
-	for _, photoURL := range arg.PhotoURLs {
-		if _, err := tx.Exec(ctx, query, photoURL, disasterReportID); err != nil {
-			return err
-		}
+	if _, err := attachPhotos(ctx, tx, owner, arg.PhotoIDs, res.DisasterReportID, nil); err != nil {
+		return createReportResponse{}, err
 	}
 
 	if err := tx.Commit(ctx); err != nil {
-		return err
+		return createReportResponse{}, err
+	}
+
+	if err := r.updatePriorities(ctx, res.DisasterReportID); err != nil {
+		return createReportResponse{}, err
 	}
 
-	argB, err := json.Marshal(arg)
+	locations, err := r.getLocations(ctx, []string{res.ReporterID})
 	if err != nil {
-		return err
+		return createReportResponse{}, err
 	}
 
-	if err := r.redisClient.Publish(ctx, createReport, argB).Err(); err != nil {
-		return err
+	if loc := locations[res.ReporterID]; loc != nil {
+		if err := r.linkReporter(ctx, res.ReporterID, *loc); err != nil {
+			return createReportResponse{}, err
+		}
 	}
 
-	return nil
+	created := reportCreated{
+		DisasterReportID: res.DisasterReportID,
+		ReporterID:       res.ReporterID,
+		Status:           arg.Status,
+	}
+
+	if err := r.broadcast(ctx, res.DisasterReportID, createReport, created); err != nil {
+		return createReportResponse{}, err
+	}
+
+	if err := r.enqueueSummary(ctx, res.DisasterReportID); err != nil {
+		return createReportResponse{}, err
+	}
+
+	return res, nil
 }
 
 type saveLocationRequest struct {
@@ -339,13 +1049,84 @@ type saveLocationRequest struct {
 	ReporterID string   `json:"reporterId"`
 }
 
-func (r *repository) SaveLocation(ctx context.Context, arg saveLocationRequest) error {
+var (
+	errNotOwnReporter    = errors.New("reporter does not belong to caller")
+	errLocationNotShared = errors.New("location sharing is turned off")
+)
+
+// SaveLocation checks `is_location_shared` on every update, so turning it off
+// takes effect right away. Anonymous reporters always share their location.
+// It returns the incident of the reporter's latest report, if any.
+func (r *repository) SaveLocation(
+	ctx context.Context,
+	arg saveLocationRequest,
+	caller reporterIdentity,
+) (*string, error) {
+	query := `
+	SELECT COALESCE(users.is_location_shared, TRUE)
+	FROM reporters
+	LEFT JOIN users ON users.user_id = reporters.user_id
+	WHERE reporters.reporter_id = ($1)
+		AND (reporters.user_id = ($2) OR reporters.anonymous_id = ($3))
+	`
+
+	var isLocationShared bool
+
+	row := r.querier.QueryRow(ctx, query, arg.ReporterID, caller.UserID, caller.AnonymousID)
+	if err := row.Scan(&isLocationShared); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, errNotOwnReporter
+		}
+
+		return nil, err
+	}
+
+	if !isLocationShared {
+		return nil, errLocationNotShared
+	}
+
 	key := fmt.Sprintf(locationFmt, arg.ReporterID)
-	if err := r.redisClient.JSONSet(ctx, key, "$", arg.Location).Err(); err != nil {
-		return err
+
+	pipe := r.redisClient.TxPipeline()
+	pipe.JSONSet(ctx, key, "$", arg.Location)
+	pipe.GeoAdd(ctx, reporterLocationsKey, &redis.GeoLocation{
+		Name:      arg.ReporterID,
+		Longitude: float64(arg.Location.Longitude),
+		Latitude:  float64(arg.Location.Latitude),
+	})
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
 	}
 
-	return nil
+	if err := r.linkReporter(ctx, arg.ReporterID, arg.Location); err != nil {
+		return nil, err
+	}
+
+	// The reporter may have moved in or out of a hazard zone
+	if err := r.reprioritize(
+		ctx,
+		"disaster_reports.reporter_id = ($1) AND disaster_reports.state NOT IN ('resolved', 'cancelled')",
+		arg.ReporterID,
+	); err != nil {
+		return nil, err
+	}
+
+	query = `
+	SELECT incident_id FROM disaster_reports
+	WHERE reporter_id = ($1)
+	ORDER BY created_at DESC
+	LIMIT 1
+	`
+
+	var incidentID *string
+
+	row = r.querier.QueryRow(ctx, query, arg.ReporterID)
+	if err := row.Scan(&incidentID); err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, err
+	}
+
+	return incidentID, nil
 }
 
 type initResponder struct {
@@ -356,6 +1137,8 @@ type initResponder struct {
 type setResponderRequest struct {
 	ReporterID string        `json:"reporterId"`
 	Responder  initResponder `json:"responder"`
+
+	Actor reportActor `json:"-"`
 }
 
 type setResponderResponse struct {
@@ -363,6 +1146,8 @@ type setResponderResponse struct {
 	Responder  responder `json:"responder"`
 }
 
+var errNotResponder = errors.New("user is not a responder")
+
 func (r *repository) SetResponder(
 	ctx context.Context,
 	arg setResponderRequest,
@@ -373,6 +1158,26 @@ func (r *repository) SetResponder(
 	}
 	defer tx.Rollback(ctx)
 
+	// Responders without an account come from partner agencies, see `assignResponder`
+	if arg.Responder.UserID != nil {
+		query := `
+		SELECT EXISTS (
+			SELECT 1 FROM users WHERE user_id = ($1) AND role = 'responder'
+		)
+		`
+
+		var isResponder bool
+
+		row := tx.QueryRow(ctx, query, arg.Responder.UserID)
+		if err := row.Scan(&isResponder); err != nil {
+			return setResponderResponse{}, err
+		}
+
+		if !isResponder {
+			return setResponderResponse{}, errNotResponder
+		}
+	}
+
 	query := `
 	INSERT INTO responders (name, user_id) 
 	VALUES ($1, $2)
@@ -388,12 +1193,31 @@ func (r *repository) SetResponder(
 		return setResponderResponse{}, err
 	}
 
+	// Reports merged with the reporter's, or the reporter's merged into others,
+	// share the responder, see `MergeReports`
 	query = `
-	UPDATE disaster_reports SET responder_id = ($1) 
-	WHERE reporter_id = ($2) AND responder_id IS NULL
+	SELECT disaster_report_id
+	FROM disaster_reports
+	WHERE COALESCE(merged_into_id, disaster_report_id) IN (
+		SELECT COALESCE(merged_into_id, disaster_report_id)
+		FROM disaster_reports
+		WHERE reporter_id = ($1)
+	)
+	FOR UPDATE
 	`
 
-	if _, err := tx.Exec(ctx, query, resp.ResponderID, arg.ReporterID); err != nil {
+	rows, err := tx.Query(ctx, query, arg.ReporterID)
+	if err != nil {
+		return setResponderResponse{}, err
+	}
+
+	reportIDs, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return setResponderResponse{}, err
+	}
+
+	updated, events, err := assignReports(ctx, tx, resp.ResponderID, reportIDs, arg.Actor)
+	if err != nil {
 		return setResponderResponse{}, err
 	}
 
@@ -401,6 +1225,16 @@ func (r *repository) SetResponder(
 		return setResponderResponse{}, err
 	}
 
+	if err := r.updatePriorities(ctx, updated...); err != nil {
+		return setResponderResponse{}, err
+	}
+
+	for _, event := range events {
+		if err := r.broadcast(ctx, event.DisasterReportID, reportTransitioned, event); err != nil {
+			return setResponderResponse{}, err
+		}
+	}
+
 	res := setResponderResponse{
 		ReporterID: arg.ReporterID,
 		Responder:  resp,
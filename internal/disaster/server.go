@@ -1,22 +1,63 @@
 package disaster
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/InternalPointerVariable/ResQLink-Backend/internal/api"
+	"github.com/InternalPointerVariable/ResQLink-Backend/internal/storage"
+	"github.com/InternalPointerVariable/ResQLink-Backend/internal/user"
 )
 
 type Server struct {
-	repository Repository
-	baseURL    string
+	repository      Repository
+	notifier        EmergencyNotifier
+	medicalProfiles MedicalProfileStore
+	households      HouseholdNotifier
+	storage         storage.Storage
+	baseURL         string // Public URL of the API, photo URLs are built from it
 }
 
-func NewServer(repository Repository, baseURL string) *Server {
+// EmergencyNotifier tells a citizen's emergency contacts about their status.
+// It's implemented by `user.Server`, which owns the contacts and the channels
+// they're reached through.
+type EmergencyNotifier interface {
+	NotifyEmergencyContacts(ctx context.Context, userID, status string) error
+}
+
+// MedicalProfileStore is implemented by `user.Server`. The profile is only
+// returned to the reporter's assigned responder, and `nil` for anyone else.
+type MedicalProfileStore interface {
+	GetAssignedMedicalProfile(ctx context.Context, reporterID, responderUserID string) (any, error)
+}
+
+// HouseholdNotifier is implemented by `household.Server`, which sends the status
+// to the members of the citizen's households only.
+type HouseholdNotifier interface {
+	NotifyHouseholds(ctx context.Context, userID, status string) error
+}
+
+func NewServer(
+	repository Repository,
+	notifier EmergencyNotifier,
+	medicalProfiles MedicalProfileStore,
+	households HouseholdNotifier,
+	storage storage.Storage,
+	baseURL string,
+) *Server {
 	return &Server{
-		repository: repository,
-		baseURL:    baseURL,
+		repository:      repository,
+		notifier:        notifier,
+		medicalProfiles: medicalProfiles,
+		households:      households,
+		storage:         storage,
+		baseURL:         strings.TrimSuffix(baseURL, "/"),
 	}
 }
 
@@ -26,10 +67,47 @@ func (s *Server) ListDisasterReportsByReporter(
 ) api.Response {
 	ctx := r.Context()
 
+	caller, ok := user.SessionFromContext(ctx)
+	if !ok {
+		return api.Response{
+			Error:   fmt.Errorf("get disaster reports by user: no session"),
+			Code:    http.StatusUnauthorized,
+			Message: "Unauthorized.",
+		}
+	}
+
 	reporterID := r.PathValue("reporterId")
 
+	// Citizens and anonymous callers only see their own history
+	if !isStaff(caller) {
+		isOwn, err := s.repository.IsOwnReporter(ctx, reporterID, reporterIdentityOf(caller))
+		if err != nil {
+			return api.Response{
+				Error:   fmt.Errorf("get disaster reports by user: %w", err),
+				Code:    http.StatusInternalServerError,
+				Message: "Failed to get disaster reports.",
+			}
+		}
+
+		if !isOwn {
+			return api.Response{
+				Error:   fmt.Errorf("get disaster reports by user: %w", errNotOwnReporter),
+				Code:    http.StatusNotFound,
+				Message: "Reporter not found.",
+			}
+		}
+	}
+
 	reports, err := s.repository.ListDisasterReportsByReporter(ctx, reporterID)
 	if err != nil {
+		if errors.Is(err, errReporterNotFound) {
+			return api.Response{
+				Error:   fmt.Errorf("get disaster reports by user: %w", err),
+				Code:    http.StatusNotFound,
+				Message: "Reporter not found.",
+			}
+		}
+
 		return api.Response{
 			Error:   fmt.Errorf("get disaster reports by user: %w", err),
 			Code:    http.StatusInternalServerError,
@@ -37,6 +115,21 @@ func (s *Server) ListDisasterReportsByReporter(
 		}
 	}
 
+	if caller.Role() == user.Responder {
+		reports.MedicalProfile, err = s.medicalProfiles.GetAssignedMedicalProfile(
+			ctx,
+			reporterID,
+			caller.User.UserID,
+		)
+		if err != nil {
+			return api.Response{
+				Error:   fmt.Errorf("get disaster reports by user: %w", err),
+				Code:    http.StatusInternalServerError,
+				Message: "Failed to get disaster reports.",
+			}
+		}
+	}
+
 	return api.Response{
 		Code:    http.StatusOK,
 		Message: "Successfully fetched disaster reports.",
@@ -45,11 +138,12 @@ func (s *Server) ListDisasterReportsByReporter(
 }
 
 type createReportRequest struct {
-	UserID       *string       `json:"userId"`
+	UserID       *string       `json:"-"` // Always taken from the session, never the body
+	AnonymousID  *string       `json:"-"`
 	Name         string        `json:"name"`
 	Status       citizenStatus `json:"status"`
 	RawSituation string        `json:"rawSituation"`
-	PhotoURLs    []string      `json:"photoUrls"`
+	PhotoIDs     []string      `json:"photoIds"` // Uploaded by the caller, see `UploadPhoto`
 }
 
 // NOTE: This is a version of `CreateDisasterReport` that uses `application/json`
@@ -68,7 +162,27 @@ func (s *Server) CreateDisasterReportJson(w http.ResponseWriter, r *http.Request
 		}
 	}
 
-	if err := s.repository.CreateDisasterReport(ctx, data); err != nil {
+	caller, ok := user.SessionFromContext(ctx)
+	if !ok {
+		return api.Response{
+			Error:   fmt.Errorf("create disaster report: no session"),
+			Code:    http.StatusUnauthorized,
+			Message: "Unauthorized.",
+		}
+	}
+
+	setReporterIdentity(caller, &data)
+
+	created, err := s.repository.CreateDisasterReport(ctx, data)
+	if err != nil {
+		if errors.Is(err, errNotOwnPhoto) {
+			return api.Response{
+				Error:   fmt.Errorf("create disaster report: %w", err),
+				Code:    http.StatusBadRequest,
+				Message: "Photos must be uploaded through /api/photos first.",
+			}
+		}
+
 		return api.Response{
 			Error:   fmt.Errorf("create disaster report: %w", err),
 			Code:    http.StatusInternalServerError,
@@ -76,9 +190,12 @@ func (s *Server) CreateDisasterReportJson(w http.ResponseWriter, r *http.Request
 		}
 	}
 
+	s.notifyStatusChange(ctx, data, created.PreviousStatus)
+
 	return api.Response{
 		Code:    http.StatusCreated,
 		Message: "Successfully created disaster report.",
+		Data:    created,
 	}
 }
 
@@ -96,27 +213,39 @@ func (s *Server) CreateDisasterReport(w http.ResponseWriter, r *http.Request) ap
 		}
 	}
 
-	var userID *string
-	userIDstr := r.FormValue("userId")
-	if userIDstr != "" {
-		userID = &userIDstr
+	caller, ok := user.SessionFromContext(ctx)
+	if !ok {
+		return api.Response{
+			Error:   fmt.Errorf("create disaster report: no session"),
+			Code:    http.StatusUnauthorized,
+			Message: "Unauthorized.",
+		}
 	}
 
 	disasterReport := createReportRequest{
-		UserID:       userID,
 		Name:         r.FormValue("name"),
 		Status:       citizenStatus(r.FormValue("status")),
 		RawSituation: r.FormValue("rawSituation"),
-		PhotoURLs:    []string{},
+		PhotoIDs:     []string{},
 	}
 
+	setReporterIdentity(caller, &disasterReport)
+
 	if r.MultipartForm != nil && r.MultipartForm.File != nil {
 		photos := r.MultipartForm.File["photos"]
 
 		if len(photos) > 0 {
 			for _, fileHeader := range photos {
-				fileURL, err := uploadPhoto(fileHeader, s.baseURL)
+				photo, err := s.uploadPhoto(ctx, reporterIdentityOf(caller), fileHeader)
 				if err != nil {
+					if errors.Is(err, errInvalidFileType) {
+						return api.Response{
+							Error:   fmt.Errorf("create disaster report: %w", err),
+							Code:    http.StatusBadRequest,
+							Message: "Photos must be JPEG, PNG, GIF or WebP images.",
+						}
+					}
+
 					return api.Response{
 						Error:   fmt.Errorf("create disaster report: %w", err),
 						Code:    http.StatusInternalServerError,
@@ -124,12 +253,13 @@ func (s *Server) CreateDisasterReport(w http.ResponseWriter, r *http.Request) ap
 					}
 				}
 
-				disasterReport.PhotoURLs = append(disasterReport.PhotoURLs, fileURL)
+				disasterReport.PhotoIDs = append(disasterReport.PhotoIDs, photo.PhotoID)
 			}
 		}
 	}
 
-	if err := s.repository.CreateDisasterReport(ctx, disasterReport); err != nil {
+	created, err := s.repository.CreateDisasterReport(ctx, disasterReport)
+	if err != nil {
 		return api.Response{
 			Error:   fmt.Errorf("create disaster report: %w", err),
 			Code:    http.StatusInternalServerError,
@@ -137,16 +267,87 @@ func (s *Server) CreateDisasterReport(w http.ResponseWriter, r *http.Request) ap
 		}
 	}
 
+	s.notifyStatusChange(ctx, disasterReport, created.PreviousStatus)
+
 	return api.Response{
 		Code:    http.StatusCreated,
 		Message: "Successfully created disaster report.",
+		Data:    created,
+	}
+}
+
+// notifyStatusChange tells the people close to a registered citizen about their
+// new status, with `previous` the status before the report or follow-up.
+func (s *Server) notifyStatusChange(
+	ctx context.Context,
+	arg createReportRequest,
+	previous *citizenStatus,
+) {
+	var previousStatus citizenStatus
+	if previous != nil {
+		previousStatus = *previous
+	}
+
+	s.notifyEmergencyContacts(ctx, arg.UserID, arg.Status, previousStatus)
+	s.notifyHouseholds(ctx, arg.UserID, arg.Status, previousStatus)
+}
+
+// Contacts are told when the citizen is in danger or their situation got worse
+// since their last status, which is empty for their first report. Anonymous
+// reporters have no contacts. Failing to notify them doesn't fail the report.
+func (s *Server) notifyEmergencyContacts(
+	ctx context.Context,
+	userID *string,
+	status, previous citizenStatus,
+) {
+	if userID == nil {
+		return
+	}
+
+	isEscalated := previous != "" && status.severity() > previous.severity()
+
+	if status != inDanger && !isEscalated {
+		return
+	}
+
+	if err := s.notifier.NotifyEmergencyContacts(ctx, *userID, string(status)); err != nil {
+		slog.Error(fmt.Errorf("notify emergency contacts: %w", err).Error())
+	}
+}
+
+// Household members are only told when the status changed, not on every
+// report. Like contacts, failing to notify them doesn't fail the report.
+func (s *Server) notifyHouseholds(
+	ctx context.Context,
+	userID *string,
+	status, previous citizenStatus,
+) {
+	if userID == nil {
+		return
+	}
+
+	if previous == status {
+		return
+	}
+
+	if err := s.households.NotifyHouseholds(ctx, *userID, string(status)); err != nil {
+		slog.Error(fmt.Errorf("notify households: %w", err).Error())
 	}
 }
 
 func (s *Server) ListDisasterReports(w http.ResponseWriter, r *http.Request) api.Response {
 	ctx := r.Context()
 
-	reports, err := s.repository.ListDisasterReports(ctx)
+	filter, err := parseReportFilter(r)
+	if err != nil {
+		return api.Response{
+			Error:   fmt.Errorf("get disaster reports: %w", err),
+			Code:    http.StatusBadRequest,
+			Message: "Invalid disaster report filters.",
+		}
+	}
+
+	page, err := s.repository.ListDisasterReports(ctx, filter)
 	if err != nil {
 		return api.Response{
 			Error:   fmt.Errorf("get disaster reports: %w", err),
@@ -158,7 +359,35 @@ func (s *Server) ListDisasterReports(w http.ResponseWriter, r *http.Request) api
 	return api.Response{
 		Code:    http.StatusOK,
 		Message: "Successfully fetched disaster reports.",
-		Data:    reports,
+		Data:    page.Reports,
+		Meta:    &api.Meta{NextCursor: page.NextCursor},
+	}
+}
+
+func (s *Server) GetDisasterReport(w http.ResponseWriter, r *http.Request) api.Response {
+	ctx := r.Context()
+
+	report, err := s.repository.GetDisasterReport(ctx, r.PathValue("reportId"))
+	if err != nil {
+		if errors.Is(err, errReportNotFound) {
+			return api.Response{
+				Error:   fmt.Errorf("get disaster report: %w", err),
+				Code:    http.StatusNotFound,
+				Message: "Disaster report not found.",
+			}
+		}
+
+		return api.Response{
+			Error:   fmt.Errorf("get disaster report: %w", err),
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to get disaster report.",
+		}
+	}
+
+	return api.Response{
+		Code:    http.StatusOK,
+		Message: "Successfully fetched disaster report.",
+		Data:    report,
 	}
 }
 
@@ -176,6 +405,25 @@ func (s *Server) SetResponder(w http.ResponseWriter, r *http.Request) api.Respon
 		}
 	}
 
+	caller, ok := user.SessionFromContext(ctx)
+	if !ok {
+		return api.Response{
+			Error:   fmt.Errorf("set responder: no session"),
+			Code:    http.StatusUnauthorized,
+			Message: "Unauthorized.",
+		}
+	}
+
+	data.Actor = actorFromSession(caller)
+
+	if err := assignResponder(caller, &data); err != nil {
+		return api.Response{
+			Error:   fmt.Errorf("set responder: %w", err),
+			Code:    http.StatusBadRequest,
+			Message: "A responder must be specified.",
+		}
+	}
+
 	reporterID := r.PathValue("reporterId")
 	if data.ReporterID != reporterID {
 		return api.Response{
@@ -187,6 +435,14 @@ func (s *Server) SetResponder(w http.ResponseWriter, r *http.Request) api.Respon
 
 	resp, err := s.repository.SetResponder(ctx, data)
 	if err != nil {
+		if errors.Is(err, errNotResponder) {
+			return api.Response{
+				Error:   fmt.Errorf("set responder: %w", err),
+				Code:    http.StatusForbidden,
+				Message: "Only verified responders can take reports.",
+			}
+		}
+
 		return api.Response{
 			Error:   fmt.Errorf("set responder: %w", err),
 			Code:    http.StatusBadRequest,
@@ -200,3 +456,889 @@ func (s *Server) SetResponder(w http.ResponseWriter, r *http.Request) api.Respon
 		Message: "Successfully set responder.",
 	}
 }
+
+func (s *Server) TransitionReport(w http.ResponseWriter, r *http.Request) api.Response {
+	ctx := r.Context()
+
+	var data transitionReportRequest
+
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&data); err != nil {
+		return api.Response{
+			Error:   fmt.Errorf("transition report: %w", err),
+			Code:    http.StatusBadRequest,
+			Message: "Invalid transition report request.",
+		}
+	}
+
+	caller, ok := user.SessionFromContext(ctx)
+	if !ok {
+		return api.Response{
+			Error:   fmt.Errorf("transition report: no session"),
+			Code:    http.StatusUnauthorized,
+			Message: "Unauthorized.",
+		}
+	}
+
+	data.DisasterReportID = r.PathValue("reportId")
+	data.Actor = actorFromSession(caller)
+
+	event, err := s.repository.TransitionReport(ctx, data)
+	if err != nil {
+		if errors.Is(err, errReportNotFound) {
+			return api.Response{
+				Error:   fmt.Errorf("transition report: %w", err),
+				Code:    http.StatusNotFound,
+				Message: "Disaster report not found.",
+			}
+		}
+
+		if errors.Is(err, errNotAssignedToCaller) {
+			return api.Response{
+				Error:   fmt.Errorf("transition report: %w", err),
+				Code:    http.StatusForbidden,
+				Message: "Only the assigned responder can update this report.",
+			}
+		}
+
+		if errors.Is(err, errInvalidTransition) {
+			return api.Response{
+				Error:   fmt.Errorf("transition report: %w", err),
+				Code:    http.StatusConflict,
+				Message: "The report can't be moved to this state.",
+			}
+		}
+
+		return api.Response{
+			Error:   fmt.Errorf("transition report: %w", err),
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to update report state.",
+		}
+	}
+
+	return api.Response{
+		Code:    http.StatusOK,
+		Message: "Successfully updated report state.",
+		Data:    event,
+	}
+}
+
+func (s *Server) AddReportUpdate(w http.ResponseWriter, r *http.Request) api.Response {
+	ctx := r.Context()
+
+	var data addReportUpdateRequest
+
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&data); err != nil {
+		return api.Response{
+			Error:   fmt.Errorf("add report update: %w", err),
+			Code:    http.StatusBadRequest,
+			Message: "Invalid report update request.",
+		}
+	}
+
+	if data.Status != nil && data.Status.severity() == 0 {
+		return api.Response{
+			Error:   fmt.Errorf("add report update: unknown status %q", *data.Status),
+			Code:    http.StatusBadRequest,
+			Message: "Invalid report update request.",
+		}
+	}
+
+	caller, ok := user.SessionFromContext(ctx)
+	if !ok {
+		return api.Response{
+			Error:   fmt.Errorf("add report update: no session"),
+			Code:    http.StatusUnauthorized,
+			Message: "Unauthorized.",
+		}
+	}
+
+	data.DisasterReportID = r.PathValue("reportId")
+
+	update, err := s.repository.AddReportUpdate(ctx, data, reporterIdentityOf(caller))
+	if err != nil {
+		if errors.Is(err, errEmptyReportUpdate) {
+			return api.Response{
+				Error:   fmt.Errorf("add report update: %w", err),
+				Code:    http.StatusBadRequest,
+				Message: "A status, situation or photo is required.",
+			}
+		}
+
+		if errors.Is(err, errNotOwnPhoto) {
+			return api.Response{
+				Error:   fmt.Errorf("add report update: %w", err),
+				Code:    http.StatusBadRequest,
+				Message: "Photos must be uploaded through /api/photos first.",
+			}
+		}
+
+		if errors.Is(err, errNotOwnReport) {
+			return api.Response{
+				Error:   fmt.Errorf("add report update: %w", err),
+				Code:    http.StatusNotFound,
+				Message: "Disaster report not found.",
+			}
+		}
+
+		if errors.Is(err, errReportClosed) {
+			return api.Response{
+				Error:   fmt.Errorf("add report update: %w", err),
+				Code:    http.StatusConflict,
+				Message: "This report is already closed, file a new one instead.",
+			}
+		}
+
+		return api.Response{
+			Error:   fmt.Errorf("add report update: %w", err),
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to add report update.",
+		}
+	}
+
+	if update.Status != nil {
+		arg := createReportRequest{Status: *update.Status}
+		setReporterIdentity(caller, &arg)
+
+		s.notifyStatusChange(ctx, arg, update.PreviousStatus)
+	}
+
+	return api.Response{
+		Code:    http.StatusCreated,
+		Message: "Successfully added report update.",
+		Data:    update,
+	}
+}
+
+func (s *Server) ListMessages(w http.ResponseWriter, r *http.Request) api.Response {
+	ctx := r.Context()
+
+	caller, ok := user.SessionFromContext(ctx)
+	if !ok {
+		return api.Response{
+			Error:   fmt.Errorf("list messages: no session"),
+			Code:    http.StatusUnauthorized,
+			Message: "Unauthorized.",
+		}
+	}
+
+	limit := defaultMessagesLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		var err error
+
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxMessagesLimit {
+			return api.Response{
+				Error:   fmt.Errorf("list messages: invalid limit %q", value),
+				Code:    http.StatusBadRequest,
+				Message: "Invalid messages limit.",
+			}
+		}
+	}
+
+	var before *string
+	if value := r.URL.Query().Get("cursor"); value != "" {
+		before = &value
+	}
+
+	page, err := s.repository.ListMessages(
+		ctx,
+		r.PathValue("reportId"),
+		reporterIdentityOf(caller),
+		before,
+		limit,
+	)
+	if err != nil {
+		if res, ok := messageErrorResponse(fmt.Errorf("list messages: %w", err)); ok {
+			return res
+		}
+
+		return api.Response{
+			Error:   fmt.Errorf("list messages: %w", err),
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to get messages.",
+		}
+	}
+
+	return api.Response{
+		Code:    http.StatusOK,
+		Message: "Successfully fetched messages.",
+		Data:    page.Messages,
+		Meta:    &api.Meta{NextCursor: page.NextCursor},
+	}
+}
+
+func (s *Server) SendMessage(w http.ResponseWriter, r *http.Request) api.Response {
+	ctx := r.Context()
+
+	var data sendMessageRequest
+
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&data); err != nil {
+		return api.Response{
+			Error:   fmt.Errorf("send message: %w", err),
+			Code:    http.StatusBadRequest,
+			Message: "Invalid send message request.",
+		}
+	}
+
+	caller, ok := user.SessionFromContext(ctx)
+	if !ok {
+		return api.Response{
+			Error:   fmt.Errorf("send message: no session"),
+			Code:    http.StatusUnauthorized,
+			Message: "Unauthorized.",
+		}
+	}
+
+	data.DisasterReportID = r.PathValue("reportId")
+
+	msg, err := s.repository.SendMessage(ctx, data, reporterIdentityOf(caller))
+	if err != nil {
+		if res, ok := messageErrorResponse(fmt.Errorf("send message: %w", err)); ok {
+			return res
+		}
+
+		return api.Response{
+			Error:   fmt.Errorf("send message: %w", err),
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to send message.",
+		}
+	}
+
+	return api.Response{
+		Code:    http.StatusCreated,
+		Message: "Successfully sent message.",
+		Data:    msg,
+	}
+}
+
+func (s *Server) MarkMessages(w http.ResponseWriter, r *http.Request) api.Response {
+	ctx := r.Context()
+
+	var data markMessagesRequest
+
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&data); err != nil {
+		return api.Response{
+			Error:   fmt.Errorf("mark messages: %w", err),
+			Code:    http.StatusBadRequest,
+			Message: "Invalid message receipt request.",
+		}
+	}
+
+	caller, ok := user.SessionFromContext(ctx)
+	if !ok {
+		return api.Response{
+			Error:   fmt.Errorf("mark messages: no session"),
+			Code:    http.StatusUnauthorized,
+			Message: "Unauthorized.",
+		}
+	}
+
+	data.DisasterReportID = r.PathValue("reportId")
+
+	receipt, err := s.repository.MarkMessages(ctx, data, reporterIdentityOf(caller))
+	if err != nil {
+		if res, ok := messageErrorResponse(fmt.Errorf("mark messages: %w", err)); ok {
+			return res
+		}
+
+		return api.Response{
+			Error:   fmt.Errorf("mark messages: %w", err),
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to mark messages.",
+		}
+	}
+
+	return api.Response{
+		Code:    http.StatusOK,
+		Message: "Successfully marked messages.",
+		Data:    receipt,
+	}
+}
+
+func (s *Server) ListIncidents(w http.ResponseWriter, r *http.Request) api.Response {
+	ctx := r.Context()
+
+	var status *incidentStatus
+	if value := incidentStatus(r.URL.Query().Get("status")); value != "" {
+		if !value.isValid() {
+			return api.Response{
+				Error:   fmt.Errorf("list incidents: invalid status %q", value),
+				Code:    http.StatusBadRequest,
+				Message: "Incident status must be active or closed.",
+			}
+		}
+
+		status = &value
+	}
+
+	incidents, err := s.repository.ListIncidents(ctx, status)
+	if err != nil {
+		return api.Response{
+			Error:   fmt.Errorf("list incidents: %w", err),
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to get incidents.",
+		}
+	}
+
+	return api.Response{
+		Code:    http.StatusOK,
+		Message: "Successfully fetched incidents.",
+		Data:    incidents,
+	}
+}
+
+func (s *Server) GetIncident(w http.ResponseWriter, r *http.Request) api.Response {
+	ctx := r.Context()
+
+	incident, err := s.repository.GetIncident(ctx, r.PathValue("incidentId"))
+	if err != nil {
+		if errors.Is(err, errIncidentNotFound) {
+			return api.Response{
+				Error:   fmt.Errorf("get incident: %w", err),
+				Code:    http.StatusNotFound,
+				Message: "Incident not found.",
+			}
+		}
+
+		return api.Response{
+			Error:   fmt.Errorf("get incident: %w", err),
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to get incident.",
+		}
+	}
+
+	return api.Response{
+		Code:    http.StatusOK,
+		Message: "Successfully fetched incident.",
+		Data:    incident,
+	}
+}
+
+func (s *Server) CreateIncident(w http.ResponseWriter, r *http.Request) api.Response {
+	ctx := r.Context()
+
+	var data createIncidentRequest
+
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&data); err != nil {
+		return api.Response{
+			Error:   fmt.Errorf("create incident: %w", err),
+			Code:    http.StatusBadRequest,
+			Message: "Invalid incident request.",
+		}
+	}
+
+	incident, err := s.repository.CreateIncident(ctx, data)
+	if err != nil {
+		if errors.Is(err, errInvalidIncident) {
+			return api.Response{
+				Error:   fmt.Errorf("create incident: %w", err),
+				Code:    http.StatusBadRequest,
+				Message: "Incidents need a name, a type and a geofence of at least 3 points.",
+			}
+		}
+
+		return api.Response{
+			Error:   fmt.Errorf("create incident: %w", err),
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to create incident.",
+		}
+	}
+
+	return api.Response{
+		Code:    http.StatusCreated,
+		Message: "Successfully created incident.",
+		Data:    incident,
+	}
+}
+
+func (s *Server) UpdateIncident(w http.ResponseWriter, r *http.Request) api.Response {
+	ctx := r.Context()
+
+	var data updateIncidentRequest
+
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&data); err != nil {
+		return api.Response{
+			Error:   fmt.Errorf("update incident: %w", err),
+			Code:    http.StatusBadRequest,
+			Message: "Invalid incident request.",
+		}
+	}
+
+	data.IncidentID = r.PathValue("incidentId")
+
+	incident, err := s.repository.UpdateIncident(ctx, data)
+	if err != nil {
+		switch {
+		case errors.Is(err, errInvalidIncident):
+			return api.Response{
+				Error:   fmt.Errorf("update incident: %w", err),
+				Code:    http.StatusBadRequest,
+				Message: "Invalid incident request.",
+			}
+
+		case errors.Is(err, errIncidentNotFound):
+			return api.Response{
+				Error:   fmt.Errorf("update incident: %w", err),
+				Code:    http.StatusNotFound,
+				Message: "Incident not found.",
+			}
+		}
+
+		return api.Response{
+			Error:   fmt.Errorf("update incident: %w", err),
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to update incident.",
+		}
+	}
+
+	return api.Response{
+		Code:    http.StatusOK,
+		Message: "Successfully updated incident.",
+		Data:    incident,
+	}
+}
+
+func (s *Server) DeleteIncident(w http.ResponseWriter, r *http.Request) api.Response {
+	ctx := r.Context()
+
+	if err := s.repository.DeleteIncident(ctx, r.PathValue("incidentId")); err != nil {
+		if errors.Is(err, errIncidentNotFound) {
+			return api.Response{
+				Error:   fmt.Errorf("delete incident: %w", err),
+				Code:    http.StatusNotFound,
+				Message: "Incident not found.",
+			}
+		}
+
+		return api.Response{
+			Error:   fmt.Errorf("delete incident: %w", err),
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to delete incident.",
+		}
+	}
+
+	return api.Response{
+		Code:    http.StatusOK,
+		Message: "Successfully deleted incident.",
+	}
+}
+
+func (s *Server) SetReportIncident(w http.ResponseWriter, r *http.Request) api.Response {
+	ctx := r.Context()
+
+	var data setReportIncidentRequest
+
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&data); err != nil {
+		return api.Response{
+			Error:   fmt.Errorf("set report incident: %w", err),
+			Code:    http.StatusBadRequest,
+			Message: "Invalid report incident request.",
+		}
+	}
+
+	data.DisasterReportID = r.PathValue("reportId")
+
+	change, err := s.repository.SetReportIncident(ctx, data)
+	if err != nil {
+		switch {
+		case errors.Is(err, errReportNotFound):
+			return api.Response{
+				Error:   fmt.Errorf("set report incident: %w", err),
+				Code:    http.StatusNotFound,
+				Message: "Disaster report not found.",
+			}
+
+		case errors.Is(err, errIncidentNotFound):
+			return api.Response{
+				Error:   fmt.Errorf("set report incident: %w", err),
+				Code:    http.StatusNotFound,
+				Message: "Incident not found.",
+			}
+		}
+
+		return api.Response{
+			Error:   fmt.Errorf("set report incident: %w", err),
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to set report incident.",
+		}
+	}
+
+	return api.Response{
+		Code:    http.StatusOK,
+		Message: "Successfully set report incident.",
+		Data:    change,
+	}
+}
+
+func (s *Server) ListHazardZones(w http.ResponseWriter, r *http.Request) api.Response {
+	ctx := r.Context()
+
+	zones, err := s.repository.ListHazardZones(ctx)
+	if err != nil {
+		return api.Response{
+			Error:   fmt.Errorf("list hazard zones: %w", err),
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to get hazard zones.",
+		}
+	}
+
+	return api.Response{
+		Code:    http.StatusOK,
+		Message: "Successfully fetched hazard zones.",
+		Data:    zones,
+	}
+}
+
+func (s *Server) CreateHazardZone(w http.ResponseWriter, r *http.Request) api.Response {
+	ctx := r.Context()
+
+	var data createHazardZoneRequest
+
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&data); err != nil {
+		return api.Response{
+			Error:   fmt.Errorf("create hazard zone: %w", err),
+			Code:    http.StatusBadRequest,
+			Message: "Invalid hazard zone request.",
+		}
+	}
+
+	zone, err := s.repository.CreateHazardZone(ctx, data)
+	if err != nil {
+		if errors.Is(err, errInvalidHazardZone) {
+			return api.Response{
+				Error:   fmt.Errorf("create hazard zone: %w", err),
+				Code:    http.StatusBadRequest,
+				Message: "Hazard zones need a name and a polygon of at least 3 points.",
+			}
+		}
+
+		return api.Response{
+			Error:   fmt.Errorf("create hazard zone: %w", err),
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to create hazard zone.",
+		}
+	}
+
+	return api.Response{
+		Code:    http.StatusCreated,
+		Message: "Successfully created hazard zone.",
+		Data:    zone,
+	}
+}
+
+func (s *Server) DeleteHazardZone(w http.ResponseWriter, r *http.Request) api.Response {
+	ctx := r.Context()
+
+	if err := s.repository.DeleteHazardZone(ctx, r.PathValue("hazardZoneId")); err != nil {
+		if errors.Is(err, errHazardZoneNotFound) {
+			return api.Response{
+				Error:   fmt.Errorf("delete hazard zone: %w", err),
+				Code:    http.StatusNotFound,
+				Message: "Hazard zone not found.",
+			}
+		}
+
+		return api.Response{
+			Error:   fmt.Errorf("delete hazard zone: %w", err),
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to delete hazard zone.",
+		}
+	}
+
+	return api.Response{
+		Code:    http.StatusOK,
+		Message: "Successfully deleted hazard zone.",
+	}
+}
+
+func (s *Server) ListDuplicateCandidates(w http.ResponseWriter, r *http.Request) api.Response {
+	ctx := r.Context()
+
+	pairs, err := s.repository.ListDuplicateCandidates(ctx, r.PathValue("reportId"))
+	if err != nil {
+		if errors.Is(err, errReportNotFound) {
+			return api.Response{
+				Error:   fmt.Errorf("list duplicate candidates: %w", err),
+				Code:    http.StatusNotFound,
+				Message: "Disaster report not found.",
+			}
+		}
+
+		return api.Response{
+			Error:   fmt.Errorf("list duplicate candidates: %w", err),
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to get duplicate candidates.",
+		}
+	}
+
+	return api.Response{
+		Code:    http.StatusOK,
+		Message: "Successfully fetched duplicate candidates.",
+		Data:    pairs,
+	}
+}
+
+func (s *Server) ListReportClusters(w http.ResponseWriter, r *http.Request) api.Response {
+	ctx := r.Context()
+
+	var incidentID *string
+	if value := r.URL.Query().Get("incidentId"); value != "" {
+		incidentID = &value
+	}
+
+	clusters, err := s.repository.ListReportClusters(ctx, incidentID)
+	if err != nil {
+		return api.Response{
+			Error:   fmt.Errorf("list report clusters: %w", err),
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to get report clusters.",
+		}
+	}
+
+	return api.Response{
+		Code:    http.StatusOK,
+		Message: "Successfully fetched report clusters.",
+		Data:    clusters,
+	}
+}
+
+func (s *Server) MergeReports(w http.ResponseWriter, r *http.Request) api.Response {
+	ctx := r.Context()
+
+	var data mergeReportsRequest
+
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&data); err != nil {
+		return api.Response{
+			Error:   fmt.Errorf("merge reports: %w", err),
+			Code:    http.StatusBadRequest,
+			Message: "Invalid merge reports request.",
+		}
+	}
+
+	caller, ok := user.SessionFromContext(ctx)
+	if !ok {
+		return api.Response{
+			Error:   fmt.Errorf("merge reports: no session"),
+			Code:    http.StatusUnauthorized,
+			Message: "Unauthorized.",
+		}
+	}
+
+	data.DisasterReportID = r.PathValue("reportId")
+	data.Actor = actorFromSession(caller)
+
+	merge, err := s.repository.MergeReports(ctx, data)
+	if err != nil {
+		switch {
+		case errors.Is(err, errReportNotFound):
+			return api.Response{
+				Error:   fmt.Errorf("merge reports: %w", err),
+				Code:    http.StatusNotFound,
+				Message: "Disaster report not found.",
+			}
+
+		case errors.Is(err, errInvalidMerge):
+			return api.Response{
+				Error:   fmt.Errorf("merge reports: %w", err),
+				Code:    http.StatusBadRequest,
+				Message: "Reports can only be merged into another report that isn't merged itself.",
+			}
+
+		case errors.Is(err, errConflictingResponders):
+			return api.Response{
+				Error:   fmt.Errorf("merge reports: %w", err),
+				Code:    http.StatusConflict,
+				Message: "Reports assigned to different responders can't be merged.",
+			}
+		}
+
+		return api.Response{
+			Error:   fmt.Errorf("merge reports: %w", err),
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to merge reports.",
+		}
+	}
+
+	return api.Response{
+		Code:    http.StatusOK,
+		Message: "Successfully merged reports.",
+		Data:    merge,
+	}
+}
+
+func (s *Server) LinkReports(w http.ResponseWriter, r *http.Request) api.Response {
+	ctx := r.Context()
+
+	var data linkReportsRequest
+
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&data); err != nil {
+		return api.Response{
+			Error:   fmt.Errorf("link reports: %w", err),
+			Code:    http.StatusBadRequest,
+			Message: "Invalid link reports request.",
+		}
+	}
+
+	caller, ok := user.SessionFromContext(ctx)
+	if !ok {
+		return api.Response{
+			Error:   fmt.Errorf("link reports: no session"),
+			Code:    http.StatusUnauthorized,
+			Message: "Unauthorized.",
+		}
+	}
+
+	data.DisasterReportID = r.PathValue("reportId")
+	data.Actor = actorFromSession(caller)
+
+	link, err := s.repository.LinkReports(ctx, data)
+	if err != nil {
+		switch {
+		case errors.Is(err, errReportNotFound):
+			return api.Response{
+				Error:   fmt.Errorf("link reports: %w", err),
+				Code:    http.StatusNotFound,
+				Message: "Disaster report not found.",
+			}
+
+		case errors.Is(err, errInvalidLink):
+			return api.Response{
+				Error:   fmt.Errorf("link reports: %w", err),
+				Code:    http.StatusBadRequest,
+				Message: "A report can only be linked to another report.",
+			}
+		}
+
+		return api.Response{
+			Error:   fmt.Errorf("link reports: %w", err),
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to link reports.",
+		}
+	}
+
+	return api.Response{
+		Code:    http.StatusCreated,
+		Message: "Successfully linked reports.",
+		Data:    link,
+	}
+}
+
+func (s *Server) UnlinkReports(w http.ResponseWriter, r *http.Request) api.Response {
+	ctx := r.Context()
+
+	err := s.repository.UnlinkReports(ctx, r.PathValue("reportId"), r.PathValue("linkedReportId"))
+	if err != nil {
+		if errors.Is(err, errLinkNotFound) {
+			return api.Response{
+				Error:   fmt.Errorf("unlink reports: %w", err),
+				Code:    http.StatusNotFound,
+				Message: "Report link not found.",
+			}
+		}
+
+		return api.Response{
+			Error:   fmt.Errorf("unlink reports: %w", err),
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to unlink reports.",
+		}
+	}
+
+	return api.Response{
+		Code:    http.StatusOK,
+		Message: "Successfully unlinked reports.",
+	}
+}
+
+// Responses for the errors every message handler can return. Callers who
+// aren't in the thread are told the report doesn't exist.
+func messageErrorResponse(err error) (api.Response, bool) {
+	switch {
+	case errors.Is(err, errReportNotFound), errors.Is(err, errNotParticipant):
+		return api.Response{
+			Error:   err,
+			Code:    http.StatusNotFound,
+			Message: "Disaster report not found.",
+		}, true
+
+	case errors.Is(err, errInvalidMessage):
+		return api.Response{
+			Error:   err,
+			Code:    http.StatusBadRequest,
+			Message: fmt.Sprintf("Messages must have 1 to %d characters.", maxMessageLength),
+		}, true
+
+	case errors.Is(err, errInvalidReceipt):
+		return api.Response{
+			Error:   err,
+			Code:    http.StatusBadRequest,
+			Message: "Receipt must be delivered or read.",
+		}, true
+	}
+
+	return api.Response{}, false
+}
+
+// Who the caller is to a report's reporter and responder. Only one of the two
+// is set, so an anonymous ID never matches a user or the other way around.
+type reporterIdentity struct {
+	UserID      *string
+	AnonymousID *string
+}
+
+// Anonymous callers don't have a `users` row, so their reporter is tracked by
+// the anonymous ID until they claim it with an account.
+func reporterIdentityOf(caller user.SessionValidationResponse) reporterIdentity {
+	if caller.IsAnonymous {
+		return reporterIdentity{AnonymousID: &caller.User.UserID}
+	}
+
+	return reporterIdentity{UserID: &caller.User.UserID}
+}
+
+// Staff and partner agencies may read any reporter's reports. API keys were
+// already checked for the reports read scope by the policy middleware.
+func isStaff(caller user.SessionValidationResponse) bool {
+	role := caller.Role()
+
+	return caller.APIKey != nil ||
+		role == user.Responder || role == user.Dispatcher || role == user.Admin
+}
+
+func setReporterIdentity(caller user.SessionValidationResponse, arg *createReportRequest) {
+	identity := reporterIdentityOf(caller)
+
+	arg.UserID = identity.UserID
+	arg.AnonymousID = identity.AnonymousID
+}
+
+var errMissingResponder = errors.New("missing responder")
+
+// Responders can only take reports themselves, while dispatchers and admins
+// assign them on a responder's behalf. Partner agencies using API keys may also
+// assign their own responders, who don't have an account, by name.
+func assignResponder(caller user.SessionValidationResponse, arg *setResponderRequest) error {
+	if caller.Role() == user.Responder {
+		arg.Responder.UserID = &caller.User.UserID
+		return nil
+	}
+
+	if caller.APIKey != nil && arg.Responder.UserID == nil && arg.Responder.Name != "" {
+		return nil
+	}
+
+	if arg.Responder.UserID == nil || *arg.Responder.UserID == "" {
+		return errMissingResponder
+	}
+
+	return nil
+}
@@ -0,0 +1,174 @@
+package disaster
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/InternalPointerVariable/ResQLink-Backend/internal/user"
+)
+
+func TestSetReporterIdentity(t *testing.T) {
+	tests := []struct {
+		name            string
+		caller          user.SessionValidationResponse
+		wantUserID      *string
+		wantAnonymousID *string
+	}{
+		{
+			name:            "anonymous caller",
+			caller:          anonymousCaller("anon_ABC"),
+			wantAnonymousID: ptr("anon_ABC"),
+		},
+		{
+			name:       "signed in caller",
+			caller:     signedInCaller("user-1"),
+			wantUserID: ptr("user-1"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var arg createReportRequest
+
+			body := `{"userId": "victim", "name": "Juan", "status": "safe"}`
+			if err := json.Unmarshal([]byte(body), &arg); err != nil {
+				t.Fatal(err)
+			}
+
+			if arg.UserID != nil {
+				t.Fatalf("userId was read from the body: %q", *arg.UserID)
+			}
+
+			setReporterIdentity(tt.caller, &arg)
+
+			if !equalPtr(arg.UserID, tt.wantUserID) {
+				t.Errorf("UserID = %v, want %v", deref(arg.UserID), deref(tt.wantUserID))
+			}
+
+			if !equalPtr(arg.AnonymousID, tt.wantAnonymousID) {
+				t.Errorf("AnonymousID = %v, want %v", deref(arg.AnonymousID), deref(tt.wantAnonymousID))
+			}
+		})
+	}
+}
+
+// reporterRepository answers for a single reporter owned by `owner`. Methods
+// the handlers under test don't call panic through the nil `Repository`.
+type reporterRepository struct {
+	Repository
+	reporterID string
+	owner      reporterIdentity
+}
+
+func (r reporterRepository) IsOwnReporter(
+	_ context.Context,
+	reporterID string,
+	caller reporterIdentity,
+) (bool, error) {
+	isOwn := reporterID == r.reporterID &&
+		(caller.UserID != nil && equalPtr(caller.UserID, r.owner.UserID) ||
+			caller.AnonymousID != nil && equalPtr(caller.AnonymousID, r.owner.AnonymousID))
+
+	return isOwn, nil
+}
+
+func (r reporterRepository) ListDisasterReportsByReporter(
+	_ context.Context,
+	reporterID string,
+) (reportsByReporterResponse, error) {
+	if reporterID != r.reporterID {
+		return reportsByReporterResponse{}, errReporterNotFound
+	}
+
+	return reportsByReporterResponse{Reporter: reporter{ReporterID: reporterID}}, nil
+}
+
+func TestListDisasterReportsByReporter(t *testing.T) {
+	const reporterID = "6f1c2a7e-3b4d-4e5f-8a9b-0c1d2e3f4a5b"
+
+	repo := reporterRepository{
+		reporterID: reporterID,
+		owner:      reporterIdentity{UserID: ptr("user-1")},
+	}
+
+	dispatcher := signedInCaller("user-3")
+	dispatcher.User.Role = user.Dispatcher
+
+	tests := []struct {
+		name     string
+		caller   user.SessionValidationResponse
+		wantCode int
+	}{
+		{
+			name:     "own reporter",
+			caller:   signedInCaller("user-1"),
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "another citizen's reporter",
+			caller:   signedInCaller("user-2"),
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "anonymous caller with the same ID as the owner",
+			caller:   anonymousCaller("user-1"),
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "dispatcher",
+			caller:   dispatcher,
+			wantCode: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Server{repository: repo}
+
+			r := httptest.NewRequest(http.MethodGet, "/api/reporters/"+reporterID+"/reports", nil)
+			r.SetPathValue("reporterId", reporterID)
+			r = r.WithContext(user.WithSession(r.Context(), tt.caller))
+
+			res := s.ListDisasterReportsByReporter(httptest.NewRecorder(), r)
+			if res.Code != tt.wantCode {
+				t.Errorf("Code = %d, want %d", res.Code, tt.wantCode)
+			}
+		})
+	}
+}
+
+func anonymousCaller(anonID string) user.SessionValidationResponse {
+	caller := user.SessionValidationResponse{IsAnonymous: true}
+	caller.User.UserID = anonID
+	return caller
+}
+
+func signedInCaller(userID string) user.SessionValidationResponse {
+	caller := user.SessionValidationResponse{}
+	caller.User.UserID = userID
+	caller.User.Role = user.Citizen
+	return caller
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func equalPtr[T comparable](a, b *T) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return *a == *b
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return "<nil>"
+	}
+
+	return *s
+}
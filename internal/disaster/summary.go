@@ -0,0 +1,258 @@
+package disaster
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/InternalPointerVariable/ResQLink-Backend/internal/situation"
+	"github.com/jackc/pgx/v5"
+	"github.com/redis/go-redis/v9"
+)
+
+// SituationSummarizer turns what the citizen said into a summary responders can
+// read at a glance. See the `situation` package for the implementations.
+type SituationSummarizer interface {
+	Summarize(ctx context.Context, report situation.Report) (situation.Summary, error)
+}
+
+const (
+	// Redis list of the IDs of reports to summarize. Any server's worker can
+	// take them.
+	summaryQueue = "disaster:summary_queue"
+
+	// Reports being summarized are moved here until they're done, so the ones
+	// taken by a worker that stopped halfway aren't lost
+	summaryProcessing = "disaster:summary_processing"
+
+	situationSummarized = "disaster:situation_summarized" // Broadcast after every summary
+
+	summaryAttempts = 3
+	summaryTimeout  = 30 * time.Second // For each attempt
+	summaryBackoff  = 2 * time.Second  // Doubled after each failed attempt
+)
+
+type situationSummary struct {
+	DisasterReportID string            `json:"reportId"`
+	Summary          situation.Summary `json:"summary"`
+}
+
+// enqueueSummary summarizes the report again in the background, reports are
+// summarized as a whole with all of their follow-ups.
+func (r *repository) enqueueSummary(ctx context.Context, reportID string) error {
+	return r.redisClient.LPush(ctx, summaryQueue, reportID).Err()
+}
+
+// SummaryWorker summarizes reports' situations as they're created or followed
+// up on, and broadcasts the summaries to dashboards.
+type SummaryWorker struct {
+	repository  Repository
+	redisClient *redis.Client
+	summarizer  SituationSummarizer
+}
+
+func NewSummaryWorker(
+	repository Repository,
+	redisClient *redis.Client,
+	summarizer SituationSummarizer,
+) *SummaryWorker {
+	return &SummaryWorker{
+		repository:  repository,
+		redisClient: redisClient,
+		summarizer:  summarizer,
+	}
+}
+
+// Start takes reports from the queue one at a time until `ctx` is done.
+func (w *SummaryWorker) Start(ctx context.Context) {
+	if err := w.requeueProcessing(ctx); err != nil {
+		slog.Error(fmt.Errorf("requeue summary jobs: %w", err).Error())
+	}
+
+	for {
+		reportID, err := w.redisClient.BLMove(
+			ctx,
+			summaryQueue,
+			summaryProcessing,
+			"RIGHT",
+			"LEFT",
+			0,
+		).Result()
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+
+			slog.Error(fmt.Errorf("take summary job: %w", err).Error())
+			time.Sleep(summaryBackoff)
+
+			continue
+		}
+
+		if err := w.summarize(ctx, reportID); err != nil {
+			slog.Error(fmt.Errorf("summarize situation of %s: %w", reportID, err).Error())
+
+			// Left for the next start to retry
+			if ctx.Err() != nil {
+				return
+			}
+		}
+
+		if err := w.redisClient.LRem(ctx, summaryProcessing, 1, reportID).Err(); err != nil {
+			slog.Error(fmt.Errorf("finish summary job %s: %w", reportID, err).Error())
+		}
+	}
+}
+
+// requeueProcessing puts back the reports workers took but never finished. It
+// can also take the ones other servers' workers are summarizing right now, which
+// are then summarized twice, but `saveSummary` keeps the latest either way.
+func (w *SummaryWorker) requeueProcessing(ctx context.Context) error {
+	for {
+		err := w.redisClient.LMove(ctx, summaryProcessing, summaryQueue, "RIGHT", "RIGHT").Err()
+		if errors.Is(err, redis.Nil) {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (w *SummaryWorker) summarize(ctx context.Context, reportID string) error {
+	report, readAt, err := w.repository.getSituation(ctx, reportID)
+	if err != nil {
+		// Erased since it was queued
+		if errors.Is(err, errReportNotFound) {
+			return nil
+		}
+
+		return err
+	}
+
+	var summary situation.Summary
+
+	backoff := summaryBackoff
+
+	for attempt := 1; ; attempt++ {
+		attemptCtx, cancel := context.WithTimeout(ctx, summaryTimeout)
+		summary, err = w.summarizer.Summarize(attemptCtx, report)
+		cancel()
+
+		if err == nil {
+			break
+		}
+
+		if attempt == summaryAttempts {
+			return fmt.Errorf("%d attempts: %w", attempt, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+	}
+
+	return w.repository.saveSummary(ctx, reportID, summary, readAt)
+}
+
+// getSituation also returns when the report was read, see `saveSummary`.
+func (r *repository) getSituation(
+	ctx context.Context,
+	reportID string,
+) (situation.Report, time.Time, error) {
+	query := `
+	SELECT
+		disaster_reports.status,
+		disaster_reports.raw_situation,
+		COALESCE(
+			(
+				SELECT array_agg(raw_situation ORDER BY created_at)
+				FROM report_updates
+				WHERE report_updates.disaster_report_id = disaster_reports.disaster_report_id
+					AND raw_situation IS NOT NULL
+					AND raw_situation != ''
+			),
+			'{}'
+		),
+		COALESCE(
+			(
+				SELECT array_agg(photo_url)
+				FROM disaster_photos
+				WHERE disaster_photos.disaster_report_id = disaster_reports.disaster_report_id
+			),
+			'{}'
+		),
+		NOW()
+	FROM disaster_reports
+	WHERE disaster_report_id = ($1)
+	`
+
+	var report situation.Report
+	var readAt time.Time
+
+	row := r.querier.QueryRow(ctx, query, reportID)
+	if err := row.Scan(
+		&report.Status,
+		&report.RawSituation,
+		&report.Updates,
+		&report.PhotoURLs,
+		&readAt,
+	); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return situation.Report{}, time.Time{}, errReportNotFound
+		}
+
+		return situation.Report{}, time.Time{}, err
+	}
+
+	return report, readAt, nil
+}
+
+// saveSummary keeps the summary unless one made from a later read of the report
+// was already saved, since workers can finish out of order. Saved summaries are
+// broadcast.
+func (r *repository) saveSummary(
+	ctx context.Context,
+	reportID string,
+	summary situation.Summary,
+	readAt time.Time,
+) error {
+	byt, err := json.Marshal(summary)
+	if err != nil {
+		return err
+	}
+
+	query := `
+	UPDATE disaster_reports
+	SET ai_summary = ($1), ai_gen_situation = ($2), ai_summarized_at = ($3)
+	WHERE disaster_report_id = ($4)
+		AND (ai_summarized_at IS NULL OR ai_summarized_at < ($3))
+	`
+
+	tag, err := r.querier.Exec(ctx, query, byt, summary.Text, readAt, reportID)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return nil
+	}
+
+	// People, injuries and hazards count towards the priority
+	if err := r.updatePriorities(ctx, reportID); err != nil {
+		return err
+	}
+
+	return r.broadcast(ctx, reportID, situationSummarized, situationSummary{
+		DisasterReportID: reportID,
+		Summary:          summary,
+	})
+}
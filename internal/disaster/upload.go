@@ -1,17 +1,23 @@
 package disaster
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"mime/multipart"
 	"net/http"
-	"os"
-	"path/filepath"
-	"strings"
+	"slices"
+	"strconv"
 	"time"
+
+	"github.com/InternalPointerVariable/ResQLink-Backend/internal/api"
+	"github.com/InternalPointerVariable/ResQLink-Backend/internal/storage"
+	"github.com/InternalPointerVariable/ResQLink-Backend/internal/user"
+	"github.com/jackc/pgx/v5"
 )
 
 func randomHex(n int) (string, error) {
@@ -22,34 +28,63 @@ func randomHex(n int) (string, error) {
 	return hex.EncodeToString(bytes), nil
 }
 
-var errInvalidFileType = errors.New("invalid file type")
+var (
+	errInvalidFileType = errors.New("invalid file type")
+	errPhotoNotFound   = errors.New("photo not found")
+	errNotOwnPhoto     = errors.New("photo was not uploaded by caller")
+)
+
+// Extensions of the image types citizens can upload, by detected content type
+var photoExtensions = map[string]string{
+	"image/jpeg": "jpg",
+	"image/png":  "png",
+	"image/gif":  "gif",
+	"image/webp": "webp",
+}
+
+// photoURL is where the photo is served from, see `GetPhoto`. It's stored as the
+// photo's URL, so `BASE_URL` must not change once photos are uploaded.
+func (s *Server) photoURL(key string) string {
+	return fmt.Sprintf("%s/api/photos/%s", s.baseURL, key)
+}
+
+type uploadedPhoto struct {
+	PhotoID  string `json:"id"` // Passed in `photoIds` of reports and follow-ups
+	PhotoURL string `json:"url"`
+}
 
-func uploadPhoto(fileHeader *multipart.FileHeader, baseURL string) (string, error) {
+// uploadPhoto stores the photo as uploaded by `owner`, the only one who can
+// attach it to a report.
+func (s *Server) uploadPhoto(
+	ctx context.Context,
+	owner reporterIdentity,
+	fileHeader *multipart.FileHeader,
+) (uploadedPhoto, error) {
 	file, err := fileHeader.Open()
 	if err != nil {
-		return "", err
+		return uploadedPhoto{}, err
 	}
 	defer file.Close()
 
 	buffer := make([]byte, 512)
-	if _, err = file.Read(buffer); err != nil {
-		return "", err
+	n, err := file.Read(buffer)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return uploadedPhoto{}, err
 	}
 
 	if _, err = file.Seek(0, io.SeekStart); err != nil {
-		return "", err
+		return uploadedPhoto{}, err
 	}
 
-	fileType := http.DetectContentType(buffer)
-	if !strings.HasPrefix(fileType, "image/") {
-		return "", err
+	fileType := http.DetectContentType(buffer[:n])
+	ext, ok := photoExtensions[fileType]
+	if !ok {
+		return uploadedPhoto{}, errInvalidFileType
 	}
 
-	// TODO: Extension should depend on what the file type is, but this works for now.
-	ext := "jpg"
 	suffix, err := randomHex(3)
 	if err != nil {
-		return "", fmt.Errorf("upload photo: failed to generate random suffix: %w", err)
+		return uploadedPhoto{}, fmt.Errorf("upload photo: failed to generate random suffix: %w", err)
 	}
 	now := time.Now()
 	fileName := fmt.Sprintf(
@@ -60,23 +95,280 @@ func uploadPhoto(fileHeader *multipart.FileHeader, baseURL string) (string, erro
 		ext,
 	)
 
-	uploadDir := "_temp/photos"
-	if err := os.MkdirAll(uploadDir, os.ModePerm); err != nil {
-		return "", err
+	if err := s.storage.Put(ctx, fileName, fileType, file, fileHeader.Size); err != nil {
+		return uploadedPhoto{}, err
+	}
+
+	photo := uploadedPhoto{PhotoID: fileName, PhotoURL: s.photoURL(fileName)}
+
+	if err := s.repository.CreateUpload(ctx, photo, owner); err != nil {
+		return uploadedPhoto{}, err
 	}
 
-	filePath := filepath.Join(uploadDir, fileName)
-	fileURL := fmt.Sprintf("%s/%s", baseURL, filePath)
+	return photo, nil
+}
+
+func (r *repository) CreateUpload(
+	ctx context.Context,
+	photo uploadedPhoto,
+	owner reporterIdentity,
+) error {
+	query := `
+	INSERT INTO uploads (upload_key, photo_url, user_id, anonymous_id)
+	VALUES ($1, $2, $3, $4)
+	`
+
+	_, err := r.querier.Exec(ctx, query, photo.PhotoID, photo.PhotoURL, owner.UserID, owner.AnonymousID)
+
+	return err
+}
+
+// Who uploaded a photo
+type upload struct {
+	UserID      *string
+	AnonymousID *string
+	IsAttached  bool // To a report or a follow-up
+}
 
-	dest, err := os.Create(filePath)
+func (u upload) isOwnedBy(caller reporterIdentity) bool {
+	if u.UserID != nil {
+		return caller.UserID != nil && *caller.UserID == *u.UserID
+	}
+
+	return u.AnonymousID != nil && caller.AnonymousID != nil && *caller.AnonymousID == *u.AnonymousID
+}
+
+func (r *repository) GetUpload(ctx context.Context, photoID string) (upload, error) {
+	query := `
+	SELECT
+		user_id,
+		anonymous_id,
+		EXISTS (SELECT 1 FROM disaster_photos WHERE disaster_photos.photo_url = uploads.photo_url)
+	FROM uploads
+	WHERE upload_key = ($1)
+	`
+
+	var res upload
+
+	row := r.querier.QueryRow(ctx, query, photoID)
+	if err := row.Scan(&res.UserID, &res.AnonymousID, &res.IsAttached); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return upload{}, errPhotoNotFound
+		}
+
+		return upload{}, err
+	}
+
+	return res, nil
+}
+
+// attachPhotos attaches the photos `owner` uploaded to the report, or to one of
+// its follow-ups when `updateID` is set. It returns their URLs, and fails with
+// `errNotOwnPhoto` when any photo isn't theirs.
+func attachPhotos(
+	ctx context.Context,
+	tx pgx.Tx,
+	owner reporterIdentity,
+	photoIDs []string,
+	reportID string,
+	updateID *string,
+) ([]string, error) {
+	photoURLs := []string{}
+
+	if len(photoIDs) == 0 {
+		return photoURLs, nil
+	}
+
+	query := `
+	SELECT upload_key, photo_url FROM uploads
+	WHERE upload_key = ANY($1) AND (user_id = ($2) OR anonymous_id = ($3))
+	`
+
+	rows, err := tx.Query(ctx, query, photoIDs, owner.UserID, owner.AnonymousID)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	defer dest.Close()
 
-	if _, err := io.Copy(dest, file); err != nil {
-		return "", err
+	owned := map[string]string{}
+
+	var photoID, photoURL string
+	if _, err := pgx.ForEachRow(rows, []any{&photoID, &photoURL}, func() error {
+		owned[photoID] = photoURL
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	for _, photoID := range photoIDs {
+		photoURL, ok := owned[photoID]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", errNotOwnPhoto, photoID)
+		}
+
+		if !slices.Contains(photoURLs, photoURL) {
+			photoURLs = append(photoURLs, photoURL)
+		}
+	}
+
+	query = `
+	INSERT INTO disaster_photos (photo_url, disaster_report_id, report_update_id)
+	VALUES ($1, $2, $3)
+	`
+
+	for _, photoURL := range photoURLs {
+		if _, err := tx.Exec(ctx, query, photoURL, reportID, updateID); err != nil {
+			return nil, err
+		}
+	}
+
+	return photoURLs, nil
+}
+
+func (s *Server) UploadPhoto(w http.ResponseWriter, r *http.Request) api.Response {
+	ctx := r.Context()
+
+	const maxBodySize = 10 << 20
+	r.Body = http.MaxBytesReader(w, r.Body, maxBodySize)
+
+	if err := r.ParseMultipartForm(maxBodySize); err != nil {
+		return api.Response{
+			Error:   fmt.Errorf("upload photo: %w", err),
+			Code:    http.StatusBadRequest,
+			Message: "Failed to parse photo form data.",
+		}
+	}
+
+	caller, ok := user.SessionFromContext(ctx)
+	if !ok {
+		return api.Response{
+			Error:   fmt.Errorf("upload photo: no session"),
+			Code:    http.StatusUnauthorized,
+			Message: "Unauthorized.",
+		}
+	}
+
+	photos := r.MultipartForm.File["photo"]
+	if len(photos) != 1 {
+		return api.Response{
+			Error:   fmt.Errorf("upload photo: %d photos", len(photos)),
+			Code:    http.StatusBadRequest,
+			Message: "Exactly one photo is required.",
+		}
+	}
+
+	photo, err := s.uploadPhoto(ctx, reporterIdentityOf(caller), photos[0])
+	if err != nil {
+		if errors.Is(err, errInvalidFileType) {
+			return api.Response{
+				Error:   fmt.Errorf("upload photo: %w", err),
+				Code:    http.StatusBadRequest,
+				Message: "Photos must be JPEG, PNG, GIF or WebP images.",
+			}
+		}
+
+		return api.Response{
+			Error:   fmt.Errorf("upload photo: %w", err),
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to upload photo.",
+		}
+	}
+
+	return api.Response{
+		Code:    http.StatusCreated,
+		Message: "Successfully uploaded photo.",
+		Data:    photo,
+	}
+}
+
+// GetPhoto writes the photo itself, only failures are sent as JSON. Citizens
+// can only see the photos they uploaded, and staff only the ones attached to a
+// report.
+func (s *Server) GetPhoto(w http.ResponseWriter, r *http.Request) {
+	res := s.getPhoto(w, r)
+	if res == nil {
+		return
+	}
+
+	if res.Error != nil {
+		slog.Error(res.Error.Error())
+	}
+
+	if err := res.Encode(w); err != nil {
+		slog.Error(err.Error())
+	}
+}
+
+// getPhoto returns `nil` once the photo is written.
+func (s *Server) getPhoto(w http.ResponseWriter, r *http.Request) *api.Response {
+	ctx := r.Context()
+
+	caller, ok := user.SessionFromContext(ctx)
+	if !ok {
+		return &api.Response{
+			Error:   fmt.Errorf("get photo: no session"),
+			Code:    http.StatusUnauthorized,
+			Message: "Unauthorized.",
+		}
+	}
+
+	key := r.PathValue("photoId")
+
+	upload, err := s.repository.GetUpload(ctx, key)
+	if err != nil {
+		if errors.Is(err, errPhotoNotFound) {
+			return &api.Response{
+				Error:   fmt.Errorf("get photo: %w", err),
+				Code:    http.StatusNotFound,
+				Message: "Photo not found.",
+			}
+		}
+
+		return &api.Response{
+			Error:   fmt.Errorf("get photo: %w", err),
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to get photo.",
+		}
+	}
+
+	if !upload.isOwnedBy(reporterIdentityOf(caller)) && !(isStaff(caller) && upload.IsAttached) {
+		return &api.Response{
+			Error:   fmt.Errorf("get photo: %w", errNotOwnPhoto),
+			Code:    http.StatusNotFound,
+			Message: "Photo not found.",
+		}
+	}
+
+	obj, err := s.storage.Get(ctx, key)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) || errors.Is(err, storage.ErrInvalidKey) {
+			return &api.Response{
+				Error:   fmt.Errorf("get photo: %w", err),
+				Code:    http.StatusNotFound,
+				Message: "Photo not found.",
+			}
+		}
+
+		return &api.Response{
+			Error:   fmt.Errorf("get photo: %w", err),
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to get photo.",
+		}
+	}
+	defer obj.Body.Close()
+
+	w.Header().Set("Content-Type", obj.ContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	// Photos never change once uploaded, but only the caller may keep them
+	w.Header().Set("Cache-Control", "private, max-age=86400, immutable")
+	if obj.Size >= 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(obj.Size, 10))
+	}
+
+	w.WriteHeader(http.StatusOK)
+
+	if _, err := io.Copy(w, obj.Body); err != nil {
+		slog.Error(fmt.Errorf("get photo: %w", err).Error())
 	}
 
-	return fileURL, nil
+	return nil
 }
@@ -3,7 +3,9 @@ package disaster
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 
+	"github.com/InternalPointerVariable/ResQLink-Backend/internal/user"
 	"github.com/InternalPointerVariable/ResQLink-Backend/internal/ws"
 )
 
@@ -18,12 +20,19 @@ func NewSocketServer(repository Repository) *SocketServer {
 }
 
 const (
-	createReport = "disaster:create_report" // Used as a PubSub channel
+	createReport = "disaster:create_report" // Broadcast after every new report
 	saveLocation = "disaster:save_location"
 	setResponder = "disaster:set_responder"
+
+	// The event is broadcast as `reportTransitioned`
+	transitionReport = "disaster:transition_report"
 )
 
 func (s *SocketServer) Handle(ctx context.Context, msg ws.Message) (ws.Message, error) {
+	if err := user.Authorize(ctx, msg.Event); err != nil {
+		return ws.Message{}, err
+	}
+
 	switch msg.Event {
 	case saveLocation:
 		var req saveLocationRequest
@@ -31,11 +40,21 @@ func (s *SocketServer) Handle(ctx context.Context, msg ws.Message) (ws.Message,
 			return ws.Message{}, err
 		}
 
-		if err := s.repository.SaveLocation(ctx, req); err != nil {
+		caller, _ := user.SessionFromContext(ctx)
+		incidentID, err := s.repository.SaveLocation(ctx, req, reporterIdentityOf(caller))
+		if err != nil {
 			return ws.Message{}, err
 		}
 
-		return msg.Response(req)
+		res, err := msg.Response(req)
+		if err != nil {
+			return ws.Message{}, err
+		}
+
+		// Sent to the dashboards subscribed to the reporter's incident too
+		res.IncidentID = incidentID
+
+		return res, nil
 
 	case setResponder:
 		var req setResponderRequest
@@ -43,12 +62,61 @@ func (s *SocketServer) Handle(ctx context.Context, msg ws.Message) (ws.Message,
 			return ws.Message{}, err
 		}
 
+		caller, _ := user.SessionFromContext(ctx)
+		req.Actor = actorFromSession(caller)
+
+		if err := assignResponder(caller, &req); err != nil {
+			return ws.Message{}, fmt.Errorf("set responder: %w", err)
+		}
+
 		resp, err := s.repository.SetResponder(ctx, req)
 		if err != nil {
 			return ws.Message{}, err
 		}
 
 		return msg.Response(resp)
+
+	case transitionReport:
+		var req transitionReportRequest
+		if err := json.Unmarshal(msg.Data, &req); err != nil {
+			return ws.Message{}, err
+		}
+
+		caller, _ := user.SessionFromContext(ctx)
+		req.Actor = actorFromSession(caller)
+
+		if _, err := s.repository.TransitionReport(ctx, req); err != nil {
+			return ws.Message{}, fmt.Errorf("transition report: %w", err)
+		}
+
+		return ws.Message{}, nil
+
+	// Both are sent to the report's participants only, see `sendDirect`
+	case sendMessage:
+		var req sendMessageRequest
+		if err := json.Unmarshal(msg.Data, &req); err != nil {
+			return ws.Message{}, err
+		}
+
+		caller, _ := user.SessionFromContext(ctx)
+		if _, err := s.repository.SendMessage(ctx, req, reporterIdentityOf(caller)); err != nil {
+			return ws.Message{}, fmt.Errorf("send message: %w", err)
+		}
+
+		return ws.Message{}, nil
+
+	case markMessages:
+		var req markMessagesRequest
+		if err := json.Unmarshal(msg.Data, &req); err != nil {
+			return ws.Message{}, err
+		}
+
+		caller, _ := user.SessionFromContext(ctx)
+		if _, err := s.repository.MarkMessages(ctx, req, reporterIdentityOf(caller)); err != nil {
+			return ws.Message{}, fmt.Errorf("mark messages: %w", err)
+		}
+
+		return ws.Message{}, nil
 	}
 
 	return ws.Message{}, nil
@@ -0,0 +1,125 @@
+package disaster
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// [longitude, latitude] points, in order. The last point connects back to the
+// first.
+type polygon [][2]float64
+
+func (p polygon) isValid() bool {
+	if len(p) < 3 {
+		return false
+	}
+
+	for _, point := range p {
+		if point[0] < -180 || point[0] > 180 || point[1] < -90 || point[1] > 90 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// contains casts a ray from the point and counts the edges it crosses, the point
+// is inside when the count is odd.
+func (p polygon) contains(longitude, latitude float64) bool {
+	isInside := false
+
+	for i, j := 0, len(p)-1; i < len(p); j, i = i, i+1 {
+		a, b := p[i], p[j]
+
+		if (a[1] > latitude) != (b[1] > latitude) &&
+			longitude < (b[0]-a[0])*(latitude-a[1])/(b[1]-a[1])+a[0] {
+			isInside = !isInside
+		}
+	}
+
+	return isInside
+}
+
+type hazardZone struct {
+	HazardZoneID string    `json:"id"`
+	CreatedAt    time.Time `json:"createdAt"`
+	Name         string    `json:"name"`
+	Polygon      polygon   `json:"polygon"`
+}
+
+var (
+	errHazardZoneNotFound = errors.New("hazard zone not found")
+	errInvalidHazardZone  = errors.New("invalid hazard zone")
+)
+
+func (r *repository) ListHazardZones(ctx context.Context) ([]hazardZone, error) {
+	query := `
+	SELECT hazard_zone_id, created_at, name, polygon
+	FROM hazard_zones
+	ORDER BY created_at
+	`
+
+	rows, err := r.querier.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, pgx.RowToStructByName[hazardZone])
+}
+
+type createHazardZoneRequest struct {
+	Name    string  `json:"name"`
+	Polygon polygon `json:"polygon"`
+}
+
+// CreateHazardZone also reprioritizes open reports, some may be inside the zone.
+func (r *repository) CreateHazardZone(
+	ctx context.Context,
+	arg createHazardZoneRequest,
+) (hazardZone, error) {
+	arg.Name = strings.TrimSpace(arg.Name)
+	if arg.Name == "" || !arg.Polygon.isValid() {
+		return hazardZone{}, errInvalidHazardZone
+	}
+
+	query := `
+	INSERT INTO hazard_zones (name, polygon)
+	VALUES ($1, $2)
+	RETURNING hazard_zone_id, created_at, name, polygon
+	`
+
+	rows, err := r.querier.Query(ctx, query, arg.Name, arg.Polygon)
+	if err != nil {
+		return hazardZone{}, err
+	}
+
+	zone, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[hazardZone])
+	if err != nil {
+		return hazardZone{}, err
+	}
+
+	if err := r.refreshPriorities(ctx); err != nil {
+		return hazardZone{}, err
+	}
+
+	return zone, nil
+}
+
+func (r *repository) DeleteHazardZone(ctx context.Context, zoneID string) error {
+	query := `DELETE FROM hazard_zones WHERE hazard_zone_id = ($1)`
+
+	tag, err := r.querier.Exec(ctx, query, zoneID)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return errHazardZoneNotFound
+	}
+
+	return r.refreshPriorities(ctx)
+}
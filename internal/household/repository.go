@@ -0,0 +1,476 @@
+package household
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/InternalPointerVariable/ResQLink-Backend/internal/ws"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/redis/go-redis/v9"
+)
+
+type Repository interface {
+	CreateHousehold(ctx context.Context, userID string, arg createHouseholdRequest) (household, error)
+	ListHouseholds(ctx context.Context, userID string) ([]household, error)
+	GetHousehold(ctx context.Context, householdID, userID string) (household, error)
+	JoinHousehold(ctx context.Context, userID, inviteCode string) (household, error)
+	RotateInviteCode(ctx context.Context, householdID, userID string) (household, error)
+	RemoveMember(ctx context.Context, householdID, userID, memberID string) error
+
+	PublishStatus(ctx context.Context, userID, status string) error
+}
+
+type repository struct {
+	querier     *pgxpool.Pool
+	redisClient *redis.Client
+}
+
+func NewRepository(querier *pgxpool.Pool, redisClient *redis.Client) Repository {
+	return &repository{
+		querier:     querier,
+		redisClient: redisClient,
+	}
+}
+
+// Same key the disaster package saves reporters' locations to
+const locationFmt = "reporter:%s:location"
+
+// Sent to the other members whenever someone in their household reports
+const statusChanged = "household:status_changed"
+
+const (
+	inviteCodeLength = 8
+	// No 0/O or 1/I, so codes read over the phone aren't mistyped
+	inviteCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+)
+
+var (
+	errHouseholdNotFound    = errors.New("household not found")
+	errInvalidInviteCode    = errors.New("invalid invite code")
+	errNotHouseholdOwner    = errors.New("not the household owner")
+	errMemberNotFound       = errors.New("household member not found")
+	errInvalidHouseholdName = errors.New("invalid household name")
+)
+
+type location struct {
+	Longitude float32 `json:"longitude"`
+	Latitude  float32 `json:"latitude"`
+	Address   *string `json:"address"`
+}
+
+type member struct {
+	UserID     string     `json:"id"`
+	JoinedAt   time.Time  `json:"joinedAt"`
+	FirstName  string     `json:"firstName"`
+	MiddleName *string    `json:"middleName"`
+	LastName   string     `json:"lastName"`
+	Status     *string    `json:"status"`
+	ReportedAt *time.Time `json:"reportedAt"`
+
+	// Only set when the member shares their location
+	Location *location `json:"location" db:"-"`
+
+	ReporterID       *string `json:"-"`
+	IsLocationShared bool    `json:"-"`
+}
+
+type household struct {
+	HouseholdID string    `json:"id"`
+	CreatedAt   time.Time `json:"createdAt"`
+	Name        string    `json:"name"`
+	InviteCode  string    `json:"inviteCode"`
+	CreatedBy   *string   `json:"createdBy"`
+	Members     []member  `json:"members" db:"-"`
+}
+
+func generateInviteCode() (string, error) {
+	byt := make([]byte, inviteCodeLength)
+	if _, err := rand.Read(byt); err != nil {
+		return "", err
+	}
+
+	// 256 is a multiple of the alphabet's length, so every character is as likely
+	for i := range byt {
+		byt[i] = inviteCodeAlphabet[int(byt[i])%len(inviteCodeAlphabet)]
+	}
+
+	return string(byt), nil
+}
+
+type createHouseholdRequest struct {
+	Name string `json:"name"`
+}
+
+func (r *repository) CreateHousehold(
+	ctx context.Context,
+	userID string,
+	arg createHouseholdRequest,
+) (household, error) {
+	tx, err := r.querier.Begin(ctx)
+	if err != nil {
+		return household{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	inviteCode, err := generateInviteCode()
+	if err != nil {
+		return household{}, err
+	}
+
+	query := `
+	INSERT INTO households (name, invite_code, created_by)
+	VALUES ($1, $2, $3)
+	RETURNING household_id
+	`
+
+	var householdID string
+
+	row := tx.QueryRow(ctx, query, arg.Name, inviteCode, userID)
+	if err := row.Scan(&householdID); err != nil {
+		return household{}, err
+	}
+
+	query = `INSERT INTO household_members (household_id, user_id) VALUES ($1, $2)`
+
+	if _, err := tx.Exec(ctx, query, householdID, userID); err != nil {
+		return household{}, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return household{}, err
+	}
+
+	return r.GetHousehold(ctx, householdID, userID)
+}
+
+func (r *repository) ListHouseholds(ctx context.Context, userID string) ([]household, error) {
+	query := `
+	SELECT
+		households.household_id,
+		households.created_at,
+		households.name,
+		households.invite_code,
+		households.created_by
+	FROM households
+	JOIN household_members ON household_members.household_id = households.household_id
+	WHERE household_members.user_id = ($1)
+	ORDER BY household_members.joined_at
+	`
+
+	rows, err := r.querier.Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	households, err := pgx.CollectRows(rows, pgx.RowToStructByName[household])
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range households {
+		households[i].Members, err = r.listMembers(ctx, households[i].HouseholdID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return households, nil
+}
+
+// GetHousehold returns `errHouseholdNotFound` unless `userID` is a member.
+func (r *repository) GetHousehold(
+	ctx context.Context,
+	householdID, userID string,
+) (household, error) {
+	query := `
+	SELECT
+		households.household_id,
+		households.created_at,
+		households.name,
+		households.invite_code,
+		households.created_by
+	FROM households
+	JOIN household_members ON household_members.household_id = households.household_id
+	WHERE households.household_id = ($1) AND household_members.user_id = ($2)
+	`
+
+	rows, err := r.querier.Query(ctx, query, householdID, userID)
+	if err != nil {
+		return household{}, err
+	}
+
+	res, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[household])
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return household{}, errHouseholdNotFound
+		}
+
+		return household{}, err
+	}
+
+	res.Members, err = r.listMembers(ctx, householdID)
+	if err != nil {
+		return household{}, err
+	}
+
+	return res, nil
+}
+
+// listMembers returns each member's latest status, and their last location from
+// Redis only while they have location sharing turned on.
+func (r *repository) listMembers(ctx context.Context, householdID string) ([]member, error) {
+	query := `
+	SELECT
+		users.user_id,
+		household_members.joined_at,
+		users.first_name,
+		users.middle_name,
+		users.last_name,
+		latest.status::text AS status,
+		latest.created_at AS reported_at,
+		reporters.reporter_id,
+		users.is_location_shared
+	FROM household_members
+	JOIN users ON users.user_id = household_members.user_id
+	LEFT JOIN reporters ON reporters.user_id = users.user_id
+	LEFT JOIN LATERAL (
+		SELECT status, created_at
+		FROM disaster_reports
+		WHERE disaster_reports.reporter_id = reporters.reporter_id
+		ORDER BY created_at DESC
+		LIMIT 1
+	) latest ON TRUE
+	WHERE household_members.household_id = ($1)
+	ORDER BY household_members.joined_at
+	`
+
+	rows, err := r.querier.Query(ctx, query, householdID)
+	if err != nil {
+		return nil, err
+	}
+
+	members, err := pgx.CollectRows(rows, pgx.RowToStructByName[member])
+	if err != nil {
+		return nil, err
+	}
+
+	pipe := r.redisClient.Pipeline()
+	cmds := make(map[string]*redis.JSONCmd)
+
+	for _, m := range members {
+		if m.ReporterID == nil || !m.IsLocationShared {
+			continue
+		}
+
+		cmds[m.UserID] = pipe.JSONGet(ctx, fmt.Sprintf(locationFmt, *m.ReporterID))
+	}
+
+	if len(cmds) == 0 {
+		return members, nil
+	}
+
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return nil, err
+	}
+
+	for i := range members {
+		m := &members[i]
+
+		cmd, ok := cmds[m.UserID]
+		if !ok {
+			continue
+		}
+
+		result, err := cmd.Result()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return nil, err
+		}
+
+		if result == "" {
+			continue
+		}
+
+		if err := json.Unmarshal([]byte(result), &m.Location); err != nil {
+			return nil, err
+		}
+	}
+
+	return members, nil
+}
+
+type joinHouseholdRequest struct {
+	InviteCode string `json:"inviteCode"`
+}
+
+// JoinHousehold does nothing if the user is already a member.
+func (r *repository) JoinHousehold(
+	ctx context.Context,
+	userID, inviteCode string,
+) (household, error) {
+	query := `SELECT household_id FROM households WHERE invite_code = ($1)`
+
+	var householdID string
+
+	if err := r.querier.QueryRow(ctx, query, inviteCode).Scan(&householdID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return household{}, errInvalidInviteCode
+		}
+
+		return household{}, err
+	}
+
+	query = `
+	INSERT INTO household_members (household_id, user_id)
+	VALUES ($1, $2)
+	ON CONFLICT DO NOTHING
+	`
+
+	if _, err := r.querier.Exec(ctx, query, householdID, userID); err != nil {
+		return household{}, err
+	}
+
+	return r.GetHousehold(ctx, householdID, userID)
+}
+
+// RotateInviteCode replaces the code so one that was shared too widely stops
+// working. Only the household's creator can do it.
+func (r *repository) RotateInviteCode(
+	ctx context.Context,
+	householdID, userID string,
+) (household, error) {
+	inviteCode, err := generateInviteCode()
+	if err != nil {
+		return household{}, err
+	}
+
+	query := `
+	UPDATE households SET invite_code = ($1)
+	WHERE household_id = ($2) AND created_by = ($3)
+	`
+
+	tag, err := r.querier.Exec(ctx, query, inviteCode, householdID, userID)
+	if err != nil {
+		return household{}, err
+	}
+
+	res, err := r.GetHousehold(ctx, householdID, userID)
+	if err != nil {
+		return household{}, err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return household{}, errNotHouseholdOwner
+	}
+
+	return res, nil
+}
+
+// RemoveMember lets members leave, and the creator remove anyone else. The
+// household is deleted along with its last member.
+func (r *repository) RemoveMember(ctx context.Context, householdID, userID, memberID string) error {
+	tx, err := r.querier.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+	SELECT households.created_by
+	FROM households
+	JOIN household_members ON household_members.household_id = households.household_id
+	WHERE households.household_id = ($1) AND household_members.user_id = ($2)
+	FOR UPDATE OF households
+	`
+
+	var createdBy *string
+
+	if err := tx.QueryRow(ctx, query, householdID, userID).Scan(&createdBy); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return errHouseholdNotFound
+		}
+
+		return err
+	}
+
+	if memberID != userID && (createdBy == nil || *createdBy != userID) {
+		return errNotHouseholdOwner
+	}
+
+	query = `DELETE FROM household_members WHERE household_id = ($1) AND user_id = ($2)`
+
+	tag, err := tx.Exec(ctx, query, householdID, memberID)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return errMemberNotFound
+	}
+
+	query = `
+	DELETE FROM households
+	WHERE household_id = ($1)
+		AND NOT EXISTS (SELECT 1 FROM household_members WHERE household_id = ($1))
+	`
+
+	if _, err := tx.Exec(ctx, query, householdID); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+type statusChangedResponse struct {
+	UserID     string    `json:"userId"`
+	Status     string    `json:"status"`
+	ReportedAt time.Time `json:"reportedAt"`
+}
+
+// PublishStatus sends the user's new status to everyone sharing a household with
+// them, through whichever hub they're connected to.
+func (r *repository) PublishStatus(ctx context.Context, userID, status string) error {
+	query := `
+	SELECT DISTINCT others.user_id
+	FROM household_members
+	JOIN household_members others ON others.household_id = household_members.household_id
+	WHERE household_members.user_id = ($1) AND others.user_id != ($1)
+	`
+
+	rows, err := r.querier.Query(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+
+	memberIDs, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return err
+	}
+
+	if len(memberIDs) == 0 {
+		return nil
+	}
+
+	data, err := json.Marshal(statusChangedResponse{
+		UserID:     userID,
+		Status:     status,
+		ReportedAt: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+
+	msg, err := json.Marshal(ws.DirectMessage{
+		UserIDs: memberIDs,
+		Message: ws.Message{Event: statusChanged, Data: data},
+	})
+	if err != nil {
+		return err
+	}
+
+	return r.redisClient.Publish(ctx, ws.DirectChannel, msg).Err()
+}
@@ -0,0 +1,293 @@
+package household
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/InternalPointerVariable/ResQLink-Backend/internal/api"
+	"github.com/InternalPointerVariable/ResQLink-Backend/internal/user"
+)
+
+// Households let families see each other's latest status without calling the
+// hotline. Members join with the invite code the creator shares with them.
+type Server struct {
+	repository Repository
+}
+
+func NewServer(repository Repository) *Server {
+	return &Server{
+		repository: repository,
+	}
+}
+
+var errNoSession = errors.New("no session")
+
+func (s *Server) CreateHousehold(w http.ResponseWriter, r *http.Request) api.Response {
+	ctx := r.Context()
+
+	caller, ok := user.SessionFromContext(ctx)
+	if !ok {
+		return api.Response{
+			Error:   fmt.Errorf("create household: %w", errNoSession),
+			Code:    http.StatusUnauthorized,
+			Message: "Unauthorized.",
+		}
+	}
+
+	var data createHouseholdRequest
+
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&data); err != nil {
+		return api.Response{
+			Error:   fmt.Errorf("create household: %w", err),
+			Code:    http.StatusBadRequest,
+			Message: "Invalid create household request.",
+		}
+	}
+
+	data.Name = strings.TrimSpace(data.Name)
+	if data.Name == "" {
+		return api.Response{
+			Error:   fmt.Errorf("create household: %w", errInvalidHouseholdName),
+			Code:    http.StatusBadRequest,
+			Message: "Household name is required.",
+		}
+	}
+
+	created, err := s.repository.CreateHousehold(ctx, caller.User.UserID, data)
+	if err != nil {
+		return api.Response{
+			Error:   fmt.Errorf("create household: %w", err),
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to create household.",
+		}
+	}
+
+	return api.Response{
+		Code:    http.StatusCreated,
+		Message: "Successfully created household.",
+		Data:    created,
+	}
+}
+
+func (s *Server) ListHouseholds(w http.ResponseWriter, r *http.Request) api.Response {
+	ctx := r.Context()
+
+	caller, ok := user.SessionFromContext(ctx)
+	if !ok {
+		return api.Response{
+			Error:   fmt.Errorf("list households: %w", errNoSession),
+			Code:    http.StatusUnauthorized,
+			Message: "Unauthorized.",
+		}
+	}
+
+	households, err := s.repository.ListHouseholds(ctx, caller.User.UserID)
+	if err != nil {
+		return api.Response{
+			Error:   fmt.Errorf("list households: %w", err),
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to get households.",
+		}
+	}
+
+	return api.Response{
+		Code:    http.StatusOK,
+		Message: "Successfully fetched households.",
+		Data:    households,
+	}
+}
+
+func (s *Server) GetHousehold(w http.ResponseWriter, r *http.Request) api.Response {
+	ctx := r.Context()
+
+	caller, ok := user.SessionFromContext(ctx)
+	if !ok {
+		return api.Response{
+			Error:   fmt.Errorf("get household: %w", errNoSession),
+			Code:    http.StatusUnauthorized,
+			Message: "Unauthorized.",
+		}
+	}
+
+	household, err := s.repository.GetHousehold(
+		ctx,
+		r.PathValue("householdId"),
+		caller.User.UserID,
+	)
+	if err != nil {
+		if errors.Is(err, errHouseholdNotFound) {
+			return api.Response{
+				Error:   fmt.Errorf("get household: %w", err),
+				Code:    http.StatusNotFound,
+				Message: "Household not found.",
+			}
+		}
+
+		return api.Response{
+			Error:   fmt.Errorf("get household: %w", err),
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to get household.",
+		}
+	}
+
+	return api.Response{
+		Code:    http.StatusOK,
+		Message: "Successfully fetched household.",
+		Data:    household,
+	}
+}
+
+func (s *Server) JoinHousehold(w http.ResponseWriter, r *http.Request) api.Response {
+	ctx := r.Context()
+
+	caller, ok := user.SessionFromContext(ctx)
+	if !ok {
+		return api.Response{
+			Error:   fmt.Errorf("join household: %w", errNoSession),
+			Code:    http.StatusUnauthorized,
+			Message: "Unauthorized.",
+		}
+	}
+
+	var data joinHouseholdRequest
+
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&data); err != nil {
+		return api.Response{
+			Error:   fmt.Errorf("join household: %w", err),
+			Code:    http.StatusBadRequest,
+			Message: "Invalid join household request.",
+		}
+	}
+
+	inviteCode := strings.ToUpper(strings.TrimSpace(data.InviteCode))
+
+	household, err := s.repository.JoinHousehold(ctx, caller.User.UserID, inviteCode)
+	if err != nil {
+		if errors.Is(err, errInvalidInviteCode) {
+			return api.Response{
+				Error:   fmt.Errorf("join household: %w", err),
+				Code:    http.StatusNotFound,
+				Message: "Invalid invite code.",
+			}
+		}
+
+		return api.Response{
+			Error:   fmt.Errorf("join household: %w", err),
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to join household.",
+		}
+	}
+
+	return api.Response{
+		Code:    http.StatusOK,
+		Message: "Successfully joined household.",
+		Data:    household,
+	}
+}
+
+func (s *Server) RotateInviteCode(w http.ResponseWriter, r *http.Request) api.Response {
+	ctx := r.Context()
+
+	caller, ok := user.SessionFromContext(ctx)
+	if !ok {
+		return api.Response{
+			Error:   fmt.Errorf("rotate invite code: %w", errNoSession),
+			Code:    http.StatusUnauthorized,
+			Message: "Unauthorized.",
+		}
+	}
+
+	household, err := s.repository.RotateInviteCode(
+		ctx,
+		r.PathValue("householdId"),
+		caller.User.UserID,
+	)
+	if err != nil {
+		if errors.Is(err, errHouseholdNotFound) {
+			return api.Response{
+				Error:   fmt.Errorf("rotate invite code: %w", err),
+				Code:    http.StatusNotFound,
+				Message: "Household not found.",
+			}
+		}
+
+		if errors.Is(err, errNotHouseholdOwner) {
+			return api.Response{
+				Error:   fmt.Errorf("rotate invite code: %w", err),
+				Code:    http.StatusForbidden,
+				Message: "Only the household's creator can change its invite code.",
+			}
+		}
+
+		return api.Response{
+			Error:   fmt.Errorf("rotate invite code: %w", err),
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to change invite code.",
+		}
+	}
+
+	return api.Response{
+		Code:    http.StatusOK,
+		Message: "Successfully changed invite code.",
+		Data:    household,
+	}
+}
+
+func (s *Server) RemoveMember(w http.ResponseWriter, r *http.Request) api.Response {
+	ctx := r.Context()
+
+	caller, ok := user.SessionFromContext(ctx)
+	if !ok {
+		return api.Response{
+			Error:   fmt.Errorf("remove household member: %w", errNoSession),
+			Code:    http.StatusUnauthorized,
+			Message: "Unauthorized.",
+		}
+	}
+
+	if err := s.repository.RemoveMember(
+		ctx,
+		r.PathValue("householdId"),
+		caller.User.UserID,
+		r.PathValue("userId"),
+	); err != nil {
+		if errors.Is(err, errHouseholdNotFound) || errors.Is(err, errMemberNotFound) {
+			return api.Response{
+				Error:   fmt.Errorf("remove household member: %w", err),
+				Code:    http.StatusNotFound,
+				Message: "Household member not found.",
+			}
+		}
+
+		if errors.Is(err, errNotHouseholdOwner) {
+			return api.Response{
+				Error:   fmt.Errorf("remove household member: %w", err),
+				Code:    http.StatusForbidden,
+				Message: "Only the household's creator can remove other members.",
+			}
+		}
+
+		return api.Response{
+			Error:   fmt.Errorf("remove household member: %w", err),
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to remove household member.",
+		}
+	}
+
+	return api.Response{
+		Code:    http.StatusOK,
+		Message: "Successfully removed household member.",
+	}
+}
+
+// NotifyHouseholds sends a member's new status to the rest of their households
+// over the WebSocket, see `disaster.HouseholdNotifier`.
+func (s *Server) NotifyHouseholds(ctx context.Context, userID, status string) error {
+	return s.repository.PublishStatus(ctx, userID, status)
+}
@@ -0,0 +1,63 @@
+package mail
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// FileMailer writes every message to `dir` as an `.eml` file instead of sending
+// it. Meant for local development and tests.
+type FileMailer struct {
+	dir  string
+	from string
+}
+
+func NewFileMailer(dir, from string) *FileMailer {
+	return &FileMailer{
+		dir:  dir,
+		from: from,
+	}
+}
+
+func (m *FileMailer) Send(ctx context.Context, msg Message) error {
+	if err := ValidateAddress(msg.To); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(m.dir, os.ModePerm); err != nil {
+		return err
+	}
+
+	// The recipient is hashed so it can never make a path outside `dir`, the
+	// address itself is in the file's headers
+	hash := sha256.Sum256([]byte(msg.To))
+	fileName := fmt.Sprintf(
+		"%s_%s.eml",
+		time.Now().Format("20060102-150405.000000000"),
+		hex.EncodeToString(hash[:8]),
+	)
+	filePath := filepath.Join(m.dir, fileName)
+
+	if err := os.WriteFile(filePath, format(m.from, msg), 0o644); err != nil {
+		return err
+	}
+
+	slog.Info(fmt.Sprintf("Mail to %s written to %s", msg.To, filePath))
+
+	return nil
+}
+
+// LogMailer only logs messages, links and codes included, so it must only be
+// used in development.
+type LogMailer struct{}
+
+func (LogMailer) Send(ctx context.Context, msg Message) error {
+	slog.Info("Mail", "to", msg.To, "subject", msg.Subject, "body", msg.Body)
+	return nil
+}
@@ -0,0 +1,30 @@
+package mail
+
+import (
+	"context"
+	"errors"
+	"net/mail"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string // Plain text
+}
+
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+var ErrInvalidAddress = errors.New("invalid email address")
+
+// ValidateAddress only accepts a bare address like `juan@example.com`, without
+// a display name, since that's all recipients are stored as.
+func ValidateAddress(addr string) error {
+	parsed, err := mail.ParseAddress(addr)
+	if err != nil || parsed.Address != addr {
+		return ErrInvalidAddress
+	}
+
+	return nil
+}
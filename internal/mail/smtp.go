@@ -0,0 +1,77 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+type SMTPMailer struct {
+	addr string
+	auth smtp.Auth
+	from string
+}
+
+func NewSMTPMailer(host, port, username, password, from string) *SMTPMailer {
+	var auth smtp.Auth
+	if username != "" {
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+
+	return &SMTPMailer{
+		addr: net.JoinHostPort(host, port),
+		auth: auth,
+		from: from,
+	}
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	// `smtp.SendMail` doesn't take a context, so the deadline is only checked up front
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if err := ValidateAddress(msg.To); err != nil {
+		return err
+	}
+
+	// `from` may include a display name, but the envelope only takes the address
+	sender, err := mail.ParseAddress(m.from)
+	if err != nil {
+		return fmt.Errorf("smtp sender: %w", err)
+	}
+
+	if err := smtp.SendMail(
+		m.addr,
+		m.auth,
+		sender.Address,
+		[]string{msg.To},
+		format(m.from, msg),
+	); err != nil {
+		return fmt.Errorf("smtp send: %w", err)
+	}
+
+	return nil
+}
+
+// Strips line breaks from header values so they can't inject extra headers
+var headerReplacer = strings.NewReplacer("\r", "", "\n", "")
+
+func format(from string, msg Message) []byte {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "From: %s\r\n", headerReplacer.Replace(from))
+	fmt.Fprintf(&b, "To: %s\r\n", headerReplacer.Replace(msg.To))
+	fmt.Fprintf(&b, "Subject: %s\r\n", headerReplacer.Replace(msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+
+	return []byte(b.String())
+}
@@ -0,0 +1,158 @@
+package situation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// OpenAISummarizer works with any chat completions API compatible with
+// OpenAI's, hosted or self-hosted.
+type OpenAISummarizer struct {
+	url        string
+	apiKey     string
+	model      string
+	withPhotos bool
+	client     *http.Client
+}
+
+// `url` is the API's base URL, e.g. `https://api.openai.com/v1`. Photos are only
+// sent when `withPhotos` is set and the model supports images.
+func NewOpenAISummarizer(url, apiKey, model string, withPhotos bool) *OpenAISummarizer {
+	return &OpenAISummarizer{
+		url:        strings.TrimSuffix(url, "/"),
+		apiKey:     apiKey,
+		model:      model,
+		withPhotos: withPhotos,
+		client:     &http.Client{},
+	}
+}
+
+const systemPrompt = `You summarize disaster reports from citizens for emergency responders.
+Reply with a JSON object only, with these fields:
+- "peopleCount": number of people who need help, at least 1
+- "injuries": short descriptions of injuries mentioned, empty if none
+- "hazards": short descriptions of hazards around them, empty if none
+- "vulnerable": vulnerable people among them (elderly, children, pregnant, disabled...), empty if none
+- "urgency": one of "low", "medium", "high" or "critical"
+- "text": one or two sentences a responder can read at a glance
+Reports may be in English, Filipino or a mix of both. Always reply in English.`
+
+var errInvalidSummary = errors.New("invalid summary")
+
+type chatContent struct {
+	Type     string        `json:"type"`
+	Text     string        `json:"text,omitempty"`
+	ImageURL *chatImageURL `json:"image_url,omitempty"`
+}
+
+type chatImageURL struct {
+	URL string `json:"url"`
+}
+
+type chatMessage struct {
+	Role    string        `json:"role"`
+	Content []chatContent `json:"content"`
+}
+
+type chatRequest struct {
+	Model          string            `json:"model"`
+	Messages       []chatMessage     `json:"messages"`
+	ResponseFormat map[string]string `json:"response_format"`
+}
+
+type chatResponse struct {
+	Choices []struct {
+		Message struct {
+			Content string `json:"content"`
+		} `json:"message"`
+	} `json:"choices"`
+}
+
+func (s *OpenAISummarizer) Summarize(ctx context.Context, report Report) (Summary, error) {
+	var text strings.Builder
+
+	fmt.Fprintf(&text, "Status: %s\n\n%s", report.Status, report.RawSituation)
+	for i, update := range report.Updates {
+		fmt.Fprintf(&text, "\n\nFollow-up %d: %s", i+1, update)
+	}
+
+	content := []chatContent{{Type: "text", Text: text.String()}}
+
+	if s.withPhotos {
+		for _, photoURL := range report.PhotoURLs {
+			// Photos still saved on the server's disk can't be reached by the API
+			if !strings.HasPrefix(photoURL, "http://") && !strings.HasPrefix(photoURL, "https://") {
+				continue
+			}
+
+			content = append(content, chatContent{
+				Type:     "image_url",
+				ImageURL: &chatImageURL{URL: photoURL},
+			})
+		}
+	}
+
+	body, err := json.Marshal(chatRequest{
+		Model: s.model,
+		Messages: []chatMessage{
+			{Role: "system", Content: []chatContent{{Type: "text", Text: systemPrompt}}},
+			{Role: "user", Content: content},
+		},
+		ResponseFormat: map[string]string{"type": "json_object"},
+	})
+	if err != nil {
+		return Summary{}, err
+	}
+
+	req, err := http.NewRequestWithContext(
+		ctx,
+		http.MethodPost,
+		s.url+"/chat/completions",
+		bytes.NewReader(body),
+	)
+	if err != nil {
+		return Summary{}, err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+s.apiKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return Summary{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		byt, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return Summary{}, fmt.Errorf("chat completions: %s: %s", resp.Status, byt)
+	}
+
+	var completion chatResponse
+
+	if err := json.NewDecoder(resp.Body).Decode(&completion); err != nil {
+		return Summary{}, err
+	}
+
+	if len(completion.Choices) == 0 {
+		return Summary{}, fmt.Errorf("%w: no choices", errInvalidSummary)
+	}
+
+	var summary Summary
+
+	if err := json.Unmarshal([]byte(completion.Choices[0].Message.Content), &summary); err != nil {
+		return Summary{}, fmt.Errorf("%w: %w", errInvalidSummary, err)
+	}
+
+	if err := summary.validate(); err != nil {
+		return Summary{}, err
+	}
+
+	return summary, nil
+}
@@ -0,0 +1,61 @@
+package situation
+
+import "fmt"
+
+// What the citizen said, as given to a summarizer
+type Report struct {
+	Status       string // `safe`, `at_risk` or `in_danger`
+	RawSituation string
+	Updates      []string // Follow-ups, oldest first
+	PhotoURLs    []string
+}
+
+type Urgency string
+
+const (
+	Low      Urgency = "low"
+	Medium   Urgency = "medium"
+	High     Urgency = "high"
+	Critical Urgency = "critical"
+)
+
+// Summary is what responders need at a glance before opening the report.
+type Summary struct {
+	PeopleCount int      `json:"peopleCount"`
+	Injuries    []string `json:"injuries"`
+	Hazards     []string `json:"hazards"`
+	Vulnerable  []string `json:"vulnerable"` // Elderly, children, pregnant, disabled...
+	Urgency     Urgency  `json:"urgency"`
+	Text        string   `json:"text"` // One or two sentences
+}
+
+// validate checks what a model came up with, and fills in what it left out.
+func (s *Summary) validate() error {
+	switch s.Urgency {
+	case Low, Medium, High, Critical:
+	default:
+		return fmt.Errorf("%w: unknown urgency %q", errInvalidSummary, s.Urgency)
+	}
+
+	if s.Text == "" {
+		return fmt.Errorf("%w: no text", errInvalidSummary)
+	}
+
+	if s.PeopleCount < 1 {
+		s.PeopleCount = 1
+	}
+
+	if s.Injuries == nil {
+		s.Injuries = []string{}
+	}
+
+	if s.Hazards == nil {
+		s.Hazards = []string{}
+	}
+
+	if s.Vulnerable == nil {
+		s.Vulnerable = []string{}
+	}
+
+	return nil
+}
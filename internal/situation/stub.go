@@ -0,0 +1,126 @@
+package situation
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Stub summarizes with keywords only. It always gives the same summary for the
+// same report, so it's used for local development and tests, and when no model
+// is configured.
+type Stub struct{}
+
+var (
+	injuryKeywords = []string{
+		"bleeding",
+		"broken",
+		"burn",
+		"fracture",
+		"hurt",
+		"injured",
+		"injury",
+		"unconscious",
+		"wound",
+	}
+	hazardKeywords = []string{
+		"collapse",
+		"electric",
+		"fire",
+		"flood",
+		"gas",
+		"landslide",
+		"smoke",
+		"storm surge",
+		"water",
+	}
+	vulnerableKeywords = []string{
+		"baby",
+		"bedridden",
+		"child",
+		"disabled",
+		"elderly",
+		"infant",
+		"kids",
+		"lola",
+		"lolo",
+		"pregnant",
+		"pwd",
+		"senior",
+		"wheelchair",
+	}
+
+	peopleCountPattern = regexp.MustCompile(
+		`(\d+)\s*(?:people|persons|of us|kids|children|adults|family members)`,
+	)
+)
+
+func (Stub) Summarize(ctx context.Context, report Report) (Summary, error) {
+	text := strings.ToLower(strings.Join(append([]string{report.RawSituation}, report.Updates...), " "))
+
+	summary := Summary{
+		PeopleCount: 1,
+		Injuries:    matchKeywords(text, injuryKeywords),
+		Hazards:     matchKeywords(text, hazardKeywords),
+		Vulnerable:  matchKeywords(text, vulnerableKeywords),
+	}
+
+	for _, match := range peopleCountPattern.FindAllStringSubmatch(text, -1) {
+		if count, err := strconv.Atoi(match[1]); err == nil && count > summary.PeopleCount {
+			summary.PeopleCount = count
+		}
+	}
+
+	switch {
+	case report.Status == "in_danger" && len(summary.Injuries) > 0:
+		summary.Urgency = Critical
+	case report.Status == "in_danger":
+		summary.Urgency = High
+	case report.Status == "at_risk" || len(summary.Injuries) > 0:
+		summary.Urgency = Medium
+	default:
+		summary.Urgency = Low
+	}
+
+	summary.Text = fmt.Sprintf(
+		"%d %s, %s urgency. Injuries: %s. Hazards: %s.",
+		summary.PeopleCount,
+		plural(summary.PeopleCount, "person", "people"),
+		summary.Urgency,
+		listOrNone(summary.Injuries),
+		listOrNone(summary.Hazards),
+	)
+
+	return summary, nil
+}
+
+func matchKeywords(text string, keywords []string) []string {
+	matches := []string{}
+
+	for _, keyword := range keywords {
+		if strings.Contains(text, keyword) && !slices.Contains(matches, keyword) {
+			matches = append(matches, keyword)
+		}
+	}
+
+	return matches
+}
+
+func plural(count int, singular, plural string) string {
+	if count == 1 {
+		return singular
+	}
+
+	return plural
+}
+
+func listOrNone(values []string) string {
+	if len(values) == 0 {
+		return "none mentioned"
+	}
+
+	return strings.Join(values, ", ")
+}
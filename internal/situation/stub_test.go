@@ -0,0 +1,99 @@
+package situation
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestStubSummarize(t *testing.T) {
+	tests := []struct {
+		name   string
+		report Report
+		want   Summary
+	}{
+		{
+			name:   "nothing mentioned",
+			report: Report{Status: "safe", RawSituation: "We're fine"},
+			want: Summary{
+				PeopleCount: 1,
+				Injuries:    []string{},
+				Hazards:     []string{},
+				Vulnerable:  []string{},
+				Urgency:     Low,
+				Text:        "1 person, low urgency. Injuries: none mentioned. Hazards: none mentioned.",
+			},
+		},
+		{
+			name: "injured in danger",
+			report: Report{
+				Status:       "in_danger",
+				RawSituation: "5 people stuck on the roof, FLOOD water rising",
+				Updates:      []string{"Lola is bleeding", "now 7 of us"},
+			},
+			want: Summary{
+				PeopleCount: 7,
+				Injuries:    []string{"bleeding"},
+				Hazards:     []string{"flood", "water"},
+				Vulnerable:  []string{"lola"},
+				Urgency:     Critical,
+				Text:        "7 people, critical urgency. Injuries: bleeding. Hazards: flood, water.",
+			},
+		},
+		{
+			name:   "in danger without injuries",
+			report: Report{Status: "in_danger", RawSituation: "fire next door"},
+			want: Summary{
+				PeopleCount: 1,
+				Injuries:    []string{},
+				Hazards:     []string{"fire"},
+				Vulnerable:  []string{},
+				Urgency:     High,
+				Text:        "1 person, high urgency. Injuries: none mentioned. Hazards: fire.",
+			},
+		},
+		{
+			name:   "injured but safe",
+			report: Report{Status: "safe", RawSituation: "my arm is broken"},
+			want: Summary{
+				PeopleCount: 1,
+				Injuries:    []string{"broken"},
+				Hazards:     []string{},
+				Vulnerable:  []string{},
+				Urgency:     Medium,
+				Text:        "1 person, medium urgency. Injuries: broken. Hazards: none mentioned.",
+			},
+		},
+		{
+			name:   "at risk",
+			report: Report{Status: "at_risk", RawSituation: "2 kids with me"},
+			want: Summary{
+				PeopleCount: 2,
+				Injuries:    []string{},
+				Hazards:     []string{},
+				Vulnerable:  []string{"kids"},
+				Urgency:     Medium,
+				Text:        "2 people, medium urgency. Injuries: none mentioned. Hazards: none mentioned.",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Stub{}.Summarize(context.Background(), tt.report)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("summary = %+v, want %+v", got, tt.want)
+			}
+
+			// The stub must always give the same summary for the same report
+			again, _ := Stub{}.Summarize(context.Background(), tt.report)
+			if !reflect.DeepEqual(again, got) {
+				t.Errorf("second summary = %+v, want %+v", again, got)
+			}
+		})
+	}
+}
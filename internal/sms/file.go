@@ -0,0 +1,46 @@
+package sms
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// FileSender writes every message to `dir` as a `.txt` file instead of sending
+// it. Meant for local development and tests.
+type FileSender struct {
+	dir string
+}
+
+func NewFileSender(dir string) *FileSender {
+	return &FileSender{dir: dir}
+}
+
+func (s *FileSender) Send(ctx context.Context, msg Message) error {
+	if err := os.MkdirAll(s.dir, os.ModePerm); err != nil {
+		return err
+	}
+
+	fileName := fmt.Sprintf("%s_%s.txt", time.Now().Format("20060102-150405.000000000"), msg.To)
+	filePath := filepath.Join(s.dir, fileName)
+
+	content := fmt.Sprintf("To: %s\n\n%s\n", msg.To, msg.Body)
+	if err := os.WriteFile(filePath, []byte(content), 0o644); err != nil {
+		return err
+	}
+
+	slog.Info(fmt.Sprintf("SMS to %s written to %s", msg.To, filePath))
+
+	return nil
+}
+
+// LogSender only logs messages. Used when no gateway is configured.
+type LogSender struct{}
+
+func (LogSender) Send(ctx context.Context, msg Message) error {
+	slog.Info("SMS", "to", msg.To, "body", msg.Body)
+	return nil
+}
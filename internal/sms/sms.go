@@ -0,0 +1,13 @@
+package sms
+
+import "context"
+
+type Message struct {
+	To   string // E.164
+	Body string
+}
+
+// Sender delivers text messages. The telco gateway implements it in production.
+type Sender interface {
+	Send(ctx context.Context, msg Message) error
+}
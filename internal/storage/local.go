@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"mime"
+	"os"
+	"path/filepath"
+)
+
+// Local keeps objects as files in `dir`, their content type is told by their
+// extension. Meant for local development and single server deployments.
+type Local struct {
+	dir string
+}
+
+func NewLocal(dir string) *Local {
+	return &Local{
+		dir: dir,
+	}
+}
+
+func (s *Local) Put(ctx context.Context, key, contentType string, body io.Reader, size int64) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(s.dir, os.ModePerm); err != nil {
+		return err
+	}
+
+	// Written to a temporary file first so a failed upload is never served
+	tmp, err := os.CreateTemp(s.dir, ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, body); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), filepath.Join(s.dir, key))
+}
+
+func (s *Local) Get(ctx context.Context, key string) (Object, error) {
+	if err := checkKey(key); err != nil {
+		return Object{}, err
+	}
+
+	file, err := os.Open(filepath.Join(s.dir, key))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return Object{}, ErrNotFound
+		}
+
+		return Object{}, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return Object{}, err
+	}
+
+	contentType := mime.TypeByExtension(filepath.Ext(key))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	return Object{
+		Body:        file,
+		ContentType: contentType,
+		Size:        info.Size(),
+	}, nil
+}
+
+func (s *Local) Delete(ctx context.Context, key string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+
+	err := os.Remove(filepath.Join(s.dir, key))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,36 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestLocalDelete(t *testing.T) {
+	ctx := context.Background()
+	s := NewLocal(t.TempDir())
+
+	const key = "photo.jpg"
+
+	if err := s.Put(ctx, key, "image/jpeg", strings.NewReader("photo"), 5); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Delete(ctx, key); err != nil {
+		t.Fatalf("Delete() err = %v", err)
+	}
+
+	if _, err := s.Get(ctx, key); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() after Delete() err = %v, want %v", err, ErrNotFound)
+	}
+
+	// Erasure may be retried after some of the files are already gone
+	if err := s.Delete(ctx, key); err != nil {
+		t.Errorf("Delete() of a missing object err = %v, want nil", err)
+	}
+
+	if err := s.Delete(ctx, "../outside"); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("Delete() of an invalid key err = %v, want %v", err, ErrInvalidKey)
+	}
+}
@@ -0,0 +1,218 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// S3 keeps objects in a bucket of any S3 compatible service, AWS or
+// self-hosted like MinIO. Buckets are addressed by path, which every such
+// service supports.
+type S3 struct {
+	endpoint  *url.URL
+	bucket    string
+	region    string
+	accessKey string
+	secretKey string
+	client    *http.Client
+}
+
+// `endpoint` is the service's base URL, e.g. `https://s3.ap-southeast-1.amazonaws.com`
+// or `http://localhost:9000` for MinIO. The bucket must already exist.
+func NewS3(endpoint, bucket, region, accessKey, secretKey string) (*S3, error) {
+	u, err := url.Parse(strings.TrimSuffix(endpoint, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("s3 endpoint: %w", err)
+	}
+
+	if u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("s3 endpoint: %q must be an absolute URL", endpoint)
+	}
+
+	if bucket == "" {
+		return nil, fmt.Errorf("s3 bucket: missing")
+	}
+
+	// MinIO doesn't care about the region, but requests must still be signed for one
+	if region == "" {
+		region = "us-east-1"
+	}
+
+	return &S3{
+		endpoint:  u,
+		bucket:    bucket,
+		region:    region,
+		accessKey: accessKey,
+		secretKey: secretKey,
+		client:    &http.Client{},
+	}, nil
+}
+
+func (s *S3) Put(ctx context.Context, key, contentType string, body io.Reader, size int64) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+
+	req, err := s.newRequest(ctx, http.MethodPut, key, body)
+	if err != nil {
+		return err
+	}
+
+	req.ContentLength = size
+	req.Header.Set("Content-Type", contentType)
+
+	res, err := s.do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	return nil
+}
+
+func (s *S3) Get(ctx context.Context, key string) (Object, error) {
+	if err := checkKey(key); err != nil {
+		return Object{}, err
+	}
+
+	req, err := s.newRequest(ctx, http.MethodGet, key, nil)
+	if err != nil {
+		return Object{}, err
+	}
+
+	res, err := s.do(req)
+	if err != nil {
+		return Object{}, err
+	}
+
+	return Object{
+		Body:        res.Body,
+		ContentType: res.Header.Get("Content-Type"),
+		Size:        res.ContentLength,
+	}, nil
+}
+
+func (s *S3) Delete(ctx context.Context, key string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+
+	req, err := s.newRequest(ctx, http.MethodDelete, key, nil)
+	if err != nil {
+		return err
+	}
+
+	// S3 answers 204 for missing keys too, but other compatible stores may not
+	res, err := s.do(req)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil
+		}
+
+		return err
+	}
+	defer res.Body.Close()
+
+	return nil
+}
+
+func (s *S3) newRequest(
+	ctx context.Context,
+	method, key string,
+	body io.Reader,
+) (*http.Request, error) {
+	u := *s.endpoint
+	u.Path = fmt.Sprintf("%s/%s/%s", u.Path, s.bucket, key)
+
+	return http.NewRequestWithContext(ctx, method, u.String(), body)
+}
+
+// do signs and sends the request. Responses other than 2xx are returned as
+// errors with their body closed.
+func (s *S3) do(req *http.Request) (*http.Response, error) {
+	s.sign(req, time.Now().UTC())
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("s3 %s: %w", req.Method, err)
+	}
+
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return res, nil
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotFound {
+		return nil, ErrNotFound
+	}
+
+	byt, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+
+	return nil, fmt.Errorf("s3 %s: %s: %s", req.Method, res.Status, byt)
+}
+
+// Uploads are streamed, so their body isn't hashed, which S3 allows over both
+// HTTP and HTTPS
+const unsignedPayload = "UNSIGNED-PAYLOAD"
+
+// sign adds AWS Signature Version 4 headers to the request. Keys never need
+// escaping, see `checkKey`, so the path is already canonical.
+func (s *S3) sign(req *http.Request, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	scope := fmt.Sprintf("%s/%s/s3/aws4_request", date, s.region)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", unsignedPayload)
+
+	const signedHeaders = "host;x-amz-content-sha256;x-amz-date"
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		"", // No query
+		"host:" + req.URL.Host,
+		"x-amz-content-sha256:" + unsignedPayload,
+		"x-amz-date:" + amzDate,
+		"",
+		signedHeaders,
+		unsignedPayload,
+	}, "\n")
+
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		hex.EncodeToString(hash[:]),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.secretKey), date)
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.accessKey,
+		scope,
+		signedHeaders,
+		hex.EncodeToString(hmacSHA256(key, stringToSign)),
+	))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
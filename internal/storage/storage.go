@@ -0,0 +1,40 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"regexp"
+)
+
+var (
+	ErrNotFound   = errors.New("object not found")
+	ErrInvalidKey = errors.New("invalid object key")
+)
+
+type Object struct {
+	Body        io.ReadCloser // Closed by the caller
+	ContentType string
+	Size        int64
+}
+
+// Storage keeps uploaded files, like the photos attached to reports. See
+// `Local` and `S3` for the implementations.
+type Storage interface {
+	Put(ctx context.Context, key, contentType string, body io.Reader, size int64) error
+	Get(ctx context.Context, key string) (Object, error)
+	// Delete doesn't fail when there's no object at `key`
+	Delete(ctx context.Context, key string) error
+}
+
+// Keys are flat file names, so they can't point outside of where objects are
+// kept and never need escaping in paths or URLs.
+var keyPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,254}$`)
+
+func checkKey(key string) error {
+	if !keyPattern.MatchString(key) {
+		return ErrInvalidKey
+	}
+
+	return nil
+}
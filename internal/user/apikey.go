@@ -0,0 +1,285 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// API keys let partner agencies' dispatch software call the API. Unlike
+// sessions they are authorized by scopes instead of roles.
+type Scope string
+
+const (
+	ReportsRead     Scope = "reports:read"
+	RespondersWrite Scope = "responders:write"
+)
+
+var allScopes = []Scope{ReportsRead, RespondersWrite}
+
+// Keys are prefixed so `AuthMiddleware` can tell them apart from session tokens.
+const apiKeyPrefix = "rql_"
+
+const (
+	apiKeyRateFmt     = "api_key_rate:%s:%d"
+	apiKeyLastUsedFmt = "api_key_last_used:%s"
+
+	defaultAPIKeyRateLimit = 60 // Requests per minute
+	apiKeyLastUsedInterval = time.Minute
+)
+
+type apiKey struct {
+	APIKeyID   string     `json:"id"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"` // Start of the key, to recognize it without storing it
+	Scopes     []Scope    `json:"scopes"`
+	RateLimit  int        `json:"rateLimit"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+	ExpiresAt  *time.Time `json:"expiresAt"`
+	RevokedAt  *time.Time `json:"revokedAt"`
+	CreatedBy  *string    `json:"createdBy"`
+}
+
+func (k apiKey) hasScope(scope Scope) bool {
+	return slices.Contains(k.Scopes, scope)
+}
+
+var (
+	errInvalidAPIKey = errors.New("invalid api key")
+	errInvalidScope  = errors.New("invalid scope")
+)
+
+type rateLimitedError struct {
+	retryAfter time.Duration
+}
+
+func (e *rateLimitedError) Error() string {
+	return fmt.Sprintf("rate limited, retry after %s", e.retryAfter)
+}
+
+func generateAPIKey() (key, prefix string, err error) {
+	token, err := generateToken()
+	if err != nil {
+		return "", "", err
+	}
+
+	key = apiKeyPrefix + strings.ToLower(token)
+	return key, key[:len(apiKeyPrefix)+8], nil
+}
+
+const apiKeyColumns = `
+    api_key_id,
+    created_at,
+    name,
+    prefix,
+    scopes,
+    rate_limit,
+    last_used_at,
+    expires_at,
+    revoked_at,
+    created_by
+`
+
+type createAPIKeyRequest struct {
+	Name      string     `json:"name"`
+	Scopes    []Scope    `json:"scopes"`
+	RateLimit *int       `json:"rateLimit"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+}
+
+type apiKeyResponse struct {
+	apiKey
+
+	// Only returned when the key is created or rotated
+	Key string `json:"key"`
+}
+
+func (r *repository) CreateAPIKey(
+	ctx context.Context,
+	arg createAPIKeyRequest,
+	createdBy string,
+) (apiKeyResponse, error) {
+	for _, scope := range arg.Scopes {
+		if !slices.Contains(allScopes, scope) {
+			return apiKeyResponse{}, fmt.Errorf("%w: %s", errInvalidScope, scope)
+		}
+	}
+
+	rateLimit := defaultAPIKeyRateLimit
+	if arg.RateLimit != nil {
+		rateLimit = *arg.RateLimit
+	}
+
+	key, prefix, err := generateAPIKey()
+	if err != nil {
+		return apiKeyResponse{}, err
+	}
+
+	query := `
+    INSERT INTO api_keys (name, key_hash, prefix, scopes, rate_limit, expires_at, created_by)
+    VALUES ($1, $2, $3, $4, $5, $6, $7)
+    RETURNING ` + apiKeyColumns
+
+	rows, err := r.querier.Query(
+		ctx,
+		query,
+		arg.Name,
+		hashToken(key),
+		prefix,
+		arg.Scopes,
+		rateLimit,
+		arg.ExpiresAt,
+		createdBy,
+	)
+	if err != nil {
+		return apiKeyResponse{}, err
+	}
+
+	created, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[apiKey])
+	if err != nil {
+		return apiKeyResponse{}, err
+	}
+
+	return apiKeyResponse{apiKey: created, Key: key}, nil
+}
+
+func (r *repository) ListAPIKeys(ctx context.Context) ([]apiKey, error) {
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys ORDER BY created_at DESC`
+
+	rows, err := r.querier.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, pgx.RowToStructByName[apiKey])
+}
+
+// RotateAPIKey replaces the secret of a key, keeping its scopes and limits. The
+// old secret stops working right away.
+func (r *repository) RotateAPIKey(ctx context.Context, apiKeyID string) (apiKeyResponse, error) {
+	key, prefix, err := generateAPIKey()
+	if err != nil {
+		return apiKeyResponse{}, err
+	}
+
+	query := `
+    UPDATE api_keys SET key_hash = ($1), prefix = ($2)
+    WHERE api_key_id = ($3) AND revoked_at IS NULL
+    RETURNING ` + apiKeyColumns
+
+	rows, err := r.querier.Query(ctx, query, hashToken(key), prefix, apiKeyID)
+	if err != nil {
+		return apiKeyResponse{}, err
+	}
+
+	rotated, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[apiKey])
+	if err != nil {
+		return apiKeyResponse{}, err
+	}
+
+	return apiKeyResponse{apiKey: rotated, Key: key}, nil
+}
+
+func (r *repository) RevokeAPIKey(ctx context.Context, apiKeyID string) error {
+	query := `
+    UPDATE api_keys SET revoked_at = NOW()
+    WHERE api_key_id = ($1) AND revoked_at IS NULL
+    `
+
+	tag, err := r.querier.Exec(ctx, query, apiKeyID)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+
+	return nil
+}
+
+// validateAPIKey returns a `rateLimitedError` once the key went over its limit
+// for the current minute.
+func (r *repository) validateAPIKey(
+	ctx context.Context,
+	key string,
+) (SessionValidationResponse, error) {
+	query := `
+    SELECT ` + apiKeyColumns + ` FROM api_keys
+    WHERE key_hash = ($1) 
+        AND revoked_at IS NULL 
+        AND (expires_at IS NULL OR expires_at > NOW())
+    `
+
+	rows, err := r.querier.Query(ctx, query, hashToken(key))
+	if err != nil {
+		return SessionValidationResponse{}, err
+	}
+
+	found, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[apiKey])
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return SessionValidationResponse{}, errInvalidAPIKey
+		}
+
+		return SessionValidationResponse{}, err
+	}
+
+	if err := r.limitAPIKey(ctx, found); err != nil {
+		return SessionValidationResponse{}, err
+	}
+
+	if err := r.touchAPIKey(ctx, found.APIKeyID); err != nil {
+		return SessionValidationResponse{}, err
+	}
+
+	return SessionValidationResponse{APIKey: &found}, nil
+}
+
+// Fixed one minute windows, which is precise enough for partner integrations
+func (r *repository) limitAPIKey(ctx context.Context, key apiKey) error {
+	now := time.Now()
+	window := now.Unix() / 60
+
+	rateKey := fmt.Sprintf(apiKeyRateFmt, key.APIKeyID, window)
+
+	pipe := r.redisClient.TxPipeline()
+	incr := pipe.Incr(ctx, rateKey)
+	pipe.Expire(ctx, rateKey, time.Minute)
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
+	}
+
+	if incr.Val() > int64(key.RateLimit) {
+		nextWindow := time.Unix((window+1)*60, 0)
+		return &rateLimitedError{retryAfter: nextWindow.Sub(now)}
+	}
+
+	return nil
+}
+
+// `last_used_at` is written at most once a minute per key
+func (r *repository) touchAPIKey(ctx context.Context, apiKeyID string) error {
+	lastUsedKey := fmt.Sprintf(apiKeyLastUsedFmt, apiKeyID)
+
+	isFirst, err := r.redisClient.SetNX(ctx, lastUsedKey, 1, apiKeyLastUsedInterval).Result()
+	if err != nil {
+		return err
+	}
+
+	if !isFirst {
+		return nil
+	}
+
+	query := `UPDATE api_keys SET last_used_at = NOW() WHERE api_key_id = ($1)`
+
+	_, err = r.querier.Exec(ctx, query, apiKeyID)
+	return err
+}
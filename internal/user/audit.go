@@ -0,0 +1,53 @@
+package user
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+)
+
+type authEvent string
+
+const (
+	signInLockout authEvent = "sign_in_lockout"
+	signInUnlock  authEvent = "sign_in_unlock"
+
+	oidcIdentityLinked authEvent = "oidc_identity_linked"
+)
+
+type authAuditEntry struct {
+	Event     authEvent
+	UserID    *string
+	Email     *string
+	IPAddress *string
+	Details   map[string]any
+}
+
+// Audit failures are only logged, they should never block authentication.
+func (r *repository) logAuthEvent(ctx context.Context, entry authAuditEntry) {
+	slog.Info("Auth audit", "event", entry.Event, "email", entry.Email, "ip", entry.IPAddress)
+
+	details, err := json.Marshal(entry.Details)
+	if err != nil {
+		slog.Error(fmt.Errorf("auth audit: %w", err).Error())
+		return
+	}
+
+	query := `
+    INSERT INTO auth_audit_logs (event, user_id, email, ip_address, details)
+    VALUES ($1, $2, $3, $4, $5)
+    `
+
+	if _, err := r.querier.Exec(
+		ctx,
+		query,
+		entry.Event,
+		entry.UserID,
+		entry.Email,
+		entry.IPAddress,
+		details,
+	); err != nil {
+		slog.Error(fmt.Errorf("auth audit: %w", err).Error())
+	}
+}
@@ -7,20 +7,77 @@ import (
 	"encoding/base32"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net"
+	"net/http"
+	"slices"
 	"time"
 
+	"github.com/redis/go-redis/v9"
 	"golang.org/x/crypto/bcrypt"
 )
 
 type session struct {
 	SessionID   string    `json:"id"`
 	UserID      string    `json:"userId"`
+	CreatedAt   time.Time `json:"createdAt"`
 	ExpiresAt   time.Time `json:"expiresAt"`
+	LastSeenAt  time.Time `json:"lastSeenAt"`
 	IsAnonymous bool      `json:"isAnonymous"`
+
+	// Set when the user's role requires TOTP but it isn't set up yet. The
+	// session can then only be used to enroll. Worked out on every request by
+	// `validateSessionToken`, so it's never stale.
+	TOTPEnrollmentRequired bool `json:"totpEnrollmentRequired"`
+
+	clientInfo
+}
+
+// Device that created a session, shown when listing sessions so users can tell
+// them apart
+type clientInfo struct {
+	IPAddress string `json:"ipAddress"`
+	UserAgent string `json:"userAgent"`
+}
+
+func clientInfoFromRequest(r *http.Request) clientInfo {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+
+	return clientInfo{
+		IPAddress: ip,
+		UserAgent: r.UserAgent(),
+	}
+}
+
+const (
+	sessionFmt           = "session:%s"
+	userSessionsFmt      = "user_sessions:%s"
+	anonymousSessionsFmt = "anonymous_sessions:%s"
+
+	// How often `LastSeenAt` is written back, so not every request costs a write
+	lastSeenInterval = time.Minute
+)
+
+// sessionsKey is the set of the owner's session IDs. Anonymous sessions are kept
+// apart from users', so an anonymous ID can never be used to list or revoke a
+// user's sessions.
+func sessionsKey(userID string, isAnonymous bool) string {
+	if isAnonymous {
+		return fmt.Sprintf(anonymousSessionsFmt, userID)
+	}
+
+	return fmt.Sprintf(userSessionsFmt, userID)
 }
 
 func (r *repository) generateSessionToken() (string, error) {
+	return generateToken()
+}
+
+func generateToken() (string, error) {
 	bytes := make([]byte, 20)
 	if _, err := rand.Read(bytes); err != nil {
 		return "", err
@@ -32,99 +89,157 @@ func (r *repository) generateSessionToken() (string, error) {
 	return token, nil
 }
 
-func (r *repository) createSession(
-	ctx context.Context,
-	token, userID string,
-	isAnon bool,
-) (session, error) {
+// Session IDs are the SHA-256 hash of the token so a leaked Redis dump can't be
+// used to impersonate anyone.
+func hashToken(token string) string {
 	hash := sha256.Sum256([]byte(token))
-	sessionID := hex.EncodeToString(hash[:])
+	return hex.EncodeToString(hash[:])
+}
 
-	expiresAt := time.Now().Add(7 * 24 * time.Hour)
+// createSession stores `ses` under the given token. Only the user, anonymity and
+// client fields of `ses` are used, the rest is filled in here.
+func (r *repository) createSession(ctx context.Context, token string, ses session) (session, error) {
+	now := time.Now()
 
-	ses := session{
-		SessionID:   sessionID,
-		UserID:      userID,
-		ExpiresAt:   expiresAt,
-		IsAnonymous: isAnon,
-	}
+	ses.SessionID = hashToken(token)
+	ses.CreatedAt = now
+	ses.ExpiresAt = now.Add(7 * 24 * time.Hour)
+	ses.LastSeenAt = now
 
 	byt, err := json.Marshal(ses)
 	if err != nil {
 		return session{}, err
 	}
 
-	sessionKey := fmt.Sprintf("session:%s", sessionID)
-	if err := r.redisClient.Set(ctx, sessionKey, string(byt), time.Until(expiresAt)).Err(); err != nil {
+	sessionKey := fmt.Sprintf(sessionFmt, ses.SessionID)
+	if err := r.redisClient.Set(ctx, sessionKey, string(byt), time.Until(ses.ExpiresAt)).Err(); err != nil {
 		return session{}, err
 	}
 
-	userSessionsKey := fmt.Sprintf("user_sessions:%s", userID)
-	if err := r.redisClient.SAdd(ctx, userSessionsKey, sessionID).Err(); err != nil {
+	key := sessionsKey(ses.UserID, ses.IsAnonymous)
+	if err := r.redisClient.SAdd(ctx, key, ses.SessionID).Err(); err != nil {
 		return session{}, err
 	}
 
 	return ses, nil
 }
 
-type sessionValidationResponse struct {
-	User    userResponse `json:"user"`
-	Session session      `json:"session"`
-}
+// saveSession only overwrites a session that still exists, so a session revoked
+// while a request was being validated with it isn't brought back. It returns
+// `redis.Nil` when the session is gone.
+func (r *repository) saveSession(ctx context.Context, ses session) error {
+	byt, err := json.Marshal(ses)
+	if err != nil {
+		return err
+	}
 
-func (r *repository) validateSessionToken(
-	ctx context.Context,
-	token string,
-) (sessionValidationResponse, error) {
-	hash := sha256.Sum256([]byte(token))
-	sessionID := hex.EncodeToString(hash[:])
+	sessionKey := fmt.Sprintf(sessionFmt, ses.SessionID)
 
-	sessionKey := fmt.Sprintf("session:%s", sessionID)
+	isSaved, err := r.redisClient.SetXX(ctx, sessionKey, string(byt), time.Until(ses.ExpiresAt)).Result()
+	if err != nil {
+		return err
+	}
+
+	if !isSaved {
+		return redis.Nil
+	}
+
+	return nil
+}
+
+func (r *repository) getSession(ctx context.Context, sessionID string) (session, error) {
+	sessionKey := fmt.Sprintf(sessionFmt, sessionID)
 
 	data, err := r.redisClient.Get(ctx, sessionKey).Result()
 	if err != nil {
-		return sessionValidationResponse{}, err
+		return session{}, err
 	}
 
 	var ses session
 
 	if err := json.Unmarshal([]byte(data), &ses); err != nil {
-		return sessionValidationResponse{}, err
+		return session{}, err
+	}
+
+	return ses, nil
+}
+
+// SessionValidationResponse is the authenticated caller of a request. For anonymous
+// sessions `User` only carries the anonymous ID, since there is no `users` row.
+// Callers using an API key only have `APIKey` set.
+type SessionValidationResponse struct {
+	User        userResponse `json:"user"`
+	Session     session      `json:"session"`
+	IsAnonymous bool         `json:"isAnonymous"`
+	APIKey      *apiKey      `json:"apiKey"`
+}
+
+var errSessionExpired = errors.New("session expired")
+
+func (r *repository) validateSessionToken(
+	ctx context.Context,
+	token string,
+) (SessionValidationResponse, error) {
+	sessionID := hashToken(token)
+
+	ses, err := r.getSession(ctx, sessionID)
+	if err != nil {
+		return SessionValidationResponse{}, err
 	}
 
 	now := time.Now()
 	if now.After(ses.ExpiresAt) || now.Equal(ses.ExpiresAt) {
-		if err := r.redisClient.Del(ctx, sessionKey).Err(); err != nil {
-			return sessionValidationResponse{}, err
+		if err := r.invalidateSession(ctx, ses); err != nil {
+			return SessionValidationResponse{}, err
 		}
 
-		userSessionsKey := fmt.Sprintf("user_sessions:%s", ses.UserID)
-		if err := r.redisClient.SRem(ctx, userSessionsKey, sessionID).Err(); err != nil {
-			return sessionValidationResponse{}, err
-		}
+		return SessionValidationResponse{}, errSessionExpired
+	}
+
+	isDirty := now.Sub(ses.LastSeenAt) >= lastSeenInterval
+	if isDirty {
+		ses.LastSeenAt = now
 	}
 
 	// If session is close to expiration (3 days), extend it
 	beforeExpiry := ses.ExpiresAt.Add(-3 * 24 * time.Hour)
 	if now.After(beforeExpiry) || now.Equal(beforeExpiry) {
 		ses.ExpiresAt = now.Add(7 * 24 * time.Hour)
+		isDirty = true
+	}
+
+	if isDirty {
+		if err := r.saveSession(ctx, ses); err != nil {
+			return SessionValidationResponse{}, err
+		}
+	}
 
-		if err := r.redisClient.Set(
-			ctx,
-			sessionKey,
-			ses,
-			time.Until(ses.ExpiresAt),
-		).Err(); err != nil {
-			return sessionValidationResponse{}, err
+	// Anonymous users don't have a row in `users`
+	if ses.IsAnonymous {
+		res := SessionValidationResponse{
+			Session:     ses,
+			User:        userResponse{BasicInfo: BasicInfo{UserID: ses.UserID}},
+			IsAnonymous: true,
 		}
+
+		return res, nil
 	}
 
 	user, err := r.Get(ctx, ses.UserID)
 	if err != nil {
-		return sessionValidationResponse{}, err
+		return SessionValidationResponse{}, err
+	}
+
+	// Checked here rather than when signing in, so requiring TOTP for a role
+	// also holds back the sessions its users already have
+	isEnabled, isRequired, err := r.getTOTPStatus(ctx, ses.UserID)
+	if err != nil {
+		return SessionValidationResponse{}, err
 	}
 
-	res := sessionValidationResponse{
+	ses.TOTPEnrollmentRequired = isRequired && !isEnabled
+
+	res := SessionValidationResponse{
 		Session: ses,
 		User:    user,
 	}
@@ -132,23 +247,209 @@ func (r *repository) validateSessionToken(
 	return res, nil
 }
 
-func (r *repository) invalidateSession(ctx context.Context, token, userID string) error {
-	hash := sha256.Sum256([]byte(token))
-	sessionID := hex.EncodeToString(hash[:])
-
-	sessionKey := fmt.Sprintf("session:%s", sessionID)
+func (r *repository) invalidateSession(ctx context.Context, ses session) error {
+	sessionKey := fmt.Sprintf(sessionFmt, ses.SessionID)
 	if err := r.redisClient.Del(ctx, sessionKey).Err(); err != nil {
 		return err
 	}
 
-	userSessionsKey := fmt.Sprintf("user_sessions:%s", userID)
-	if err := r.redisClient.SRem(ctx, userSessionsKey, sessionID).Err(); err != nil {
+	key := sessionsKey(ses.UserID, ses.IsAnonymous)
+	if err := r.redisClient.SRem(ctx, key, ses.SessionID).Err(); err != nil {
 		return err
 	}
 
 	return nil
 }
 
+func (r *repository) ListSessions(ctx context.Context, userID string) ([]session, error) {
+	userSessionsKey := fmt.Sprintf(userSessionsFmt, userID)
+
+	sessionIDs, err := r.redisClient.SMembers(ctx, userSessionsKey).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	pipe := r.redisClient.Pipeline()
+	cmds := make([]*redis.StringCmd, len(sessionIDs))
+
+	for i, sessionID := range sessionIDs {
+		cmds[i] = pipe.Get(ctx, fmt.Sprintf(sessionFmt, sessionID))
+	}
+
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return nil, err
+	}
+
+	sessions := []session{}
+	stale := []any{}
+
+	for i, cmd := range cmds {
+		data, err := cmd.Result()
+		if errors.Is(err, redis.Nil) {
+			// The session key expired on its own, but the set still has its ID
+			stale = append(stale, sessionIDs[i])
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var ses session
+
+		if err := json.Unmarshal([]byte(data), &ses); err != nil {
+			return nil, err
+		}
+
+		sessions = append(sessions, ses)
+	}
+
+	if len(stale) > 0 {
+		if err := r.redisClient.SRem(ctx, userSessionsKey, stale...).Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	slices.SortFunc(sessions, func(a, b session) int {
+		return b.LastSeenAt.Compare(a.LastSeenAt)
+	})
+
+	return sessions, nil
+}
+
+var errSessionNotFound = errors.New("session not found")
+
+// GetUserSession only returns sessions that belong to `userID`, so users can't
+// look up each other's sessions by ID.
+func (r *repository) GetUserSession(
+	ctx context.Context,
+	userID, sessionID string,
+) (session, error) {
+	userSessionsKey := fmt.Sprintf(userSessionsFmt, userID)
+
+	isMember, err := r.redisClient.SIsMember(ctx, userSessionsKey, sessionID).Result()
+	if err != nil {
+		return session{}, err
+	}
+
+	if !isMember {
+		return session{}, errSessionNotFound
+	}
+
+	ses, err := r.getSession(ctx, sessionID)
+	if errors.Is(err, redis.Nil) {
+		return session{}, errSessionNotFound
+	}
+	if err != nil {
+		return session{}, err
+	}
+
+	return ses, nil
+}
+
+func (r *repository) RevokeSession(ctx context.Context, userID, sessionID string) error {
+	ses, err := r.GetUserSession(ctx, userID, sessionID)
+	if err != nil {
+		return err
+	}
+
+	return r.invalidateSession(ctx, ses)
+}
+
+func (r *repository) RevokeAllSessions(ctx context.Context, userID string) error {
+	return r.revokeSessions(ctx, sessionsKey(userID, false))
+}
+
+// revokeSessions deletes every session in the set at `key`, see `sessionsKey`.
+func (r *repository) revokeSessions(ctx context.Context, key string) error {
+	sessionIDs, err := r.redisClient.SMembers(ctx, key).Result()
+	if err != nil {
+		return err
+	}
+
+	keys := []string{key}
+	for _, sessionID := range sessionIDs {
+		keys = append(keys, fmt.Sprintf(sessionFmt, sessionID))
+	}
+
+	return r.redisClient.Del(ctx, keys...).Err()
+}
+
+// RevokeOtherSessions signs the user out everywhere except `keepSessionID`.
+func (r *repository) RevokeOtherSessions(ctx context.Context, userID, keepSessionID string) error {
+	userSessionsKey := fmt.Sprintf(userSessionsFmt, userID)
+
+	sessionIDs, err := r.redisClient.SMembers(ctx, userSessionsKey).Result()
+	if err != nil {
+		return err
+	}
+
+	for _, sessionID := range sessionIDs {
+		if sessionID == keepSessionID {
+			continue
+		}
+
+		if err := r.invalidateSession(ctx, session{SessionID: sessionID, UserID: userID}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+const (
+	passwordResetFmt     = "password_reset:%s"
+	emailVerificationFmt = "email_verification:%s"
+
+	passwordResetTTL     = time.Hour
+	emailVerificationTTL = 24 * time.Hour
+)
+
+var errInvalidToken = errors.New("invalid or expired token")
+
+// Like sessions, only the hash of single-use tokens is stored. The token is
+// deleted as soon as it's read so it can't be replayed.
+func (r *repository) createSingleUseToken(
+	ctx context.Context,
+	keyFmt string,
+	value any,
+	ttl time.Duration,
+) (string, error) {
+	token, err := generateToken()
+	if err != nil {
+		return "", err
+	}
+
+	byt, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+
+	key := fmt.Sprintf(keyFmt, hashToken(token))
+	if err := r.redisClient.Set(ctx, key, string(byt), ttl).Err(); err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+func (r *repository) consumeSingleUseToken(
+	ctx context.Context,
+	keyFmt, token string,
+	value any,
+) error {
+	key := fmt.Sprintf(keyFmt, hashToken(token))
+
+	data, err := r.redisClient.GetDel(ctx, key).Result()
+	if errors.Is(err, redis.Nil) {
+		return errInvalidToken
+	}
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal([]byte(data), value)
+}
+
 func hashPassword(password string) (string, error) {
 	result, err := bcrypt.GenerateFromPassword([]byte(password), 14)
 	return string(result), err
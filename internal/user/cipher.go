@@ -0,0 +1,50 @@
+package user
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+)
+
+// NewCipher returns the AES-256-GCM cipher for the base64 encoded 32 byte
+// `key`. Used to encrypt medical profiles and TOTP secrets, each with its own key.
+func NewCipher(key string) (cipher.AEAD, error) {
+	byt, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(byt) != 32 {
+		return nil, fmt.Errorf("key must be 32 bytes, got %d", len(byt))
+	}
+
+	block, err := aes.NewCipher(byt)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts `plaintext` for the user `userID`. Their ID is authenticated
+// along with it, so data copied to another user's row fails to decrypt.
+func seal(aead cipher.AEAD, userID string, plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return aead.Seal(nonce, nonce, plaintext, []byte(userID)), nil
+}
+
+func unseal(aead cipher.AEAD, userID string, data []byte) ([]byte, error) {
+	nonceSize := aead.NonceSize()
+	if len(data) < nonceSize {
+		return nil, errors.New("ciphertext too short")
+	}
+
+	return aead.Open(nil, data[:nonceSize], data[nonceSize:], []byte(userID))
+}
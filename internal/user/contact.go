@@ -0,0 +1,398 @@
+package user
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/InternalPointerVariable/ResQLink-Backend/internal/mail"
+	"github.com/jackc/pgx/v5"
+	"github.com/redis/go-redis/v9"
+)
+
+// Emergency contacts are told when the user reports being in danger, so
+// families don't have to call the hotline to find out if their relatives are
+// safe. Contacts first have to agree through the link they're sent when added,
+// so the feature can't be used to message strangers.
+const (
+	maxEmergencyContacts = 5
+
+	emergencyStatusFmt              = "emergency_status:%s"
+	emergencyNotifiedFmt            = "emergency_notified:%s"
+	emergencyContactVerificationFmt = "emergency_contact_verification:%s"
+
+	// How long the status link sent to contacts keeps working
+	emergencyStatusTTL = 72 * time.Hour
+	// Contacts aren't notified again within this long, whatever the status
+	emergencyNotifyCooldown = time.Hour
+	// How long contacts have to agree to being one
+	emergencyContactVerificationTTL = 7 * 24 * time.Hour
+)
+
+var (
+	errInvalidEmergencyContact  = errors.New("invalid emergency contact")
+	errTooManyEmergencyContacts = errors.New("too many emergency contacts")
+)
+
+type emergencyContact struct {
+	EmergencyContactID string     `json:"id"`
+	CreatedAt          time.Time  `json:"createdAt"`
+	UpdatedAt          time.Time  `json:"updatedAt"`
+	Name               string     `json:"name"`
+	Relationship       *string    `json:"relationship"`
+	PhoneNumber        *string    `json:"phoneNumber"`
+	Email              *string    `json:"email"`
+	VerifiedAt         *time.Time `json:"verifiedAt"` // Only verified contacts are notified
+}
+
+const emergencyContactColumns = `
+    emergency_contact_id,
+    created_at,
+    updated_at,
+    name,
+    relationship,
+    phone_number,
+    email,
+    verified_at
+`
+
+// A contact needs at least a phone number or an email to be reached at
+type emergencyContactRequest struct {
+	Name         string  `json:"name"`
+	Relationship *string `json:"relationship"`
+	PhoneNumber  *string `json:"phoneNumber"`
+	Email        *string `json:"email"`
+}
+
+// normalize trims the request and turns empty fields into `nil`, returning
+// `errInvalidEmergencyContact` or `errInvalidPhoneNumber` when it's unusable.
+func (arg *emergencyContactRequest) normalize() error {
+	arg.Name = strings.TrimSpace(arg.Name)
+	arg.Relationship = trimToNil(arg.Relationship)
+	arg.PhoneNumber = trimToNil(arg.PhoneNumber)
+	arg.Email = trimToNil(arg.Email)
+
+	if arg.Name == "" || (arg.PhoneNumber == nil && arg.Email == nil) {
+		return errInvalidEmergencyContact
+	}
+
+	if arg.PhoneNumber != nil {
+		phoneNumber, err := normalizePhoneNumber(*arg.PhoneNumber)
+		if err != nil {
+			return err
+		}
+
+		arg.PhoneNumber = &phoneNumber
+	}
+
+	if arg.Email != nil && mail.ValidateAddress(*arg.Email) != nil {
+		return errInvalidEmergencyContact
+	}
+
+	return nil
+}
+
+func trimToNil(value *string) *string {
+	if value == nil {
+		return nil
+	}
+
+	trimmed := strings.TrimSpace(*value)
+	if trimmed == "" {
+		return nil
+	}
+
+	return &trimmed
+}
+
+func (r *repository) ListEmergencyContacts(
+	ctx context.Context,
+	userID string,
+) ([]emergencyContact, error) {
+	query := `
+    SELECT ` + emergencyContactColumns + ` FROM emergency_contacts
+    WHERE user_id = ($1)
+    ORDER BY created_at
+    `
+
+	rows, err := r.querier.Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, pgx.RowToStructByName[emergencyContact])
+}
+
+func (r *repository) CreateEmergencyContact(
+	ctx context.Context,
+	userID string,
+	arg emergencyContactRequest,
+) (emergencyContact, error) {
+	tx, err := r.querier.Begin(ctx)
+	if err != nil {
+		return emergencyContact{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	// Locks the user so concurrent requests can't go over the limit together
+	query := `SELECT user_id FROM users WHERE user_id = ($1) FOR UPDATE`
+
+	if _, err := tx.Exec(ctx, query, userID); err != nil {
+		return emergencyContact{}, err
+	}
+
+	query = `SELECT COUNT(*) FROM emergency_contacts WHERE user_id = ($1)`
+
+	var count int
+
+	if err := tx.QueryRow(ctx, query, userID).Scan(&count); err != nil {
+		return emergencyContact{}, err
+	}
+
+	if count >= maxEmergencyContacts {
+		return emergencyContact{}, errTooManyEmergencyContacts
+	}
+
+	query = `
+    INSERT INTO emergency_contacts (name, relationship, phone_number, email, user_id)
+    VALUES ($1, $2, $3, $4, $5)
+    RETURNING ` + emergencyContactColumns
+
+	rows, err := tx.Query(
+		ctx,
+		query,
+		arg.Name,
+		arg.Relationship,
+		arg.PhoneNumber,
+		arg.Email,
+		userID,
+	)
+	if err != nil {
+		return emergencyContact{}, err
+	}
+
+	created, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[emergencyContact])
+	if err != nil {
+		return emergencyContact{}, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return emergencyContact{}, err
+	}
+
+	return created, nil
+}
+
+// UpdateEmergencyContact replaces every field of the contact. Changing its phone
+// number or email has to be verified again. It returns `pgx.ErrNoRows` when the
+// contact isn't one of the user's.
+func (r *repository) UpdateEmergencyContact(
+	ctx context.Context,
+	userID, contactID string,
+	arg emergencyContactRequest,
+) (emergencyContact, error) {
+	query := `
+    UPDATE emergency_contacts
+    SET
+        name = ($1),
+        relationship = ($2),
+        phone_number = ($3),
+        email = ($4),
+        verified_at = CASE
+            WHEN phone_number IS NOT DISTINCT FROM ($3) AND email IS NOT DISTINCT FROM ($4)
+            THEN verified_at
+        END,
+        updated_at = NOW()
+    WHERE emergency_contact_id = ($5) AND user_id = ($6)
+    RETURNING ` + emergencyContactColumns
+
+	rows, err := r.querier.Query(
+		ctx,
+		query,
+		arg.Name,
+		arg.Relationship,
+		arg.PhoneNumber,
+		arg.Email,
+		contactID,
+		userID,
+	)
+	if err != nil {
+		return emergencyContact{}, err
+	}
+
+	return pgx.CollectOneRow(rows, pgx.RowToStructByName[emergencyContact])
+}
+
+func (r *repository) DeleteEmergencyContact(ctx context.Context, userID, contactID string) error {
+	query := `DELETE FROM emergency_contacts WHERE emergency_contact_id = ($1) AND user_id = ($2)`
+
+	tag, err := r.querier.Exec(ctx, query, contactID, userID)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+
+	return nil
+}
+
+// The contact details are kept with the token, so one sent before they changed
+// can't verify the new ones
+type emergencyContactVerification struct {
+	EmergencyContactID string  `json:"emergencyContactId"`
+	PhoneNumber        *string `json:"phoneNumber"`
+	Email              *string `json:"email"`
+}
+
+func (r *repository) CreateEmergencyContactVerification(
+	ctx context.Context,
+	contact emergencyContact,
+) (string, error) {
+	arg := emergencyContactVerification{
+		EmergencyContactID: contact.EmergencyContactID,
+		PhoneNumber:        contact.PhoneNumber,
+		Email:              contact.Email,
+	}
+
+	return r.createSingleUseToken(
+		ctx,
+		emergencyContactVerificationFmt,
+		arg,
+		emergencyContactVerificationTTL,
+	)
+}
+
+func (r *repository) VerifyEmergencyContact(ctx context.Context, token string) error {
+	var arg emergencyContactVerification
+
+	if err := r.consumeSingleUseToken(ctx, emergencyContactVerificationFmt, token, &arg); err != nil {
+		return err
+	}
+
+	query := `
+    UPDATE emergency_contacts
+    SET verified_at = COALESCE(verified_at, NOW())
+    WHERE emergency_contact_id = ($1)
+        AND phone_number IS NOT DISTINCT FROM ($2)
+        AND email IS NOT DISTINCT FROM ($3)
+    `
+
+	tag, err := r.querier.Exec(ctx, query, arg.EmergencyContactID, arg.PhoneNumber, arg.Email)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return errInvalidToken
+	}
+
+	return nil
+}
+
+// markEmergencyNotified returns false when the contacts were already told
+// anything recently, so repeated or alternating reports don't flood them.
+func (r *repository) markEmergencyNotified(ctx context.Context, userID string) (bool, error) {
+	key := fmt.Sprintf(emergencyNotifiedFmt, userID)
+
+	return r.redisClient.SetNX(ctx, key, time.Now().Unix(), emergencyNotifyCooldown).Result()
+}
+
+// Status links are stored like single-use tokens, but they're read without
+// being consumed so contacts can open them several times.
+func (r *repository) createEmergencyStatusToken(ctx context.Context, userID string) (string, error) {
+	return r.createSingleUseToken(ctx, emergencyStatusFmt, userID, emergencyStatusTTL)
+}
+
+// Only what a contact needs to know if the user is safe. The situation and the
+// location stay between the user and the responders.
+type emergencyStatusResponse struct {
+	Name                string     `json:"name"`
+	Status              *string    `json:"status"`
+	ReportedAt          *time.Time `json:"reportedAt"`
+	IsResponderAssigned bool       `json:"isResponderAssigned"`
+}
+
+type emergencyStatusRequest struct {
+	Token string `json:"token"`
+}
+
+// GetEmergencyStatus returns the latest status of the user a status link was
+// sent for.
+func (r *repository) GetEmergencyStatus(
+	ctx context.Context,
+	token string,
+) (emergencyStatusResponse, error) {
+	key := fmt.Sprintf(emergencyStatusFmt, hashToken(token))
+
+	data, err := r.redisClient.Get(ctx, key).Result()
+	if errors.Is(err, redis.Nil) {
+		return emergencyStatusResponse{}, errInvalidToken
+	}
+	if err != nil {
+		return emergencyStatusResponse{}, err
+	}
+
+	var userID string
+
+	if err := json.Unmarshal([]byte(data), &userID); err != nil {
+		return emergencyStatusResponse{}, err
+	}
+
+	query := `
+    SELECT
+        users.first_name,
+        users.last_name,
+        latest.status::text,
+        latest.created_at,
+        COALESCE(latest.responder_id IS NOT NULL, FALSE)
+    FROM users
+    LEFT JOIN reporters ON reporters.user_id = users.user_id
+    LEFT JOIN LATERAL (
+        SELECT status, created_at, responder_id
+        FROM disaster_reports
+        WHERE disaster_reports.reporter_id = reporters.reporter_id
+        ORDER BY created_at DESC
+        LIMIT 1
+    ) latest ON TRUE
+    WHERE users.user_id = ($1)
+    `
+
+	var firstName, lastName string
+	var res emergencyStatusResponse
+
+	row := r.querier.QueryRow(ctx, query, userID)
+	if err := row.Scan(
+		&firstName,
+		&lastName,
+		&res.Status,
+		&res.ReportedAt,
+		&res.IsResponderAssigned,
+	); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return emergencyStatusResponse{}, errInvalidToken
+		}
+
+		return emergencyStatusResponse{}, err
+	}
+
+	res.Name = redactedName(firstName, lastName)
+
+	return res, nil
+}
+
+// First name and last initial, e.g. "Juan D."
+func redactedName(firstName, lastName string) string {
+	if lastName == "" {
+		return firstName
+	}
+
+	initial, _ := utf8.DecodeRuneInString(lastName)
+
+	return fmt.Sprintf("%s %c.", firstName, initial)
+}
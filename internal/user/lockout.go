@@ -0,0 +1,178 @@
+package user
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"strings"
+	"time"
+)
+
+// Sign in attempts are throttled both per account, against guessing one
+// account's password or code, and per IP, against credential stuffing across
+// many accounts. Each failure past the limit doubles the lockout.
+type lockoutPolicy struct {
+	scope       string
+	maxFailures int64
+}
+
+var (
+	emailLockout = lockoutPolicy{scope: "email", maxFailures: 5}
+	phoneLockout = lockoutPolicy{scope: "phone", maxFailures: 5}
+	ipLockout    = lockoutPolicy{scope: "ip", maxFailures: 20}
+)
+
+const (
+	signInFailuresFmt = "sign_in_failures:%s:%s"
+	signInLockFmt     = "sign_in_lock:%s:%s"
+
+	// Failures are forgotten after this long without another one
+	signInFailureWindow = time.Hour
+
+	baseLockout = time.Minute
+	maxLockout  = time.Hour
+)
+
+type lockedOutError struct {
+	retryAfter time.Duration
+}
+
+func (e *lockedOutError) Error() string {
+	return fmt.Sprintf("sign in locked out, retry after %s", e.retryAfter)
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// checkLockout returns a `lockedOutError` while either the account, an email
+// or phone number depending on `account`, or the IP is locked out.
+func (r *repository) checkLockout(
+	ctx context.Context,
+	account lockoutPolicy,
+	subject, ip string,
+) error {
+	pipe := r.redisClient.Pipeline()
+	accountTTL := pipe.PTTL(ctx, fmt.Sprintf(signInLockFmt, account.scope, subject))
+	ipTTL := pipe.PTTL(ctx, fmt.Sprintf(signInLockFmt, ipLockout.scope, ip))
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
+	}
+
+	retryAfter := max(accountTTL.Val(), ipTTL.Val())
+	if retryAfter > 0 {
+		return &lockedOutError{retryAfter: retryAfter}
+	}
+
+	return nil
+}
+
+func (r *repository) recordFailedSignIn(
+	ctx context.Context,
+	account lockoutPolicy,
+	subject, ip string,
+) error {
+	// The audit log only has a column for emails
+	entry := authAuditEntry{IPAddress: &ip, Details: map[string]any{}}
+	if account == emailLockout {
+		entry.Email = &subject
+	} else {
+		entry.Details[account.scope] = subject
+	}
+
+	if err := r.recordFailure(ctx, account, subject, entry); err != nil {
+		return err
+	}
+
+	return r.recordFailure(ctx, ipLockout, ip, entry)
+}
+
+// recordFailure counts a failure against `subject` and locks it out past the
+// policy's limit, logging `entry` with the lockout's details.
+func (r *repository) recordFailure(
+	ctx context.Context,
+	policy lockoutPolicy,
+	subject string,
+	entry authAuditEntry,
+) error {
+	failuresKey := fmt.Sprintf(signInFailuresFmt, policy.scope, subject)
+
+	pipe := r.redisClient.TxPipeline()
+	incr := pipe.Incr(ctx, failuresKey)
+	pipe.Expire(ctx, failuresKey, signInFailureWindow)
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
+	}
+
+	failures := incr.Val()
+	if failures < policy.maxFailures {
+		return nil
+	}
+
+	lockout := maxLockout
+	if exp := failures - policy.maxFailures; exp < 6 {
+		lockout = min(baseLockout<<exp, maxLockout)
+	}
+
+	lockKey := fmt.Sprintf(signInLockFmt, policy.scope, subject)
+	if err := r.redisClient.Set(ctx, lockKey, failures, lockout).Err(); err != nil {
+		return err
+	}
+
+	details := map[string]any{
+		"scope":    policy.scope,
+		"failures": failures,
+		"lockout":  lockout.String(),
+	}
+	maps.Copy(details, entry.Details)
+
+	entry.Event = signInLockout
+	entry.Details = details
+
+	r.logAuthEvent(ctx, entry)
+
+	return nil
+}
+
+// Only the account's counter is reset on success, otherwise an attacker could
+// keep an IP unlocked by signing in to their own account in between.
+func (r *repository) resetFailedSignIns(ctx context.Context, account lockoutPolicy, subject string) error {
+	failuresKey := fmt.Sprintf(signInFailuresFmt, account.scope, subject)
+	return r.redisClient.Del(ctx, failuresKey).Err()
+}
+
+// Unlock lifts the email and phone number lockouts of `userID` early, e.g. after
+// an admin confirmed the owner's identity.
+func (r *repository) Unlock(ctx context.Context, userID, adminID string) error {
+	query := `SELECT COALESCE(email, ''), COALESCE(phone_number, '') FROM users WHERE user_id = ($1)`
+
+	var email, phoneNumber string
+
+	row := r.querier.QueryRow(ctx, query, userID)
+	if err := row.Scan(&email, &phoneNumber); err != nil {
+		return err
+	}
+
+	email = normalizeEmail(email)
+
+	if err := r.redisClient.Del(
+		ctx,
+		fmt.Sprintf(signInFailuresFmt, emailLockout.scope, email),
+		fmt.Sprintf(signInLockFmt, emailLockout.scope, email),
+		fmt.Sprintf(signInFailuresFmt, phoneLockout.scope, phoneNumber),
+		fmt.Sprintf(signInLockFmt, phoneLockout.scope, phoneNumber),
+	).Err(); err != nil {
+		return err
+	}
+
+	r.logAuthEvent(ctx, authAuditEntry{
+		Event:   signInUnlock,
+		UserID:  &userID,
+		Email:   &email,
+		Details: map[string]any{"unlockedBy": adminID},
+	})
+
+	return nil
+}
@@ -0,0 +1,217 @@
+package user
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Medical profiles are encrypted before they're stored, so they stay private
+// even in database backups. Only the owner and the responder assigned to them
+// can read them.
+type medicalProfile struct {
+	BloodType           *string  `json:"bloodType"`
+	Allergies           []string `json:"allergies"`
+	Medications         []string `json:"medications"`
+	Conditions          []string `json:"conditions"`
+	MobilityLimitations *string  `json:"mobilityLimitations"`
+	Notes               *string  `json:"notes"`
+}
+
+type medicalProfileResponse struct {
+	medicalProfile
+
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+type medicalProfileAccess struct {
+	AccessedAt time.Time  `json:"accessedAt"`
+	AccessedBy *BasicInfo `json:"accessedBy"` // Nil once the responder deleted their account
+	ReporterID *string    `json:"reporterId"`
+}
+
+var errMedicalProfileNotFound = errors.New("medical profile not found")
+
+func (r *repository) encryptMedicalProfile(userID string, profile medicalProfile) ([]byte, error) {
+	plaintext, err := json.Marshal(profile)
+	if err != nil {
+		return nil, err
+	}
+
+	return seal(r.medicalCipher, userID, plaintext)
+}
+
+func (r *repository) decryptMedicalProfile(userID string, data []byte) (medicalProfile, error) {
+	plaintext, err := unseal(r.medicalCipher, userID, data)
+	if err != nil {
+		return medicalProfile{}, err
+	}
+
+	var profile medicalProfile
+
+	if err := json.Unmarshal(plaintext, &profile); err != nil {
+		return medicalProfile{}, err
+	}
+
+	return profile, nil
+}
+
+func (r *repository) GetMedicalProfile(
+	ctx context.Context,
+	userID string,
+) (medicalProfileResponse, error) {
+	query := `SELECT data, updated_at FROM medical_profiles WHERE user_id = ($1)`
+
+	var data []byte
+	var res medicalProfileResponse
+
+	row := r.querier.QueryRow(ctx, query, userID)
+	if err := row.Scan(&data, &res.UpdatedAt); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return medicalProfileResponse{}, errMedicalProfileNotFound
+		}
+
+		return medicalProfileResponse{}, err
+	}
+
+	profile, err := r.decryptMedicalProfile(userID, data)
+	if err != nil {
+		return medicalProfileResponse{}, err
+	}
+
+	res.medicalProfile = profile
+
+	return res, nil
+}
+
+func (r *repository) SaveMedicalProfile(
+	ctx context.Context,
+	userID string,
+	profile medicalProfile,
+) (medicalProfileResponse, error) {
+	data, err := r.encryptMedicalProfile(userID, profile)
+	if err != nil {
+		return medicalProfileResponse{}, err
+	}
+
+	query := `
+    INSERT INTO medical_profiles (user_id, data)
+    VALUES ($1, $2)
+    ON CONFLICT (user_id) DO UPDATE
+        SET data = EXCLUDED.data, updated_at = NOW()
+    RETURNING updated_at
+    `
+
+	res := medicalProfileResponse{medicalProfile: profile}
+
+	row := r.querier.QueryRow(ctx, query, userID, data)
+	if err := row.Scan(&res.UpdatedAt); err != nil {
+		return medicalProfileResponse{}, err
+	}
+
+	return res, nil
+}
+
+func (r *repository) DeleteMedicalProfile(ctx context.Context, userID string) error {
+	query := `DELETE FROM medical_profiles WHERE user_id = ($1)`
+
+	tag, err := r.querier.Exec(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return errMedicalProfileNotFound
+	}
+
+	return nil
+}
+
+// GetAssignedMedicalProfile returns the medical profile of the user behind
+// `reporterID` when `responderUserID` is the responder on their latest open
+// report, and records the read. It returns `errMedicalProfileNotFound` for
+// anyone else, once the report is closed, or when there's no profile.
+func (r *repository) GetAssignedMedicalProfile(
+	ctx context.Context,
+	reporterID, responderUserID string,
+) (medicalProfileResponse, error) {
+	query := `
+    SELECT reporters.user_id
+    FROM reporters
+    JOIN LATERAL (
+        SELECT responder_id
+        FROM disaster_reports
+        WHERE disaster_reports.reporter_id = reporters.reporter_id
+            AND disaster_reports.state NOT IN ('resolved', 'cancelled')
+        ORDER BY disaster_reports.created_at DESC
+        LIMIT 1
+    ) latest ON TRUE
+    JOIN responders ON responders.responder_id = latest.responder_id
+    WHERE reporters.reporter_id = ($1)
+        AND reporters.user_id IS NOT NULL
+        AND responders.user_id = ($2)
+    `
+
+	var ownerID string
+
+	row := r.querier.QueryRow(ctx, query, reporterID, responderUserID)
+	if err := row.Scan(&ownerID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return medicalProfileResponse{}, errMedicalProfileNotFound
+		}
+
+		return medicalProfileResponse{}, err
+	}
+
+	profile, err := r.GetMedicalProfile(ctx, ownerID)
+	if err != nil {
+		return medicalProfileResponse{}, err
+	}
+
+	// Unlike auth audits, a read that can't be logged isn't allowed
+	query = `
+    INSERT INTO medical_profile_access_logs (user_id, accessed_by, reporter_id)
+    VALUES ($1, $2, $3)
+    `
+
+	if _, err := r.querier.Exec(ctx, query, ownerID, responderUserID, reporterID); err != nil {
+		return medicalProfileResponse{}, err
+	}
+
+	return profile, nil
+}
+
+// ListMedicalProfileAccesses lets owners see who read their profile.
+func (r *repository) ListMedicalProfileAccesses(
+	ctx context.Context,
+	userID string,
+) ([]medicalProfileAccess, error) {
+	query := `
+    SELECT
+        medical_profile_access_logs.created_at AS accessed_at,
+        CASE WHEN users.user_id IS NOT NULL THEN
+            jsonb_build_object(
+                'id', users.user_id,
+                'firstName', users.first_name,
+                'middleName', users.middle_name,
+                'lastName', users.last_name
+            )
+        ELSE NULL
+        END AS accessed_by,
+        medical_profile_access_logs.reporter_id
+    FROM medical_profile_access_logs
+    LEFT JOIN users ON users.user_id = medical_profile_access_logs.accessed_by
+    WHERE medical_profile_access_logs.user_id = ($1)
+    ORDER BY medical_profile_access_logs.created_at DESC
+    `
+
+	rows, err := r.querier.Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, pgx.RowToStructByName[medicalProfileAccess])
+}
@@ -0,0 +1,511 @@
+package user
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/jackc/pgx/v5"
+	"golang.org/x/oauth2"
+)
+
+// OIDCConfig is an agency's identity provider that staff can sign in with.
+// `RoleClaim` names the ID token claim holding the user's groups or roles, and
+// `Roles` maps its values to ours. Users with none of the mapped values can't
+// sign in. Existing accounts are only linked on sign in when their email is in
+// one of the agency's `EmailDomains`, others have to be linked by their owner
+// through `LinkOIDC`.
+type OIDCConfig struct {
+	Name         string          `json:"name"`
+	Issuer       string          `json:"issuer"`
+	ClientID     string          `json:"clientId"`
+	ClientSecret string          `json:"clientSecret"`
+	RedirectURL  string          `json:"redirectUrl"`
+	Scopes       []string        `json:"scopes"`
+	RoleClaim    string          `json:"roleClaim"`
+	Roles        map[string]Role `json:"roles"`
+	EmailDomains []string        `json:"emailDomains"`
+}
+
+// LoadOIDCConfig reads the providers from a JSON file. Environment variables in
+// it are expanded so client secrets don't have to be committed.
+func LoadOIDCConfig(path string) ([]OIDCConfig, error) {
+	byt, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var configs []OIDCConfig
+
+	if err := json.Unmarshal([]byte(os.ExpandEnv(string(byt))), &configs); err != nil {
+		return nil, err
+	}
+
+	for _, config := range configs {
+		if config.Name == "" || config.Issuer == "" || config.ClientID == "" {
+			return nil, fmt.Errorf("oidc provider %q: name, issuer and client id are required", config.Name)
+		}
+
+		for value, role := range config.Roles {
+			if !slices.Contains([]Role{Citizen, Responder, Dispatcher, Admin}, role) {
+				return nil, fmt.Errorf("oidc provider %q: invalid role %q for %q", config.Name, role, value)
+			}
+		}
+	}
+
+	return configs, nil
+}
+
+const (
+	oidcStateFmt = "oidc_state:%s"
+	oidcStateTTL = 10 * time.Minute
+
+	oidcDiscoveryTimeout = 10 * time.Second
+)
+
+var (
+	errOIDCProviderNotFound = errors.New("oidc provider not found")
+	errOIDCUnavailable      = errors.New("oidc provider unavailable")
+	errInvalidIDToken       = errors.New("invalid id token")
+	errOIDCEmailNotVerified = errors.New("oidc email not verified")
+	errOIDCNoRole           = errors.New("oidc claims map to no role")
+	errOIDCAccountExists    = errors.New("account exists outside of the oidc provider's domains")
+	errOIDCIdentityTaken    = errors.New("oidc identity linked to another account")
+)
+
+// oidcProvider discovers the issuer on first use rather than at startup, so an
+// identity provider being down doesn't keep the server from starting.
+type oidcProvider struct {
+	config OIDCConfig
+
+	mu       sync.Mutex
+	oauth2   *oauth2.Config
+	verifier *oidc.IDTokenVerifier
+}
+
+func newOIDCProviders(configs []OIDCConfig) map[string]*oidcProvider {
+	providers := make(map[string]*oidcProvider, len(configs))
+
+	for _, config := range configs {
+		providers[config.Name] = &oidcProvider{config: config}
+	}
+
+	return providers
+}
+
+func (p *oidcProvider) discover(ctx context.Context) (*oauth2.Config, *oidc.IDTokenVerifier, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.oauth2 != nil {
+		return p.oauth2, p.verifier, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, oidcDiscoveryTimeout)
+	defer cancel()
+
+	provider, err := oidc.NewProvider(ctx, p.config.Issuer)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %w", errOIDCUnavailable, err)
+	}
+
+	scopes := []string{oidc.ScopeOpenID, "email", "profile"}
+	for _, scope := range p.config.Scopes {
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	p.oauth2 = &oauth2.Config{
+		ClientID:     p.config.ClientID,
+		ClientSecret: p.config.ClientSecret,
+		RedirectURL:  p.config.RedirectURL,
+		Endpoint:     provider.Endpoint(),
+		Scopes:       scopes,
+	}
+	p.verifier = provider.Verifier(&oidc.Config{ClientID: p.config.ClientID})
+
+	return p.oauth2, p.verifier, nil
+}
+
+// Kept until the callback so it can only complete the flow it started
+type oidcState struct {
+	Provider     string `json:"provider"`
+	CodeVerifier string `json:"codeVerifier"`
+	Nonce        string `json:"nonce"`
+}
+
+type oidcAuthorizationResponse struct {
+	AuthorizationURL string `json:"authorizationUrl"`
+	State            string `json:"state"`
+}
+
+// authorizeOIDC starts an authorization code flow with PKCE. The state doubles as
+// the key to the verifier, which never leaves the server.
+func (r *repository) authorizeOIDC(
+	ctx context.Context,
+	provider *oidcProvider,
+) (oidcAuthorizationResponse, error) {
+	config, _, err := provider.discover(ctx)
+	if err != nil {
+		return oidcAuthorizationResponse{}, err
+	}
+
+	nonce, err := generateToken()
+	if err != nil {
+		return oidcAuthorizationResponse{}, err
+	}
+
+	verifier := oauth2.GenerateVerifier()
+
+	state, err := r.createSingleUseToken(ctx, oidcStateFmt, oidcState{
+		Provider:     provider.config.Name,
+		CodeVerifier: verifier,
+		Nonce:        nonce,
+	}, oidcStateTTL)
+	if err != nil {
+		return oidcAuthorizationResponse{}, err
+	}
+
+	return oidcAuthorizationResponse{
+		AuthorizationURL: config.AuthCodeURL(
+			state,
+			oauth2.S256ChallengeOption(verifier),
+			oidc.Nonce(nonce),
+		),
+		State: state,
+	}, nil
+}
+
+type oidcCallbackRequest struct {
+	Code  string `json:"code"`
+	State string `json:"state"`
+}
+
+type oidcClaims struct {
+	Issuer        string  `json:"iss"`
+	Subject       string  `json:"sub"`
+	Email         string  `json:"email"`
+	EmailVerified bool    `json:"email_verified"`
+	GivenName     string  `json:"given_name"`
+	MiddleName    *string `json:"middle_name"`
+	FamilyName    string  `json:"family_name"`
+	Name          string  `json:"name"`
+}
+
+// exchangeOIDC trades the code for an ID token and returns its verified claims
+// with the role they map to.
+func (r *repository) exchangeOIDC(
+	ctx context.Context,
+	provider *oidcProvider,
+	arg oidcCallbackRequest,
+) (oidcClaims, Role, error) {
+	var state oidcState
+
+	if err := r.consumeSingleUseToken(ctx, oidcStateFmt, arg.State, &state); err != nil {
+		return oidcClaims{}, "", err
+	}
+
+	if state.Provider != provider.config.Name {
+		return oidcClaims{}, "", errInvalidToken
+	}
+
+	config, verifier, err := provider.discover(ctx)
+	if err != nil {
+		return oidcClaims{}, "", err
+	}
+
+	token, err := config.Exchange(ctx, arg.Code, oauth2.VerifierOption(state.CodeVerifier))
+	if err != nil {
+		return oidcClaims{}, "", err
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return oidcClaims{}, "", fmt.Errorf("%w: missing from token response", errInvalidIDToken)
+	}
+
+	idToken, err := verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return oidcClaims{}, "", fmt.Errorf("%w: %w", errInvalidIDToken, err)
+	}
+
+	if idToken.Nonce != state.Nonce {
+		return oidcClaims{}, "", fmt.Errorf("%w: nonce mismatch", errInvalidIDToken)
+	}
+
+	var claims oidcClaims
+	if err := idToken.Claims(&claims); err != nil {
+		return oidcClaims{}, "", err
+	}
+
+	// Accounts are linked by email, so it has to be one the provider vouches for
+	if claims.Email == "" || !claims.EmailVerified {
+		return oidcClaims{}, "", errOIDCEmailNotVerified
+	}
+
+	var rawClaims map[string]any
+	if err := idToken.Claims(&rawClaims); err != nil {
+		return oidcClaims{}, "", err
+	}
+
+	role, ok := provider.mapRole(rawClaims[provider.config.RoleClaim])
+	if !ok {
+		return oidcClaims{}, "", errOIDCNoRole
+	}
+
+	return claims, role, nil
+}
+
+// The claim is usually a list of groups, but some providers send a single
+// string. When several values match, the most privileged role wins.
+func (p *oidcProvider) mapRole(claim any) (Role, bool) {
+	var values []string
+
+	switch claim := claim.(type) {
+	case string:
+		values = []string{claim}
+	case []any:
+		for _, value := range claim {
+			if value, ok := value.(string); ok {
+				values = append(values, value)
+			}
+		}
+	}
+
+	ranked := []Role{Admin, Dispatcher, Responder, Citizen}
+	best := len(ranked)
+
+	for _, value := range values {
+		role, ok := p.config.Roles[value]
+		if !ok {
+			continue
+		}
+
+		if i := slices.Index(ranked, role); i < best {
+			best = i
+		}
+	}
+
+	if best == len(ranked) {
+		return "", false
+	}
+
+	return ranked[best], true
+}
+
+// ownsEmail reports whether `email` is in one of the agency's domains, so an
+// account with it can be taken to belong to whoever the provider says it does.
+func (p *oidcProvider) ownsEmail(email string) bool {
+	i := strings.LastIndex(email, "@")
+	if i < 0 {
+		return false
+	}
+
+	domain := email[i+1:]
+
+	return slices.ContainsFunc(p.config.EmailDomains, func(d string) bool {
+		return strings.EqualFold(d, domain)
+	})
+}
+
+// SignInOIDC finds the user for the identity, linking an existing account in the
+// agency's domains or creating one on first sign in. The provider is the source
+// of truth for the role of the accounts it created, so theirs is updated on
+// every sign in. Users with TOTP still have to pass its challenge.
+func (r *repository) SignInOIDC(
+	ctx context.Context,
+	provider *oidcProvider,
+	claims oidcClaims,
+	role Role,
+	client clientInfo,
+) (signInResponse, error) {
+	tx, err := r.querier.Begin(ctx)
+	if err != nil {
+		return signInResponse{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+    UPDATE user_identities
+    SET last_signed_in_at = now()
+    WHERE issuer = ($1) AND subject = ($2)
+    RETURNING user_id, manages_role
+    `
+
+	var userID string
+	var managesRole, isLinked bool
+
+	err = tx.QueryRow(ctx, query, claims.Issuer, claims.Subject).Scan(&userID, &managesRole)
+	if errors.Is(err, pgx.ErrNoRows) {
+		userID, managesRole, err = r.linkOIDCIdentity(ctx, tx, provider, claims, role)
+		isLinked = err == nil
+	}
+	if err != nil {
+		return signInResponse{}, err
+	}
+
+	if managesRole {
+		query = `UPDATE users SET role = ($1), updated_at = now() WHERE user_id = ($2)`
+
+		if _, err := tx.Exec(ctx, query, role, userID); err != nil {
+			return signInResponse{}, err
+		}
+	}
+
+	// Only verifies the account's email when it's the one the provider vouched for
+	query = `
+    UPDATE users
+    SET email_verified_at = COALESCE(email_verified_at, now()), updated_at = now()
+    WHERE user_id = ($1) AND email = ($2)
+    `
+
+	if _, err := tx.Exec(ctx, query, userID, claims.Email); err != nil {
+		return signInResponse{}, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return signInResponse{}, err
+	}
+
+	if isLinked {
+		r.logAuthEvent(ctx, authAuditEntry{
+			Event:  oidcIdentityLinked,
+			UserID: &userID,
+			Email:  &claims.Email,
+			Details: map[string]any{
+				"issuer":  claims.Issuer,
+				"subject": claims.Subject,
+			},
+		})
+	}
+
+	user, err := r.Get(ctx, userID)
+	if err != nil {
+		return signInResponse{}, err
+	}
+
+	return r.completeSignIn(ctx, user, client)
+}
+
+// linkOIDCIdentity links the identity to the account with its email, creating
+// one when there's none. It reports whether the provider created the account and
+// so manages its role.
+func (r *repository) linkOIDCIdentity(
+	ctx context.Context,
+	tx pgx.Tx,
+	provider *oidcProvider,
+	claims oidcClaims,
+	role Role,
+) (string, bool, error) {
+	var userID string
+	var managesRole bool
+
+	query := `SELECT user_id FROM users WHERE email = ($1)`
+
+	err := tx.QueryRow(ctx, query, claims.Email).Scan(&userID)
+	if err == nil && !provider.ownsEmail(claims.Email) {
+		return "", false, errOIDCAccountExists
+	}
+	if errors.Is(err, pgx.ErrNoRows) {
+		managesRole = true
+
+		firstName, lastName := claims.GivenName, claims.FamilyName
+		if firstName == "" {
+			firstName = claims.Name
+		}
+
+		// The empty password hash never matches, so the account can only be
+		// signed in to through the provider until a password is set
+		query = `
+        INSERT INTO users (
+            email,
+            password_hash,
+            first_name,
+            middle_name,
+            last_name,
+            role,
+            status_update_frequency,
+            is_location_shared,
+            email_verified_at
+        )
+        VALUES ($1, '', $2, $3, $4, $5, make_interval(mins => 30), false, now())
+        RETURNING user_id
+        `
+
+		err = tx.QueryRow(
+			ctx,
+			query,
+			claims.Email,
+			firstName,
+			claims.MiddleName,
+			lastName,
+			role,
+		).Scan(&userID)
+	}
+	if err != nil {
+		return "", false, err
+	}
+
+	query = `
+    INSERT INTO user_identities (issuer, subject, user_id, manages_role)
+    VALUES ($1, $2, $3, $4)
+    `
+
+	if _, err := tx.Exec(ctx, query, claims.Issuer, claims.Subject, userID, managesRole); err != nil {
+		return "", false, err
+	}
+
+	return userID, managesRole, nil
+}
+
+// LinkOIDC links the identity to the signed in user, whatever their email. The
+// provider doesn't manage the role of accounts linked this way.
+func (r *repository) LinkOIDC(ctx context.Context, userID string, claims oidcClaims) error {
+	query := `
+    INSERT INTO user_identities (issuer, subject, user_id)
+    VALUES ($1, $2, $3)
+    ON CONFLICT (issuer, subject) DO NOTHING
+    RETURNING user_id
+    `
+
+	var linkedUserID string
+
+	err := r.querier.QueryRow(ctx, query, claims.Issuer, claims.Subject, userID).Scan(&linkedUserID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		// Already linked, which is only fine when it's to this user
+		query = `SELECT user_id FROM user_identities WHERE issuer = ($1) AND subject = ($2)`
+
+		if err := r.querier.QueryRow(ctx, query, claims.Issuer, claims.Subject).Scan(&linkedUserID); err != nil {
+			return err
+		}
+
+		if linkedUserID != userID {
+			return errOIDCIdentityTaken
+		}
+
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	r.logAuthEvent(ctx, authAuditEntry{
+		Event:  oidcIdentityLinked,
+		UserID: &userID,
+		Email:  &claims.Email,
+		Details: map[string]any{
+			"issuer":  claims.Issuer,
+			"subject": claims.Subject,
+		},
+	})
+
+	return nil
+}
@@ -0,0 +1,302 @@
+package user
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/redis/go-redis/v9"
+)
+
+// One-time codes sent by SMS, for citizens who sign in with a phone number
+// instead of an email
+const (
+	otpDigits = 6
+
+	otpFmt         = "otp:%s"
+	otpCooldownFmt = "otp_cooldown:%s"
+	otpSendsFmt    = "otp_sends:%s"
+	otpIPSendsFmt  = "otp_ip_sends:%s"
+
+	otpTTL         = 5 * time.Minute
+	otpCooldown    = time.Minute // Between two codes sent to the same number
+	otpSendsWindow = time.Hour
+
+	maxOTPAttempts = 5
+	maxOTPSends    = 5  // Per number and window
+	maxOTPIPSends  = 20 // Per IP and window, against pumping SMS to many numbers
+)
+
+var (
+	errInvalidPhoneNumber       = errors.New("invalid phone number")
+	errInvalidOTPCode           = errors.New("invalid otp code")
+	errPhoneNumberNotRegistered = errors.New("phone number not registered")
+)
+
+// normalizePhoneNumber returns the number in E.164, ignoring the spaces, dashes
+// and parentheses people usually type.
+func normalizePhoneNumber(phoneNumber string) (string, error) {
+	number := strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '-', '(', ')', '.':
+			return -1
+		}
+
+		return r
+	}, phoneNumber)
+
+	digits, ok := strings.CutPrefix(number, "+")
+	if !ok || len(digits) < 8 || len(digits) > 15 || digits[0] == '0' {
+		return "", errInvalidPhoneNumber
+	}
+
+	for _, r := range digits {
+		if r < '0' || r > '9' {
+			return "", errInvalidPhoneNumber
+		}
+	}
+
+	return number, nil
+}
+
+func generateOTP() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1_000_000))
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%0*d", otpDigits, n), nil
+}
+
+// The number is part of the hash so the same code sent to two numbers doesn't
+// hash the same.
+func hashOTP(phoneNumber, code string) string {
+	return hashToken(phoneNumber + ":" + code)
+}
+
+type otpRequest struct {
+	PhoneNumber string `json:"phoneNumber"`
+}
+
+// CreateOTP returns a new code for `phoneNumber`, replacing any previous one.
+// It returns a `rateLimitedError` when the number or IP asked for too many codes.
+func (r *repository) CreateOTP(ctx context.Context, phoneNumber, ip string) (string, error) {
+	cooldownKey := fmt.Sprintf(otpCooldownFmt, phoneNumber)
+
+	isFirst, err := r.redisClient.SetNX(ctx, cooldownKey, 1, otpCooldown).Result()
+	if err != nil {
+		return "", err
+	}
+
+	if !isFirst {
+		ttl, err := r.redisClient.PTTL(ctx, cooldownKey).Result()
+		if err != nil {
+			return "", err
+		}
+
+		return "", &rateLimitedError{retryAfter: ttl}
+	}
+
+	if err := r.countOTPSend(ctx, fmt.Sprintf(otpSendsFmt, phoneNumber), maxOTPSends); err != nil {
+		return "", err
+	}
+
+	if err := r.countOTPSend(ctx, fmt.Sprintf(otpIPSendsFmt, ip), maxOTPIPSends); err != nil {
+		return "", err
+	}
+
+	code, err := generateOTP()
+	if err != nil {
+		return "", err
+	}
+
+	key := fmt.Sprintf(otpFmt, phoneNumber)
+
+	pipe := r.redisClient.TxPipeline()
+	pipe.Del(ctx, key)
+	pipe.HSet(ctx, key, "hash", hashOTP(phoneNumber, code), "attempts", 0)
+	pipe.Expire(ctx, key, otpTTL)
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return "", err
+	}
+
+	return code, nil
+}
+
+func (r *repository) countOTPSend(ctx context.Context, key string, limit int64) error {
+	pipe := r.redisClient.TxPipeline()
+	incr := pipe.Incr(ctx, key)
+	pipe.ExpireNX(ctx, key, otpSendsWindow)
+	ttl := pipe.PTTL(ctx, key)
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
+	}
+
+	if incr.Val() > limit {
+		return &rateLimitedError{retryAfter: ttl.Val()}
+	}
+
+	return nil
+}
+
+// Names are only needed the first time a number signs in, to create its account
+type signInOTPRequest struct {
+	PhoneNumber string  `json:"phoneNumber"`
+	Code        string  `json:"code"`
+	FirstName   string  `json:"firstName"`
+	MiddleName  *string `json:"middleName"`
+	LastName    string  `json:"lastName"`
+}
+
+// SignInOTP signs in the account with the phone number, creating a citizen
+// account on first sign in. A code can only be guessed a few times before a new
+// one has to be requested.
+func (r *repository) SignInOTP(
+	ctx context.Context,
+	arg signInOTPRequest,
+	client clientInfo,
+) (signInResponse, error) {
+	query := `SELECT user_id FROM users WHERE phone_number = ($1)`
+
+	var userID string
+
+	err := r.querier.QueryRow(ctx, query, arg.PhoneNumber).Scan(&userID)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return signInResponse{}, err
+	}
+
+	// Checked before the code so it isn't used up by an incomplete sign up
+	if userID == "" && (arg.FirstName == "" || arg.LastName == "") {
+		return signInResponse{}, errPhoneNumberNotRegistered
+	}
+
+	if err := r.checkLockout(ctx, phoneLockout, arg.PhoneNumber, client.IPAddress); err != nil {
+		return signInResponse{}, err
+	}
+
+	if err := r.verifyOTP(ctx, arg.PhoneNumber, strings.TrimSpace(arg.Code)); err != nil {
+		if errors.Is(err, errInvalidOTPCode) {
+			if err := r.recordFailedSignIn(ctx, phoneLockout, arg.PhoneNumber, client.IPAddress); err != nil {
+				return signInResponse{}, err
+			}
+		}
+
+		return signInResponse{}, err
+	}
+
+	if err := r.resetFailedSignIns(ctx, phoneLockout, arg.PhoneNumber); err != nil {
+		return signInResponse{}, err
+	}
+
+	if userID == "" {
+		query = `
+        INSERT INTO users (
+            phone_number,
+            password_hash,
+            first_name,
+            middle_name,
+            last_name,
+            role,
+            status_update_frequency,
+            is_location_shared,
+            phone_verified_at
+        )
+        VALUES ($1, '', $2, $3, $4, $5, make_interval(mins => 30), false, now())
+        ON CONFLICT (phone_number) DO UPDATE SET updated_at = now()
+        RETURNING user_id
+        `
+
+		err = r.querier.QueryRow(
+			ctx,
+			query,
+			arg.PhoneNumber,
+			arg.FirstName,
+			arg.MiddleName,
+			arg.LastName,
+			Citizen,
+		).Scan(&userID)
+		if err != nil {
+			return signInResponse{}, err
+		}
+	} else {
+		query = `
+        UPDATE users
+        SET phone_verified_at = COALESCE(phone_verified_at, now()), updated_at = now()
+        WHERE user_id = ($1)
+        `
+
+		if _, err := r.querier.Exec(ctx, query, userID); err != nil {
+			return signInResponse{}, err
+		}
+	}
+
+	user, err := r.Get(ctx, userID)
+	if err != nil {
+		return signInResponse{}, err
+	}
+
+	return r.completeSignIn(ctx, user, client)
+}
+
+// Counts the attempt before handing out the code's hash, so concurrent guesses
+// can't get more than `maxOTPAttempts` comparisons between them. Returns nil once
+// the code is gone or used up.
+var attemptOTPScript = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 0 then
+    return nil
+end
+
+local attempts = redis.call("HINCRBY", KEYS[1], "attempts", 1)
+if attempts > tonumber(ARGV[1]) then
+    redis.call("DEL", KEYS[1])
+    return nil
+end
+
+return {attempts, redis.call("HGET", KEYS[1], "hash")}
+`)
+
+// verifyOTP deletes the code once it's used or guessed wrong too many times.
+func (r *repository) verifyOTP(ctx context.Context, phoneNumber, code string) error {
+	key := fmt.Sprintf(otpFmt, phoneNumber)
+
+	res, err := attemptOTPScript.Run(ctx, r.redisClient, []string{key}, maxOTPAttempts).Slice()
+	if errors.Is(err, redis.Nil) {
+		return errInvalidToken
+	}
+	if err != nil {
+		return err
+	}
+
+	attempts, _ := res[0].(int64)
+	hash, _ := res[1].(string)
+
+	if subtle.ConstantTimeCompare([]byte(hash), []byte(hashOTP(phoneNumber, code))) == 1 {
+		deleted, err := r.redisClient.Del(ctx, key).Result()
+		if err != nil {
+			return err
+		}
+
+		// Lost the race against another request with the same code
+		if deleted == 0 {
+			return errInvalidToken
+		}
+
+		return nil
+	}
+
+	if attempts >= maxOTPAttempts {
+		if err := r.redisClient.Del(ctx, key).Err(); err != nil {
+			return err
+		}
+	}
+
+	return errInvalidOTPCode
+}
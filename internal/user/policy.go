@@ -0,0 +1,238 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+
+	"github.com/InternalPointerVariable/ResQLink-Backend/internal/api"
+)
+
+type Role string
+
+const (
+	Citizen    Role = "citizen"
+	Responder  Role = "responder"
+	Dispatcher Role = "dispatcher"
+	Admin      Role = "admin"
+
+	// Not stored in `users`, used for callers signed in through `SignInAnonymous`
+	Anonymous Role = "anonymous"
+)
+
+var everyone = []Role{Citizen, Responder, Dispatcher, Admin, Anonymous}
+
+// Roles allowed for each HTTP route pattern (as registered on the mux) and each
+// WebSocket event. `ws:feed` is receiving every broadcast report event over the
+// WebSocket. Anything not listed here is denied.
+var policies = map[string][]Role{
+	"POST /api/sign-out": everyone,
+	"GET /api/session":   everyone,
+
+	"GET /api/sessions":                {Citizen, Responder, Dispatcher, Admin},
+	"DELETE /api/sessions":             {Citizen, Responder, Dispatcher, Admin},
+	"GET /api/sessions/{sessionId}":    {Citizen, Responder, Dispatcher, Admin},
+	"DELETE /api/sessions/{sessionId}": {Citizen, Responder, Dispatcher, Admin},
+
+	"GET /api/users/me":                  {Citizen, Responder, Dispatcher, Admin},
+	"PATCH /api/users/me":                {Citizen, Responder, Dispatcher, Admin},
+	"DELETE /api/users/me":               {Citizen, Responder, Dispatcher, Admin},
+	"GET /api/users/me/export":           {Citizen, Responder, Dispatcher, Admin},
+	"POST /api/users/me/password":        {Citizen, Responder, Dispatcher, Admin},
+	"POST /api/users/me/claim-anonymous": {Citizen, Responder, Dispatcher, Admin},
+	"POST /api/email/verification":       {Citizen, Responder, Dispatcher, Admin},
+	"POST /api/oidc/{provider}/link":     {Citizen, Responder, Dispatcher, Admin},
+
+	"GET /api/users/me/emergency-contacts":                {Citizen, Responder, Dispatcher, Admin},
+	"POST /api/users/me/emergency-contacts":               {Citizen, Responder, Dispatcher, Admin},
+	"PUT /api/users/me/emergency-contacts/{contactId}":    {Citizen, Responder, Dispatcher, Admin},
+	"DELETE /api/users/me/emergency-contacts/{contactId}": {Citizen, Responder, Dispatcher, Admin},
+
+	"GET /api/users/me/medical-profile":          {Citizen, Responder, Dispatcher, Admin},
+	"PUT /api/users/me/medical-profile":          {Citizen, Responder, Dispatcher, Admin},
+	"DELETE /api/users/me/medical-profile":       {Citizen, Responder, Dispatcher, Admin},
+	"GET /api/users/me/medical-profile/accesses": {Citizen, Responder, Dispatcher, Admin},
+
+	"POST /api/totp/enroll":        {Citizen, Responder, Dispatcher, Admin},
+	"POST /api/totp/confirm":       {Citizen, Responder, Dispatcher, Admin},
+	"DELETE /api/totp":             {Citizen, Responder, Dispatcher, Admin},
+	"GET /api/totp/required-roles": {Admin},
+	"PUT /api/totp/required-roles": {Admin},
+
+	"PATCH /api/users/{userId}/role":                  {Admin},
+	"GET /api/api-keys":                               {Admin},
+	"POST /api/api-keys":                              {Admin},
+	"POST /api/api-keys/{apiKeyId}/rotate":            {Admin},
+	"DELETE /api/api-keys/{apiKeyId}":                 {Admin},
+	"DELETE /api/users/{userId}/lockout":              {Admin},
+	"GET /api/users/{userId}/sessions":                {Admin},
+	"DELETE /api/users/{userId}/sessions":             {Admin},
+	"DELETE /api/users/{userId}/sessions/{sessionId}": {Admin},
+
+	"GET /api/households":                                   {Citizen, Responder, Dispatcher, Admin},
+	"POST /api/households":                                  {Citizen, Responder, Dispatcher, Admin},
+	"POST /api/households/join":                             {Citizen, Responder, Dispatcher, Admin},
+	"GET /api/households/{householdId}":                     {Citizen, Responder, Dispatcher, Admin},
+	"POST /api/households/{householdId}/invite-code":        {Citizen, Responder, Dispatcher, Admin},
+	"DELETE /api/households/{householdId}/members/{userId}": {Citizen, Responder, Dispatcher, Admin},
+
+	// Citizens and anonymous callers are limited to their own reporter by the handler
+	"GET /api/reporters/{reporterId}/reports":               everyone,
+	"PATCH /api/reporters/{reporterId}/reports":             {Responder, Dispatcher, Admin},
+	"GET /api/reports":                                      {Responder, Dispatcher, Admin},
+	"GET /api/reports/{reportId}":                           {Responder, Dispatcher, Admin},
+	"POST /api/reports/{reportId}/transitions":              {Responder, Dispatcher, Admin},
+	"PUT /api/reports/{reportId}/incident":                  {Dispatcher, Admin},
+	"GET /api/reports/{reportId}/duplicates":                {Responder, Dispatcher, Admin},
+	"POST /api/reports/{reportId}/merge":                    {Dispatcher, Admin},
+	"POST /api/reports/{reportId}/links":                    {Dispatcher, Admin},
+	"DELETE /api/reports/{reportId}/links/{linkedReportId}": {Dispatcher, Admin},
+	"GET /api/report-clusters":                              {Responder, Dispatcher, Admin},
+	"POST /api/reports":                                     everyone,
+	"POST /api/reports/multipart":                           everyone,
+	"POST /api/photos":                                      everyone,
+	"GET /api/photos/{photoId}":                             everyone,
+	"POST /api/reports/{reportId}/updates":                  everyone,
+	"GET /api/reports/{reportId}/messages":                  everyone,
+	"POST /api/reports/{reportId}/messages":                 everyone,
+	"POST /api/reports/{reportId}/messages/receipts":        everyone,
+
+	"GET /api/incidents":                 {Responder, Dispatcher, Admin},
+	"POST /api/incidents":                {Dispatcher, Admin},
+	"GET /api/incidents/{incidentId}":    {Responder, Dispatcher, Admin},
+	"PATCH /api/incidents/{incidentId}":  {Dispatcher, Admin},
+	"DELETE /api/incidents/{incidentId}": {Dispatcher, Admin},
+
+	"GET /api/hazard-zones":                   {Responder, Dispatcher, Admin},
+	"POST /api/hazard-zones":                  {Dispatcher, Admin},
+	"DELETE /api/hazard-zones/{hazardZoneId}": {Dispatcher, Admin},
+
+	"GET /ws": everyone,
+	"ws:feed": {Responder, Dispatcher, Admin},
+
+	"disaster:save_location":     everyone,
+	"disaster:set_responder":     {Responder, Dispatcher, Admin},
+	"disaster:transition_report": {Responder, Dispatcher, Admin},
+	"disaster:send_message":      everyone,
+	"disaster:mark_messages":     everyone,
+}
+
+// Scope an API key needs for each action. Actions not listed here can't be done
+// with an API key.
+var scopes = map[string]Scope{
+	"GET /api/reports":                          ReportsRead,
+	"GET /api/reports/{reportId}":               ReportsRead,
+	"GET /api/photos/{photoId}":                 ReportsRead,
+	"GET /api/hazard-zones":                     ReportsRead,
+	"GET /api/incidents":                        ReportsRead,
+	"GET /api/incidents/{incidentId}":           ReportsRead,
+	"POST /api/reports/{reportId}/transitions":  RespondersWrite,
+	"GET /api/reporters/{reporterId}/reports":   ReportsRead,
+	"PATCH /api/reporters/{reporterId}/reports": RespondersWrite,
+
+	"GET /ws": ReportsRead,
+	"ws:feed": ReportsRead,
+
+	"disaster:set_responder":     RespondersWrite,
+	"disaster:transition_report": RespondersWrite,
+}
+
+// The only actions allowed on a session that still has to set up TOTP
+var totpEnrollmentActions = []string{
+	"POST /api/sign-out",
+	"GET /api/session",
+	"POST /api/totp/enroll",
+	"POST /api/totp/confirm",
+}
+
+var (
+	ErrForbidden              = errors.New("forbidden")
+	errTOTPEnrollmentRequired = errors.New("totp enrollment required")
+)
+
+// Role of the caller for policy checks. API keys have no role.
+func (s SessionValidationResponse) Role() Role {
+	if s.APIKey != nil {
+		return ""
+	}
+
+	if s.IsAnonymous {
+		return Anonymous
+	}
+
+	return s.User.Role
+}
+
+// Authorize checks the caller in `ctx` against the policy for `action`, which is
+// either a route pattern or a WebSocket event.
+func Authorize(ctx context.Context, action string) error {
+	caller, ok := SessionFromContext(ctx)
+	if !ok {
+		return fmt.Errorf("authorize %s: %w", action, errNoSession)
+	}
+
+	if caller.APIKey != nil {
+		scope, ok := scopes[action]
+		if !ok || !caller.APIKey.hasScope(scope) {
+			return fmt.Errorf(
+				"authorize %s: %w for api key %s",
+				action,
+				ErrForbidden,
+				caller.APIKey.APIKeyID,
+			)
+		}
+
+		return nil
+	}
+
+	if caller.Session.TOTPEnrollmentRequired && !slices.Contains(totpEnrollmentActions, action) {
+		return fmt.Errorf("authorize %s: %w", action, errTOTPEnrollmentRequired)
+	}
+
+	roles, ok := policies[action]
+	if !ok || !slices.Contains(roles, caller.Role()) {
+		return fmt.Errorf(
+			"authorize %s: %w for %s (%s)",
+			action,
+			ErrForbidden,
+			caller.User.UserID,
+			caller.Role(),
+		)
+	}
+
+	return nil
+}
+
+// PolicyMiddleware resolves the route `mux` would dispatch to and rejects the
+// request with 403 when the caller's role isn't allowed on it. It must run after
+// `AuthMiddleware`.
+func (s *Server) PolicyMiddleware(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Let the mux answer 404s and 405s itself
+		if _, pattern := mux.Handler(r); pattern != "" {
+			if err := Authorize(r.Context(), pattern); err != nil {
+				slog.Error(err.Error())
+
+				res := api.Response{
+					Code:    http.StatusForbidden,
+					Message: "You are not allowed to do this.",
+				}
+
+				if errors.Is(err, errTOTPEnrollmentRequired) {
+					res.Message = "Set up two-factor authentication to continue."
+				}
+
+				if err := res.Encode(w); err != nil {
+					slog.Error(err.Error())
+				}
+
+				return
+			}
+		}
+
+		mux.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,113 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestAuthorize(t *testing.T) {
+	citizen := SessionValidationResponse{}
+	citizen.User.UserID = "user-1"
+	citizen.User.Role = Citizen
+
+	admin := SessionValidationResponse{}
+	admin.User.UserID = "user-2"
+	admin.User.Role = Admin
+
+	anonymous := SessionValidationResponse{IsAnonymous: true}
+	anonymous.User.UserID = "anon_ABC"
+
+	// Roles must not matter to anonymous callers, whatever they were stored with
+	anonymousAdmin := anonymous
+	anonymousAdmin.User.Role = Admin
+
+	enrolling := admin
+	enrolling.Session.TOTPEnrollmentRequired = true
+
+	readOnlyKey := SessionValidationResponse{
+		APIKey: &apiKey{APIKeyID: "key-1", Scopes: []Scope{ReportsRead}},
+	}
+
+	tests := []struct {
+		name    string
+		caller  *SessionValidationResponse
+		action  string
+		wantErr error
+	}{
+		{name: "no session", action: "GET /api/session", wantErr: errNoSession},
+		{name: "allowed role", caller: &citizen, action: "POST /api/reports"},
+		{
+			name:    "denied role",
+			caller:  &citizen,
+			action:  "GET /api/reports",
+			wantErr: ErrForbidden,
+		},
+		{name: "admin", caller: &admin, action: "PATCH /api/users/{userId}/role"},
+		{name: "anonymous", caller: &anonymous, action: "POST /api/reports"},
+		{
+			name:    "anonymous on account route",
+			caller:  &anonymous,
+			action:  "GET /api/users/me",
+			wantErr: ErrForbidden,
+		},
+		{
+			name:    "anonymous with a stored role",
+			caller:  &anonymousAdmin,
+			action:  "GET /api/reports",
+			wantErr: ErrForbidden,
+		},
+		{
+			name:    "unknown action",
+			caller:  &admin,
+			action:  "GET /api/unknown",
+			wantErr: ErrForbidden,
+		},
+		{name: "enrolling TOTP", caller: &enrolling, action: "POST /api/totp/enroll"},
+		{
+			name:    "enrolling TOTP elsewhere",
+			caller:  &enrolling,
+			action:  "GET /api/reports",
+			wantErr: errTOTPEnrollmentRequired,
+		},
+		{name: "api key with scope", caller: &readOnlyKey, action: "GET /api/reports"},
+		{
+			name:    "api key without scope",
+			caller:  &readOnlyKey,
+			action:  "POST /api/reports/{reportId}/transitions",
+			wantErr: ErrForbidden,
+		},
+		{
+			name:    "api key on action without scope",
+			caller:  &readOnlyKey,
+			action:  "POST /api/reports",
+			wantErr: ErrForbidden,
+		},
+		{name: "staff feed", caller: &admin, action: "ws:feed"},
+		{name: "api key feed", caller: &readOnlyKey, action: "ws:feed"},
+		{
+			name:    "citizen feed",
+			caller:  &citizen,
+			action:  "ws:feed",
+			wantErr: ErrForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.caller != nil {
+				ctx = WithSession(ctx, *tt.caller)
+			}
+
+			err := Authorize(ctx, tt.action)
+			if tt.wantErr == nil && err != nil {
+				t.Fatalf("err = %v, want nil", err)
+			}
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
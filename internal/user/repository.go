@@ -2,7 +2,10 @@ package user
 
 import (
 	"context"
+	"crypto/cipher"
 	"errors"
+	"fmt"
+	"time"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -11,25 +14,112 @@ import (
 
 type Repository interface {
 	Get(ctx context.Context, userID string) (userResponse, error)
-	SignUp(ctx context.Context, arg signUpRequest) error
-	SignIn(ctx context.Context, arg signInRequest) (signInResponse, error)
-	SignInAnonymous(ctx context.Context, anonID string) (signInAnonymousResponse, error)
+	SignUp(ctx context.Context, arg signUpRequest) (string, error)
+	SignIn(ctx context.Context, arg signInRequest, client clientInfo) (signInResponse, error)
+	SignInAnonymous(ctx context.Context, client clientInfo) (signInAnonymousResponse, error)
+	SignInOIDC(
+		ctx context.Context,
+		provider *oidcProvider,
+		claims oidcClaims,
+		role Role,
+		client clientInfo,
+	) (signInResponse, error)
+	LinkOIDC(ctx context.Context, userID string, claims oidcClaims) error
+	SignInOTP(ctx context.Context, arg signInOTPRequest, client clientInfo) (signInResponse, error)
+	SetRole(ctx context.Context, userID string, role Role) error
+	UpdateProfile(ctx context.Context, userID string, arg updateProfileRequest) (userResponse, error)
+	ChangePassword(ctx context.Context, ses session, arg changePasswordRequest) error
+	Reauthenticate(ctx context.Context, ses session, arg reauthRequest) error
+	Delete(ctx context.Context, user userResponse) error
+	Unlock(ctx context.Context, userID, adminID string) error
+
+	SignInTOTP(ctx context.Context, arg signInTOTPRequest, client clientInfo) (signInResponse, error)
+	StartTOTPEnrollment(ctx context.Context, user userResponse) (totpEnrollmentResponse, error)
+	ConfirmTOTPEnrollment(ctx context.Context, userID, code string) (recoveryCodesResponse, error)
+	DisableTOTP(ctx context.Context, userID, code string) error
+	ListTOTPRequiredRoles(ctx context.Context) ([]Role, error)
+	SetTOTPRequiredRoles(ctx context.Context, roles []Role) error
+	ClaimAnonymous(ctx context.Context, userID, anonID string) (claimAnonymousResponse, error)
+
+	ListEmergencyContacts(ctx context.Context, userID string) ([]emergencyContact, error)
+	CreateEmergencyContact(
+		ctx context.Context,
+		userID string,
+		arg emergencyContactRequest,
+	) (emergencyContact, error)
+	UpdateEmergencyContact(
+		ctx context.Context,
+		userID, contactID string,
+		arg emergencyContactRequest,
+	) (emergencyContact, error)
+	DeleteEmergencyContact(ctx context.Context, userID, contactID string) error
+	CreateEmergencyContactVerification(ctx context.Context, contact emergencyContact) (string, error)
+	VerifyEmergencyContact(ctx context.Context, token string) error
+	GetEmergencyStatus(ctx context.Context, token string) (emergencyStatusResponse, error)
+
+	GetMedicalProfile(ctx context.Context, userID string) (medicalProfileResponse, error)
+	SaveMedicalProfile(
+		ctx context.Context,
+		userID string,
+		profile medicalProfile,
+	) (medicalProfileResponse, error)
+	DeleteMedicalProfile(ctx context.Context, userID string) error
+	GetAssignedMedicalProfile(
+		ctx context.Context,
+		reporterID, responderUserID string,
+	) (medicalProfileResponse, error)
+	ListMedicalProfileAccesses(ctx context.Context, userID string) ([]medicalProfileAccess, error)
+
+	CreatePasswordReset(ctx context.Context, email string) (string, error)
+	ResetPassword(ctx context.Context, arg resetPasswordRequest) error
+	CreateEmailVerification(ctx context.Context, userID, email string) (string, error)
+	VerifyEmail(ctx context.Context, token string) error
+	CreateOTP(ctx context.Context, phoneNumber, ip string) (string, error)
+
+	ListSessions(ctx context.Context, userID string) ([]session, error)
+	GetUserSession(ctx context.Context, userID, sessionID string) (session, error)
+	RevokeSession(ctx context.Context, userID, sessionID string) error
+	RevokeAllSessions(ctx context.Context, userID string) error
+	RevokeOtherSessions(ctx context.Context, userID, keepSessionID string) error
+
+	ListAPIKeys(ctx context.Context) ([]apiKey, error)
+	CreateAPIKey(ctx context.Context, arg createAPIKeyRequest, createdBy string) (apiKeyResponse, error)
+	RotateAPIKey(ctx context.Context, apiKeyID string) (apiKeyResponse, error)
+	RevokeAPIKey(ctx context.Context, apiKeyID string) error
 
 	generateSessionToken() (string, error)
-	createSession(ctx context.Context, token, userID string, isAnon bool) (session, error)
-	validateSessionToken(ctx context.Context, token string) (sessionValidationResponse, error)
-	invalidateSession(ctx context.Context, sessionID, userID string) error
+	createSession(ctx context.Context, token string, ses session) (session, error)
+	validateSessionToken(ctx context.Context, token string) (SessionValidationResponse, error)
+	invalidateSession(ctx context.Context, ses session) error
+	validateAPIKey(ctx context.Context, key string) (SessionValidationResponse, error)
+	markEmergencyNotified(ctx context.Context, userID string) (bool, error)
+	createEmergencyStatusToken(ctx context.Context, userID string) (string, error)
+	authorizeOIDC(ctx context.Context, provider *oidcProvider) (oidcAuthorizationResponse, error)
+	exchangeOIDC(
+		ctx context.Context,
+		provider *oidcProvider,
+		arg oidcCallbackRequest,
+	) (oidcClaims, Role, error)
 }
 
 type repository struct {
-	querier     *pgxpool.Pool
-	redisClient *redis.Client
+	querier       *pgxpool.Pool
+	redisClient   *redis.Client
+	medicalCipher cipher.AEAD // See `NewCipher`
+	totpCipher    cipher.AEAD
 }
 
-func NewRepository(querier *pgxpool.Pool, redisClient *redis.Client) Repository {
+func NewRepository(
+	querier *pgxpool.Pool,
+	redisClient *redis.Client,
+	medicalCipher cipher.AEAD,
+	totpCipher cipher.AEAD,
+) Repository {
 	return &repository{
-		querier:     querier,
-		redisClient: redisClient,
+		querier:       querier,
+		redisClient:   redisClient,
+		medicalCipher: medicalCipher,
+		totpCipher:    totpCipher,
 	}
 }
 
@@ -46,7 +136,10 @@ func (r *repository) Get(ctx context.Context, userID string) (userResponse, erro
         birth_date,
         role,
         EXTRACT(epoch FROM status_update_frequency)::INT AS status_update_frequency,
-        is_location_shared
+        is_location_shared,
+        email_verified_at,
+        phone_number,
+        phone_verified_at
     FROM users
     WHERE user_id = ($1)
     `
@@ -64,10 +157,10 @@ func (r *repository) Get(ctx context.Context, userID string) (userResponse, erro
 	return user, nil
 }
 
-func (r *repository) SignUp(ctx context.Context, arg signUpRequest) error {
+func (r *repository) SignUp(ctx context.Context, arg signUpRequest) (string, error) {
 	passwordHash, err := hashPassword(arg.Password)
 	if err != nil {
-		return err
+		return "", err
 	}
 
 	query := `
@@ -87,9 +180,12 @@ func (r *repository) SignUp(ctx context.Context, arg signUpRequest) error {
         make_interval(mins => $8::int),
         $9
     )
+    RETURNING user_id
     `
 
-	if _, err := r.querier.Exec(ctx,
+	var userID string
+
+	row := r.querier.QueryRow(ctx,
 		query,
 		arg.Email,
 		passwordHash,
@@ -100,30 +196,57 @@ func (r *repository) SignUp(ctx context.Context, arg signUpRequest) error {
 		arg.Role,
 		arg.StatusUpdateFrequency,
 		arg.IsLocationShared,
-	); err != nil {
-		return err
+	)
+	if err := row.Scan(&userID); err != nil {
+		return "", err
 	}
 
-	return nil
+	return userID, nil
 }
 
 var errInvalidPassword = errors.New("invalid password")
 
-func (r *repository) SignIn(ctx context.Context, arg signInRequest) (signInResponse, error) {
-	query := `SELECT password_hash FROM users WHERE email = ($1)`
+func (r *repository) SignIn(
+	ctx context.Context,
+	arg signInRequest,
+	client clientInfo,
+) (signInResponse, error) {
+	email := normalizeEmail(arg.Email)
+
+	// Checked before bcrypt so locked out attempts cost nothing
+	if err := r.checkLockout(ctx, emailLockout, email, client.IPAddress); err != nil {
+		return signInResponse{}, err
+	}
+
+	// Emails are stored as typed at sign up, so they're compared lowercased
+	query := `SELECT password_hash FROM users WHERE lower(email) = ($1)`
 
 	var hashedPassword string
 
-	row := r.querier.QueryRow(ctx, query, arg.Email)
+	row := r.querier.QueryRow(ctx, query, email)
 	if err := row.Scan(&hashedPassword); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			if err := r.recordFailedSignIn(ctx, emailLockout, email, client.IPAddress); err != nil {
+				return signInResponse{}, err
+			}
+		}
+
 		return signInResponse{}, err
 	}
 
 	isMatch := checkPasswordHash(arg.Password, hashedPassword)
 	if !isMatch {
+		if err := r.recordFailedSignIn(ctx, emailLockout, email, client.IPAddress); err != nil {
+			return signInResponse{}, err
+		}
+
 		return signInResponse{}, errInvalidPassword
 	}
 
+	if err := r.resetFailedSignIns(ctx, emailLockout, email); err != nil {
+		return signInResponse{}, err
+	}
+
 	query = `
     SELECT 
         user_id, 
@@ -136,12 +259,15 @@ func (r *repository) SignIn(ctx context.Context, arg signInRequest) (signInRespo
         birth_date,
         role,
         EXTRACT(epoch FROM status_update_frequency)::INT AS status_update_frequency,
-        is_location_shared
+        is_location_shared,
+        email_verified_at,
+        phone_number,
+        phone_verified_at
     FROM users
-    WHERE email = ($1)
+    WHERE lower(email) = ($1)
     `
 
-	rows, err := r.querier.Query(ctx, query, arg.Email)
+	rows, err := r.querier.Query(ctx, query, email)
 	if err != nil {
 		return signInResponse{}, err
 	}
@@ -151,45 +277,561 @@ func (r *repository) SignIn(ctx context.Context, arg signInRequest) (signInRespo
 		return signInResponse{}, err
 	}
 
+	return r.completeSignIn(ctx, user, client)
+}
+
+// completeSignIn issues the session for a user whose first factor checked out,
+// or the TOTP challenge when they have it enabled.
+func (r *repository) completeSignIn(
+	ctx context.Context,
+	user userResponse,
+	client clientInfo,
+) (signInResponse, error) {
+	isEnabled, _, err := r.getTOTPStatus(ctx, user.UserID)
+	if err != nil {
+		return signInResponse{}, err
+	}
+
+	if isEnabled {
+		challenge, err := r.createTOTPChallenge(ctx, user.UserID)
+		if err != nil {
+			return signInResponse{}, err
+		}
+
+		return signInResponse{Challenge: &challenge}, nil
+	}
+
+	return r.issueSession(ctx, user, client)
+}
+
+func (r *repository) issueSession(
+	ctx context.Context,
+	user userResponse,
+	client clientInfo,
+) (signInResponse, error) {
 	token, err := r.generateSessionToken()
 	if err != nil {
 		return signInResponse{}, err
 	}
 
-	_, err = r.createSession(ctx, token, user.UserID, false)
+	_, err = r.createSession(ctx, token, session{
+		UserID:     user.UserID,
+		clientInfo: client,
+	})
 	if err != nil {
 		return signInResponse{}, err
 	}
 
 	return signInResponse{
-		User:  user,
+		User:  &user,
 		Token: token,
 	}, nil
 }
 
-type signInAnonymousRequest struct {
+type signInAnonymousResponse struct {
 	AnonymousID string `json:"anonymousId"`
+	Token       string `json:"token"`
 }
 
-type signInAnonymousResponse struct {
-	Token string `json:"token"`
-}
+// Anonymous IDs are generated here rather than picked by the client, so no one
+// can take over another's anonymous reports by reusing their ID. The prefix
+// keeps them from ever looking like a user ID.
+const anonymousIDPrefix = "anon_"
 
 func (r *repository) SignInAnonymous(
 	ctx context.Context,
-	anonID string,
+	client clientInfo,
 ) (signInAnonymousResponse, error) {
+	id, err := generateToken()
+	if err != nil {
+		return signInAnonymousResponse{}, err
+	}
+
+	anonID := anonymousIDPrefix + id
+
 	token, err := r.generateSessionToken()
 	if err != nil {
 		return signInAnonymousResponse{}, err
 	}
 
-	_, err = r.createSession(ctx, token, anonID, true)
+	_, err = r.createSession(ctx, token, session{
+		UserID:      anonID,
+		IsAnonymous: true,
+		clientInfo:  client,
+	})
 	if err != nil {
 		return signInAnonymousResponse{}, err
 	}
 
 	return signInAnonymousResponse{
-		Token: token,
+		AnonymousID: anonID,
+		Token:       token,
 	}, nil
 }
+
+func (r *repository) SetRole(ctx context.Context, userID string, role Role) error {
+	query := `
+    UPDATE users 
+    SET role = ($1), updated_at = NOW()
+    WHERE user_id = ($2)
+    `
+
+	tag, err := r.querier.Exec(ctx, query, role, userID)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+
+	return nil
+}
+
+type claimAnonymousRequest struct {
+	AnonymousToken string `json:"anonymousToken"`
+}
+
+type claimAnonymousResponse struct {
+	ReporterID *string `json:"reporterId"`
+}
+
+// Same key as the one `disaster.SaveLocation` writes to
+const reporterLocationFmt = "reporter:%s:location"
+
+// ClaimAnonymous moves everything reported, sent and uploaded under `anonID` to
+// the account of `userID`. If the user already has a reporter, the anonymous reports
+// are merged into it so they show up in a single history.
+func (r *repository) ClaimAnonymous(
+	ctx context.Context,
+	userID, anonID string,
+) (claimAnonymousResponse, error) {
+	tx, err := r.querier.Begin(ctx)
+	if err != nil {
+		return claimAnonymousResponse{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `UPDATE uploads SET user_id = ($1), anonymous_id = NULL WHERE anonymous_id = ($2)`
+
+	if _, err := tx.Exec(ctx, query, userID, anonID); err != nil {
+		return claimAnonymousResponse{}, err
+	}
+
+	query = `SELECT reporter_id FROM reporters WHERE anonymous_id = ($1) FOR UPDATE`
+
+	var anonReporterID string
+
+	row := tx.QueryRow(ctx, query, anonID)
+	if err := row.Scan(&anonReporterID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			if err := tx.Commit(ctx); err != nil {
+				return claimAnonymousResponse{}, err
+			}
+
+			// Nothing was reported anonymously, only the sessions are left
+			return claimAnonymousResponse{}, r.revokeSessions(ctx, sessionsKey(anonID, true))
+		}
+
+		return claimAnonymousResponse{}, err
+	}
+
+	// Messages and report creations by anonymous reporters have no user, so
+	// they're credited to the account before the reports are moved
+	query = `
+	UPDATE report_messages SET sender_user_id = ($1)
+	FROM disaster_reports
+	WHERE disaster_reports.disaster_report_id = report_messages.disaster_report_id
+		AND disaster_reports.reporter_id = ($2)
+		AND report_messages.sender_role = 'reporter'
+		AND report_messages.sender_user_id IS NULL
+	`
+
+	if _, err := tx.Exec(ctx, query, userID, anonReporterID); err != nil {
+		return claimAnonymousResponse{}, err
+	}
+
+	query = `
+	UPDATE report_events SET actor_user_id = ($1)
+	FROM disaster_reports
+	WHERE disaster_reports.disaster_report_id = report_events.disaster_report_id
+		AND disaster_reports.reporter_id = ($2)
+		AND report_events.from_state IS NULL
+		AND report_events.actor_user_id IS NULL
+		AND report_events.actor_api_key_id IS NULL
+	`
+
+	if _, err := tx.Exec(ctx, query, userID, anonReporterID); err != nil {
+		return claimAnonymousResponse{}, err
+	}
+
+	query = `SELECT reporter_id FROM reporters WHERE user_id = ($1) FOR UPDATE`
+
+	var userReporterID string
+
+	row = tx.QueryRow(ctx, query, userID)
+	if err := row.Scan(&userReporterID); err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return claimAnonymousResponse{}, err
+	}
+
+	if userReporterID == "" {
+		query = `
+		UPDATE reporters SET user_id = ($1), anonymous_id = NULL
+		WHERE reporter_id = ($2)
+		`
+
+		if _, err := tx.Exec(ctx, query, userID, anonReporterID); err != nil {
+			return claimAnonymousResponse{}, err
+		}
+
+		if err := tx.Commit(ctx); err != nil {
+			return claimAnonymousResponse{}, err
+		}
+
+		if err := r.revokeSessions(ctx, sessionsKey(anonID, true)); err != nil {
+			return claimAnonymousResponse{}, err
+		}
+
+		return claimAnonymousResponse{ReporterID: &anonReporterID}, nil
+	}
+
+	query = `UPDATE disaster_reports SET reporter_id = ($1) WHERE reporter_id = ($2)`
+
+	if _, err := tx.Exec(ctx, query, userReporterID, anonReporterID); err != nil {
+		return claimAnonymousResponse{}, err
+	}
+
+	query = `DELETE FROM reporters WHERE reporter_id = ($1)`
+
+	if _, err := tx.Exec(ctx, query, anonReporterID); err != nil {
+		return claimAnonymousResponse{}, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return claimAnonymousResponse{}, err
+	}
+
+	// The anonymous location is the most recent one since that's what the user
+	// was signed in as.
+	anonLocationKey := fmt.Sprintf(reporterLocationFmt, anonReporterID)
+	userLocationKey := fmt.Sprintf(reporterLocationFmt, userReporterID)
+
+	exists, err := r.redisClient.Exists(ctx, anonLocationKey).Result()
+	if err != nil {
+		return claimAnonymousResponse{}, err
+	}
+
+	if exists > 0 {
+		if err := r.redisClient.Rename(ctx, anonLocationKey, userLocationKey).Err(); err != nil {
+			return claimAnonymousResponse{}, err
+		}
+	}
+
+	if err := r.revokeSessions(ctx, sessionsKey(anonID, true)); err != nil {
+		return claimAnonymousResponse{}, err
+	}
+
+	return claimAnonymousResponse{ReporterID: &userReporterID}, nil
+}
+
+// CreatePasswordReset returns `pgx.ErrNoRows` when no user has the email.
+func (r *repository) CreatePasswordReset(ctx context.Context, email string) (string, error) {
+	query := `SELECT user_id FROM users WHERE email = ($1)`
+
+	var userID string
+
+	row := r.querier.QueryRow(ctx, query, email)
+	if err := row.Scan(&userID); err != nil {
+		return "", err
+	}
+
+	return r.createSingleUseToken(ctx, passwordResetFmt, userID, passwordResetTTL)
+}
+
+type resetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// ResetPassword also signs the user out everywhere, in case the password was
+// reset because the account was compromised.
+func (r *repository) ResetPassword(ctx context.Context, arg resetPasswordRequest) error {
+	var userID string
+
+	if err := r.consumeSingleUseToken(ctx, passwordResetFmt, arg.Token, &userID); err != nil {
+		return err
+	}
+
+	passwordHash, err := hashPassword(arg.Password)
+	if err != nil {
+		return err
+	}
+
+	query := `
+    UPDATE users 
+    SET password_hash = ($1), updated_at = NOW()
+    WHERE user_id = ($2)
+    `
+
+	if _, err := r.querier.Exec(ctx, query, passwordHash, userID); err != nil {
+		return err
+	}
+
+	return r.RevokeAllSessions(ctx, userID)
+}
+
+type emailVerification struct {
+	UserID string `json:"userId"`
+	Email  string `json:"email"`
+}
+
+func (r *repository) CreateEmailVerification(
+	ctx context.Context,
+	userID, email string,
+) (string, error) {
+	arg := emailVerification{
+		UserID: userID,
+		Email:  email,
+	}
+
+	return r.createSingleUseToken(ctx, emailVerificationFmt, arg, emailVerificationTTL)
+}
+
+func (r *repository) VerifyEmail(ctx context.Context, token string) error {
+	var arg emailVerification
+
+	if err := r.consumeSingleUseToken(ctx, emailVerificationFmt, token, &arg); err != nil {
+		return err
+	}
+
+	// The email is matched too, so a token sent before an email change can't
+	// verify the new address
+	query := `
+    UPDATE users 
+    SET email_verified_at = NOW(), updated_at = NOW()
+    WHERE user_id = ($1) AND email = ($2)
+    `
+
+	tag, err := r.querier.Exec(ctx, query, arg.UserID, arg.Email)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return errInvalidToken
+	}
+
+	return nil
+}
+
+// Fields left out of the request are kept as they are. An empty `middleName`
+// clears it.
+type updateProfileRequest struct {
+	FirstName             *string    `json:"firstName"`
+	MiddleName            *string    `json:"middleName"`
+	LastName              *string    `json:"lastName"`
+	BirthDate             *time.Time `json:"birthDate"`
+	StatusUpdateFrequency *uint      `json:"statusUpdateFrequency"`
+	IsLocationShared      *bool      `json:"isLocationShared"`
+}
+
+func (r *repository) UpdateProfile(
+	ctx context.Context,
+	userID string,
+	arg updateProfileRequest,
+) (userResponse, error) {
+	query := `
+    UPDATE users
+    SET
+        first_name = COALESCE($2, first_name),
+        middle_name = CASE WHEN $3::text IS NULL THEN middle_name ELSE NULLIF($3, '') END,
+        last_name = COALESCE($4, last_name),
+        birth_date = COALESCE($5, birth_date),
+        status_update_frequency = CASE 
+            WHEN $6::int IS NULL THEN status_update_frequency 
+            ELSE make_interval(mins => $6::int) 
+        END,
+        is_location_shared = COALESCE($7, is_location_shared),
+        updated_at = NOW()
+    WHERE user_id = ($1)
+    `
+
+	tag, err := r.querier.Exec(
+		ctx,
+		query,
+		userID,
+		arg.FirstName,
+		arg.MiddleName,
+		arg.LastName,
+		arg.BirthDate,
+		arg.StatusUpdateFrequency,
+		arg.IsLocationShared,
+	)
+	if err != nil {
+		return userResponse{}, err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return userResponse{}, pgx.ErrNoRows
+	}
+
+	// Stop sharing right away instead of waiting for the next location update
+	if arg.IsLocationShared != nil && !*arg.IsLocationShared {
+		if err := r.deleteLocation(ctx, userID); err != nil {
+			return userResponse{}, err
+		}
+	}
+
+	return r.Get(ctx, userID)
+}
+
+func (r *repository) deleteLocation(ctx context.Context, userID string) error {
+	query := `SELECT reporter_id FROM reporters WHERE user_id = ($1)`
+
+	var reporterID string
+
+	row := r.querier.QueryRow(ctx, query, userID)
+	if err := row.Scan(&reporterID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil
+		}
+
+		return err
+	}
+
+	return r.redisClient.Del(ctx, fmt.Sprintf(reporterLocationFmt, reporterID)).Err()
+}
+
+type changePasswordRequest struct {
+	CurrentPassword string `json:"currentPassword"`
+	NewPassword     string `json:"newPassword"`
+}
+
+// ChangePassword signs out every session except `ses`, the one used to change it.
+func (r *repository) ChangePassword(
+	ctx context.Context,
+	ses session,
+	arg changePasswordRequest,
+) error {
+	if err := r.CheckPassword(ctx, ses.UserID, arg.CurrentPassword); err != nil {
+		return err
+	}
+
+	passwordHash, err := hashPassword(arg.NewPassword)
+	if err != nil {
+		return err
+	}
+
+	query := `
+    UPDATE users 
+    SET password_hash = ($1), updated_at = NOW()
+    WHERE user_id = ($2)
+    `
+
+	if _, err := r.querier.Exec(ctx, query, passwordHash, ses.UserID); err != nil {
+		return err
+	}
+
+	return r.RevokeOtherSessions(ctx, ses.UserID, ses.SessionID)
+}
+
+// CheckPassword is for confirming sensitive actions of a signed in user.
+func (r *repository) CheckPassword(ctx context.Context, userID, password string) error {
+	query := `SELECT password_hash FROM users WHERE user_id = ($1)`
+
+	var hashedPassword string
+
+	row := r.querier.QueryRow(ctx, query, userID)
+	if err := row.Scan(&hashedPassword); err != nil {
+		return err
+	}
+
+	if !checkPasswordHash(password, hashedPassword) {
+		return errInvalidPassword
+	}
+
+	return nil
+}
+
+// How recently a session must have been signed in to stand in for a password
+const freshSessionAge = 10 * time.Minute
+
+var errReauthRequired = errors.New("reauthentication required")
+
+type reauthRequest struct {
+	Password     string `json:"password"`
+	TOTPCode     string `json:"totpCode"`
+	RecoveryCode string `json:"recoveryCode"`
+}
+
+// Reauthenticate confirms it's still the owner using `ses` before an action that
+// can't be undone. Accounts without a password, made through an identity
+// provider or sign in codes, confirm with TOTP or by having just signed in.
+func (r *repository) Reauthenticate(ctx context.Context, ses session, arg reauthRequest) error {
+	query := `SELECT password_hash FROM users WHERE user_id = ($1)`
+
+	var hashedPassword string
+
+	row := r.querier.QueryRow(ctx, query, ses.UserID)
+	if err := row.Scan(&hashedPassword); err != nil {
+		return err
+	}
+
+	if hashedPassword != "" {
+		if !checkPasswordHash(arg.Password, hashedPassword) {
+			return errInvalidPassword
+		}
+
+		return nil
+	}
+
+	if arg.TOTPCode != "" || arg.RecoveryCode != "" {
+		return r.verifyUserTOTP(ctx, ses.UserID, arg.TOTPCode, arg.RecoveryCode)
+	}
+
+	if time.Since(ses.CreatedAt) > freshSessionAge {
+		return errReauthRequired
+	}
+
+	return nil
+}
+
+// Delete removes the user and everything kept about them in Redis. Data owned
+// by other packages has to be erased before, see `PersonalDataStore`.
+func (r *repository) Delete(ctx context.Context, user userResponse) error {
+	query := `DELETE FROM users WHERE user_id = ($1)`
+
+	if _, err := r.querier.Exec(ctx, query, user.UserID); err != nil {
+		return err
+	}
+
+	if err := r.RevokeAllSessions(ctx, user.UserID); err != nil {
+		return err
+	}
+
+	keys := []string{
+		fmt.Sprintf(totpEnrollmentFmt, user.UserID),
+		fmt.Sprintf(totpLastStepFmt, user.UserID),
+		fmt.Sprintf(emergencyNotifiedFmt, user.UserID),
+	}
+
+	if user.Email != nil {
+		email := normalizeEmail(*user.Email)
+		keys = append(
+			keys,
+			fmt.Sprintf(signInFailuresFmt, emailLockout.scope, email),
+			fmt.Sprintf(signInLockFmt, emailLockout.scope, email),
+		)
+	}
+
+	if user.PhoneNumber != nil {
+		keys = append(
+			keys,
+			fmt.Sprintf(otpFmt, *user.PhoneNumber),
+			fmt.Sprintf(otpCooldownFmt, *user.PhoneNumber),
+			fmt.Sprintf(otpSendsFmt, *user.PhoneNumber),
+		)
+	}
+
+	return r.redisClient.Del(ctx, keys...).Err()
+}
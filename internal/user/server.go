@@ -1,35 +1,61 @@
 package user
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/InternalPointerVariable/ResQLink-Backend/internal/api"
+	"github.com/InternalPointerVariable/ResQLink-Backend/internal/mail"
+	"github.com/InternalPointerVariable/ResQLink-Backend/internal/sms"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
+	"golang.org/x/oauth2"
 )
 
 type Server struct {
-	repository Repository
+	repository   Repository
+	personalData PersonalDataStore
+	mailer       mail.Mailer
+	smsSender    sms.Sender
+	appURL       string // Used for links sent by email
+	oidc         map[string]*oidcProvider
 }
 
-func NewServer(repository Repository) *Server {
+// PersonalDataStore holds the user's data outside this package, for data privacy
+// requests. It's implemented by `disaster.Repository`, which can't be imported
+// here since it depends on this package for the caller of a request.
+type PersonalDataStore interface {
+	ExportPersonalData(ctx context.Context, userID string) (any, error)
+	ErasePersonalData(ctx context.Context, userID string) error
+}
+
+func NewServer(
+	repository Repository,
+	personalData PersonalDataStore,
+	mailer mail.Mailer,
+	smsSender sms.Sender,
+	appURL string,
+	oidcConfigs []OIDCConfig,
+) *Server {
 	return &Server{
-		repository: repository,
+		repository:   repository,
+		personalData: personalData,
+		mailer:       mailer,
+		smsSender:    smsSender,
+		appURL:       appURL,
+		oidc:         newOIDCProviders(oidcConfigs),
 	}
 }
 
-type role string
-
-const (
-	citizen   role = "citizen"
-	responder role = "responder"
-)
-
 type signUpRequest struct {
 	Email                 string    `json:"email"`
 	Password              string    `json:"password"`
@@ -37,7 +63,7 @@ type signUpRequest struct {
 	MiddleName            *string   `json:"middleName"`
 	LastName              string    `json:"lastName"`
 	BirthDate             time.Time `json:"birthDate"`
-	Role                  role      `json:"role"`
+	Role                  Role      `json:"-"` // Always citizen, see `SignUp`
 	StatusUpdateFrequency uint      `json:"statusUpdateFrequency"`
 	IsLocationShared      bool      `json:"isLocationShared"`
 }
@@ -56,7 +82,20 @@ func (s *Server) SignUp(w http.ResponseWriter, r *http.Request) api.Response {
 		}
 	}
 
-	if err := s.repository.SignUp(ctx, data); err != nil {
+	if err := mail.ValidateAddress(data.Email); err != nil {
+		return api.Response{
+			Error:   fmt.Errorf("sign up: %w", err),
+			Code:    http.StatusBadRequest,
+			Message: "Invalid email.",
+		}
+	}
+
+	// Only verified responders can take reports, so every other role is granted
+	// by an admin through `SetRole`
+	data.Role = Citizen
+
+	userID, err := s.repository.SignUp(ctx, data)
+	if err != nil {
 		if pgErr, ok := err.(*pgconn.PgError); ok && pgErr.Code == "23505" {
 			return api.Response{
 				Error:   fmt.Errorf("sign up: %w", err),
@@ -72,6 +111,12 @@ func (s *Server) SignUp(w http.ResponseWriter, r *http.Request) api.Response {
 		}
 	}
 
+	// Failing to send the verification shouldn't fail the sign up, since it can
+	// be requested again
+	if err := s.sendEmailVerification(ctx, userID, data.Email); err != nil {
+		slog.Error(fmt.Errorf("sign up: %w", err).Error())
+	}
+
 	return api.Response{
 		Code:    http.StatusCreated,
 		Message: "Successfully signed up.",
@@ -88,13 +133,30 @@ type BasicInfo struct {
 type userResponse struct {
 	BasicInfo
 
-	CreatedAt             time.Time `json:"createdAt"`
-	UpdatedAt             time.Time `json:"updatedAt"`
-	Email                 string    `json:"email"`
-	BirthDate             time.Time `json:"birthDate"`
-	Role                  role      `json:"role"`
-	StatusUpdateFrequency uint      `json:"statusUpdateFrequency"`
-	IsLocationShared      bool      `json:"isLocationShared"`
+	CreatedAt             time.Time  `json:"createdAt"`
+	UpdatedAt             time.Time  `json:"updatedAt"`
+	Email                 *string    `json:"email"`
+	BirthDate             *time.Time `json:"birthDate"`
+	Role                  Role       `json:"role"`
+	StatusUpdateFrequency uint       `json:"statusUpdateFrequency"`
+	IsLocationShared      bool       `json:"isLocationShared"`
+	EmailVerifiedAt       *time.Time `json:"emailVerifiedAt"`
+	PhoneNumber           *string    `json:"phoneNumber"`
+	PhoneVerifiedAt       *time.Time `json:"phoneVerifiedAt"`
+}
+
+// account is what the user signs in with, shown to them e.g. in authenticator
+// apps.
+func (u userResponse) account() string {
+	if u.Email != nil {
+		return *u.Email
+	}
+
+	if u.PhoneNumber != nil {
+		return *u.PhoneNumber
+	}
+
+	return u.UserID
 }
 
 type signInRequest struct {
@@ -102,9 +164,12 @@ type signInRequest struct {
 	Password string `json:"password"`
 }
 
+// When the user has TOTP enabled, only `Challenge` is set and has to be
+// completed through `SignInTOTP` to get the session token.
 type signInResponse struct {
-	User  userResponse `json:"user"`
-	Token string       `json:"token"`
+	User      *userResponse `json:"user"`
+	Token     string        `json:"token"`
+	Challenge *string       `json:"challenge"`
 }
 
 func (s *Server) SignIn(w http.ResponseWriter, r *http.Request) api.Response {
@@ -121,8 +186,19 @@ func (s *Server) SignIn(w http.ResponseWriter, r *http.Request) api.Response {
 		}
 	}
 
-	response, err := s.repository.SignIn(ctx, data)
+	response, err := s.repository.SignIn(ctx, data, clientInfoFromRequest(r))
 	if err != nil {
+		var lockedOut *lockedOutError
+		if errors.As(err, &lockedOut) {
+			setRetryAfter(w, lockedOut.retryAfter)
+
+			return api.Response{
+				Error:   fmt.Errorf("sign in: %w", err),
+				Code:    http.StatusTooManyRequests,
+				Message: "Too many failed sign in attempts. Try again later.",
+			}
+		}
+
 		if errors.Is(err, pgx.ErrNoRows) {
 			return api.Response{
 				Error:   fmt.Errorf("sign in: %w", err),
@@ -146,6 +222,14 @@ func (s *Server) SignIn(w http.ResponseWriter, r *http.Request) api.Response {
 		}
 	}
 
+	if response.Challenge != nil {
+		return api.Response{
+			Code:    http.StatusOK,
+			Message: "Two-factor authentication required.",
+			Data:    response,
+		}
+	}
+
 	return api.Response{
 		Code:    http.StatusOK,
 		Message: "Successfully signed in.",
@@ -153,21 +237,56 @@ func (s *Server) SignIn(w http.ResponseWriter, r *http.Request) api.Response {
 	}
 }
 
-func (s *Server) SignInAnonymous(w http.ResponseWriter, r *http.Request) api.Response {
+func (s *Server) SignInTOTP(w http.ResponseWriter, r *http.Request) api.Response {
 	ctx := r.Context()
 
-	var data signInAnonymousRequest
+	var data signInTOTPRequest
 
 	decoder := json.NewDecoder(r.Body)
 	if err := decoder.Decode(&data); err != nil {
 		return api.Response{
-			Error:   fmt.Errorf("sign in anon: %w", err),
+			Error:   fmt.Errorf("sign in totp: %w", err),
 			Code:    http.StatusBadRequest,
-			Message: "Invalid anonymous sign in request.",
+			Message: "Invalid two-factor sign in request.",
+		}
+	}
+
+	response, err := s.repository.SignInTOTP(ctx, data, clientInfoFromRequest(r))
+	if err != nil {
+		if errors.Is(err, errInvalidToken) {
+			return api.Response{
+				Error:   fmt.Errorf("sign in totp: %w", err),
+				Code:    http.StatusUnauthorized,
+				Message: "Sign in expired. Sign in again.",
+			}
+		}
+
+		if errors.Is(err, errInvalidTOTPCode) {
+			return api.Response{
+				Error:   fmt.Errorf("sign in totp: %w", err),
+				Code:    http.StatusUnauthorized,
+				Message: "Invalid code.",
+			}
+		}
+
+		return api.Response{
+			Error:   fmt.Errorf("sign in totp: %w", err),
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to sign in.",
 		}
 	}
 
-	response, err := s.repository.SignInAnonymous(ctx, data.AnonymousID)
+	return api.Response{
+		Code:    http.StatusOK,
+		Message: "Successfully signed in.",
+		Data:    response,
+	}
+}
+
+func (s *Server) SignInAnonymous(w http.ResponseWriter, r *http.Request) api.Response {
+	ctx := r.Context()
+
+	response, err := s.repository.SignInAnonymous(ctx, clientInfoFromRequest(r))
 	if err != nil {
 		return api.Response{
 			Error:   fmt.Errorf("sign in anon: %w", err),
@@ -183,78 +302,2255 @@ func (s *Server) SignInAnonymous(w http.ResponseWriter, r *http.Request) api.Res
 	}
 }
 
-type signOutRequest struct {
-	UserID string `json:"id"`
-	Token  string `json:"token"`
+func (s *Server) RequestOTP(w http.ResponseWriter, r *http.Request) api.Response {
+	ctx := r.Context()
+
+	var data otpRequest
+
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&data); err != nil {
+		return api.Response{
+			Error:   fmt.Errorf("request otp: %w", err),
+			Code:    http.StatusBadRequest,
+			Message: "Invalid code request.",
+		}
+	}
+
+	phoneNumber, err := normalizePhoneNumber(data.PhoneNumber)
+	if err != nil {
+		return api.Response{
+			Error:   fmt.Errorf("request otp: %w", err),
+			Code:    http.StatusBadRequest,
+			Message: "Invalid phone number. Include the country code, e.g. +639171234567.",
+		}
+	}
+
+	code, err := s.repository.CreateOTP(ctx, phoneNumber, clientInfoFromRequest(r).IPAddress)
+	if err != nil {
+		var rateLimited *rateLimitedError
+		if errors.As(err, &rateLimited) {
+			setRetryAfter(w, rateLimited.retryAfter)
+
+			return api.Response{
+				Error:   fmt.Errorf("request otp: %w", err),
+				Code:    http.StatusTooManyRequests,
+				Message: "Too many codes requested. Try again later.",
+			}
+		}
+
+		return api.Response{
+			Error:   fmt.Errorf("request otp: %w", err),
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to send code.",
+		}
+	}
+
+	s.sendSMS(sms.Message{
+		To: phoneNumber,
+		Body: fmt.Sprintf(
+			"Your ResQLink code is %s. It expires in %d minutes. Don't share it with anyone.",
+			code,
+			int(otpTTL.Minutes()),
+		),
+	})
+
+	return api.Response{
+		Code:    http.StatusOK,
+		Message: "Successfully sent code.",
+	}
 }
 
-func (s *Server) SignOut(w http.ResponseWriter, r *http.Request) api.Response {
+func (s *Server) VerifyOTP(w http.ResponseWriter, r *http.Request) api.Response {
 	ctx := r.Context()
 
-	var data signOutRequest
+	var data signInOTPRequest
 
 	decoder := json.NewDecoder(r.Body)
 	if err := decoder.Decode(&data); err != nil {
 		return api.Response{
-			Error:   fmt.Errorf("sign out: %w", err),
+			Error:   fmt.Errorf("verify otp: %w", err),
 			Code:    http.StatusBadRequest,
-			Message: "Invalid sign out request.",
+			Message: "Invalid verify code request.",
 		}
 	}
 
-	if err := s.repository.invalidateSession(ctx, data.Token, data.UserID); err != nil {
+	phoneNumber, err := normalizePhoneNumber(data.PhoneNumber)
+	if err != nil {
 		return api.Response{
-			Error:   fmt.Errorf("sign out: %w", err),
+			Error:   fmt.Errorf("verify otp: %w", err),
+			Code:    http.StatusBadRequest,
+			Message: "Invalid phone number. Include the country code, e.g. +639171234567.",
+		}
+	}
+
+	data.PhoneNumber = phoneNumber
+
+	response, err := s.repository.SignInOTP(ctx, data, clientInfoFromRequest(r))
+	if err != nil {
+		var lockedOut *lockedOutError
+		if errors.As(err, &lockedOut) {
+			setRetryAfter(w, lockedOut.retryAfter)
+
+			return api.Response{
+				Error:   fmt.Errorf("verify otp: %w", err),
+				Code:    http.StatusTooManyRequests,
+				Message: "Too many failed sign in attempts. Try again later.",
+			}
+		}
+
+		if errors.Is(err, errPhoneNumberNotRegistered) {
+			return api.Response{
+				Error:   fmt.Errorf("verify otp: %w", err),
+				Code:    http.StatusNotFound,
+				Message: "Enter your first and last name to create an account.",
+			}
+		}
+
+		if errors.Is(err, errInvalidToken) {
+			return api.Response{
+				Error:   fmt.Errorf("verify otp: %w", err),
+				Code:    http.StatusUnauthorized,
+				Message: "Code expired. Request a new one.",
+			}
+		}
+
+		if errors.Is(err, errInvalidOTPCode) {
+			return api.Response{
+				Error:   fmt.Errorf("verify otp: %w", err),
+				Code:    http.StatusUnauthorized,
+				Message: "Invalid code.",
+			}
+		}
+
+		return api.Response{
+			Error:   fmt.Errorf("verify otp: %w", err),
 			Code:    http.StatusInternalServerError,
-			Message: "Failed to sign out.",
+			Message: "Failed to sign in.",
+		}
+	}
+
+	if response.Challenge != nil {
+		return api.Response{
+			Code:    http.StatusOK,
+			Message: "Two-factor authentication required.",
+			Data:    response,
 		}
 	}
 
 	return api.Response{
 		Code:    http.StatusOK,
-		Message: "Successfully signed out.",
+		Message: "Successfully signed in.",
+		Data:    response,
 	}
 }
 
-func (s *Server) GetSession(w http.ResponseWriter, r *http.Request) api.Response {
+type oidcProviderResponse struct {
+	Name string `json:"name"`
+}
+
+func (s *Server) ListOIDCProviders(w http.ResponseWriter, r *http.Request) api.Response {
+	providers := []oidcProviderResponse{}
+	for name := range s.oidc {
+		providers = append(providers, oidcProviderResponse{Name: name})
+	}
+
+	slices.SortFunc(providers, func(a, b oidcProviderResponse) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return api.Response{
+		Code:    http.StatusOK,
+		Message: "Successfully fetched identity providers.",
+		Data:    providers,
+	}
+}
+
+// AuthorizeOIDC returns the URL to send the user to. The provider redirects back
+// to the app, which passes the code and state on to `SignInOIDC`.
+func (s *Server) AuthorizeOIDC(w http.ResponseWriter, r *http.Request) api.Response {
 	ctx := r.Context()
 
-	token := r.URL.Query().Get("token")
+	provider, ok := s.oidc[r.PathValue("provider")]
+	if !ok {
+		return api.Response{
+			Error:   fmt.Errorf("authorize oidc: %w", errOIDCProviderNotFound),
+			Code:    http.StatusNotFound,
+			Message: "Identity provider not found.",
+		}
+	}
 
-	result, err := s.repository.validateSessionToken(ctx, token)
+	response, err := s.repository.authorizeOIDC(ctx, provider)
 	if err != nil {
+		if errors.Is(err, errOIDCUnavailable) {
+			return api.Response{
+				Error:   fmt.Errorf("authorize oidc: %w", err),
+				Code:    http.StatusBadGateway,
+				Message: "Failed to reach the identity provider.",
+			}
+		}
+
 		return api.Response{
-			Error:   fmt.Errorf("get session: %w", err),
+			Error:   fmt.Errorf("authorize oidc: %w", err),
 			Code:    http.StatusInternalServerError,
-			Message: "Failed to get user session.",
+			Message: "Failed to start sign in.",
 		}
 	}
 
 	return api.Response{
 		Code:    http.StatusOK,
-		Message: "Successfully fetched user session.",
-		Data:    result,
+		Message: "Successfully started sign in.",
+		Data:    response,
 	}
 }
 
-func (s *Server) AuthMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		ctx := r.Context()
+func (s *Server) SignInOIDC(w http.ResponseWriter, r *http.Request) api.Response {
+	ctx := r.Context()
 
-		token, err := r.Cookie("session")
-		if err != nil {
-			slog.Error(err.Error())
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
-			return
+	provider, ok := s.oidc[r.PathValue("provider")]
+	if !ok {
+		return api.Response{
+			Error:   fmt.Errorf("sign in oidc: %w", errOIDCProviderNotFound),
+			Code:    http.StatusNotFound,
+			Message: "Identity provider not found.",
 		}
+	}
 
-		_, err = s.repository.validateSessionToken(ctx, token.Value)
-		if err != nil {
-			slog.Error(err.Error())
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
-			return
+	var data oidcCallbackRequest
+
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&data); err != nil {
+		return api.Response{
+			Error:   fmt.Errorf("sign in oidc: %w", err),
+			Code:    http.StatusBadRequest,
+			Message: "Invalid sign in request.",
 		}
+	}
 
-		next.ServeHTTP(w, r)
-	})
+	claims, role, err := s.repository.exchangeOIDC(ctx, provider, data)
+	if err != nil {
+		if res, ok := oidcErrorResponse(fmt.Errorf("sign in oidc: %w", err)); ok {
+			return res
+		}
+
+		return api.Response{
+			Error:   fmt.Errorf("sign in oidc: %w", err),
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to sign in.",
+		}
+	}
+
+	response, err := s.repository.SignInOIDC(ctx, provider, claims, role, clientInfoFromRequest(r))
+	if err != nil {
+		if errors.Is(err, errOIDCAccountExists) {
+			return api.Response{
+				Error:   fmt.Errorf("sign in oidc: %w", err),
+				Code:    http.StatusConflict,
+				Message: "An account with your email already exists. Sign in to it and link the identity provider from there.",
+			}
+		}
+
+		return api.Response{
+			Error:   fmt.Errorf("sign in oidc: %w", err),
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to sign in.",
+		}
+	}
+
+	return api.Response{
+		Code:    http.StatusOK,
+		Message: "Successfully signed in.",
+		Data:    response,
+	}
+}
+
+// LinkOIDC links an identity to the signed in user, for accounts that can't be
+// linked by email on sign in. The flow is started with `AuthorizeOIDC` as usual.
+func (s *Server) LinkOIDC(w http.ResponseWriter, r *http.Request) api.Response {
+	ctx := r.Context()
+
+	caller, ok := SessionFromContext(ctx)
+	if !ok {
+		return api.Response{
+			Error:   fmt.Errorf("link oidc: %w", errNoSession),
+			Code:    http.StatusUnauthorized,
+			Message: "Unauthorized.",
+		}
+	}
+
+	provider, ok := s.oidc[r.PathValue("provider")]
+	if !ok {
+		return api.Response{
+			Error:   fmt.Errorf("link oidc: %w", errOIDCProviderNotFound),
+			Code:    http.StatusNotFound,
+			Message: "Identity provider not found.",
+		}
+	}
+
+	var data oidcCallbackRequest
+
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&data); err != nil {
+		return api.Response{
+			Error:   fmt.Errorf("link oidc: %w", err),
+			Code:    http.StatusBadRequest,
+			Message: "Invalid link request.",
+		}
+	}
+
+	claims, _, err := s.repository.exchangeOIDC(ctx, provider, data)
+	if err != nil {
+		if res, ok := oidcErrorResponse(fmt.Errorf("link oidc: %w", err)); ok {
+			return res
+		}
+
+		return api.Response{
+			Error:   fmt.Errorf("link oidc: %w", err),
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to link the identity provider.",
+		}
+	}
+
+	if err := s.repository.LinkOIDC(ctx, caller.User.UserID, claims); err != nil {
+		if errors.Is(err, errOIDCIdentityTaken) {
+			return api.Response{
+				Error:   fmt.Errorf("link oidc: %w", err),
+				Code:    http.StatusConflict,
+				Message: "This identity is already linked to another account.",
+			}
+		}
+
+		return api.Response{
+			Error:   fmt.Errorf("link oidc: %w", err),
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to link the identity provider.",
+		}
+	}
+
+	return api.Response{
+		Code:    http.StatusOK,
+		Message: "Successfully linked the identity provider.",
+	}
+}
+
+// Responses for the errors of exchanging the code from an identity provider
+func oidcErrorResponse(err error) (api.Response, bool) {
+	var retrieveErr *oauth2.RetrieveError
+
+	switch {
+	case errors.Is(err, errInvalidToken), errors.As(err, &retrieveErr):
+		return api.Response{
+			Error:   err,
+			Code:    http.StatusUnauthorized,
+			Message: "Sign in expired. Sign in again.",
+		}, true
+	case errors.Is(err, errInvalidIDToken):
+		return api.Response{
+			Error:   err,
+			Code:    http.StatusUnauthorized,
+			Message: "Failed to verify the sign in.",
+		}, true
+	case errors.Is(err, errOIDCUnavailable):
+		return api.Response{
+			Error:   err,
+			Code:    http.StatusBadGateway,
+			Message: "Failed to reach the identity provider.",
+		}, true
+	case errors.Is(err, errOIDCEmailNotVerified):
+		return api.Response{
+			Error:   err,
+			Code:    http.StatusForbidden,
+			Message: "Your email is not verified by the identity provider.",
+		}, true
+	case errors.Is(err, errOIDCNoRole):
+		return api.Response{
+			Error:   err,
+			Code:    http.StatusForbidden,
+			Message: "Your account is not allowed to sign in here.",
+		}, true
+	}
+
+	return api.Response{}, false
+}
+
+func (s *Server) SignOut(w http.ResponseWriter, r *http.Request) api.Response {
+	ctx := r.Context()
+
+	caller, ok := SessionFromContext(ctx)
+	if !ok {
+		return api.Response{
+			Error:   fmt.Errorf("sign out: %w", errNoSession),
+			Code:    http.StatusUnauthorized,
+			Message: "Unauthorized.",
+		}
+	}
+
+	if err := s.repository.invalidateSession(ctx, caller.Session); err != nil {
+		return api.Response{
+			Error:   fmt.Errorf("sign out: %w", err),
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to sign out.",
+		}
+	}
+
+	return api.Response{
+		Code:    http.StatusOK,
+		Message: "Successfully signed out.",
+	}
+}
+
+func (s *Server) GetSession(w http.ResponseWriter, r *http.Request) api.Response {
+	ctx := r.Context()
+
+	caller, ok := SessionFromContext(ctx)
+	if !ok {
+		return api.Response{
+			Error:   fmt.Errorf("get session: %w", errNoSession),
+			Code:    http.StatusUnauthorized,
+			Message: "Unauthorized.",
+		}
+	}
+
+	return api.Response{
+		Code:    http.StatusOK,
+		Message: "Successfully fetched user session.",
+		Data:    caller,
+	}
+}
+
+type setRoleRequest struct {
+	Role Role `json:"role"`
+}
+
+func (s *Server) SetRole(w http.ResponseWriter, r *http.Request) api.Response {
+	ctx := r.Context()
+
+	var data setRoleRequest
+
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&data); err != nil {
+		return api.Response{
+			Error:   fmt.Errorf("set role: %w", err),
+			Code:    http.StatusBadRequest,
+			Message: "Invalid set role request.",
+		}
+	}
+
+	switch data.Role {
+	case Citizen, Responder, Dispatcher, Admin:
+	default:
+		return api.Response{
+			Error:   fmt.Errorf("set role: invalid role %q", data.Role),
+			Code:    http.StatusBadRequest,
+			Message: "Invalid role.",
+		}
+	}
+
+	userID := r.PathValue("userId")
+
+	if err := s.repository.SetRole(ctx, userID, data.Role); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return api.Response{
+				Error:   fmt.Errorf("set role: %w", err),
+				Code:    http.StatusNotFound,
+				Message: "User not found.",
+			}
+		}
+
+		return api.Response{
+			Error:   fmt.Errorf("set role: %w", err),
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to set role.",
+		}
+	}
+
+	return api.Response{
+		Code:    http.StatusOK,
+		Message: "Successfully set role.",
+	}
+}
+
+func (s *Server) GetProfile(w http.ResponseWriter, r *http.Request) api.Response {
+	ctx := r.Context()
+
+	caller, ok := SessionFromContext(ctx)
+	if !ok {
+		return api.Response{
+			Error:   fmt.Errorf("get profile: %w", errNoSession),
+			Code:    http.StatusUnauthorized,
+			Message: "Unauthorized.",
+		}
+	}
+
+	user, err := s.repository.Get(ctx, caller.User.UserID)
+	if err != nil {
+		return api.Response{
+			Error:   fmt.Errorf("get profile: %w", err),
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to get profile.",
+		}
+	}
+
+	return api.Response{
+		Code:    http.StatusOK,
+		Message: "Successfully fetched profile.",
+		Data:    user,
+	}
+}
+
+func (s *Server) UpdateProfile(w http.ResponseWriter, r *http.Request) api.Response {
+	ctx := r.Context()
+
+	caller, ok := SessionFromContext(ctx)
+	if !ok {
+		return api.Response{
+			Error:   fmt.Errorf("update profile: %w", errNoSession),
+			Code:    http.StatusUnauthorized,
+			Message: "Unauthorized.",
+		}
+	}
+
+	var data updateProfileRequest
+
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&data); err != nil {
+		return api.Response{
+			Error:   fmt.Errorf("update profile: %w", err),
+			Code:    http.StatusBadRequest,
+			Message: "Invalid update profile request.",
+		}
+	}
+
+	if (data.FirstName != nil && *data.FirstName == "") ||
+		(data.LastName != nil && *data.LastName == "") {
+		return api.Response{
+			Error:   fmt.Errorf("update profile: empty name"),
+			Code:    http.StatusBadRequest,
+			Message: "First and last name can't be empty.",
+		}
+	}
+
+	user, err := s.repository.UpdateProfile(ctx, caller.User.UserID, data)
+	if err != nil {
+		return api.Response{
+			Error:   fmt.Errorf("update profile: %w", err),
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to update profile.",
+		}
+	}
+
+	return api.Response{
+		Code:    http.StatusOK,
+		Message: "Successfully updated profile.",
+		Data:    user,
+	}
+}
+
+func (s *Server) ChangePassword(w http.ResponseWriter, r *http.Request) api.Response {
+	ctx := r.Context()
+
+	caller, ok := SessionFromContext(ctx)
+	if !ok {
+		return api.Response{
+			Error:   fmt.Errorf("change password: %w", errNoSession),
+			Code:    http.StatusUnauthorized,
+			Message: "Unauthorized.",
+		}
+	}
+
+	var data changePasswordRequest
+
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&data); err != nil {
+		return api.Response{
+			Error:   fmt.Errorf("change password: %w", err),
+			Code:    http.StatusBadRequest,
+			Message: "Invalid change password request.",
+		}
+	}
+
+	if data.NewPassword == "" {
+		return api.Response{
+			Error:   fmt.Errorf("change password: empty password"),
+			Code:    http.StatusBadRequest,
+			Message: "New password is required.",
+		}
+	}
+
+	if err := s.repository.ChangePassword(ctx, caller.Session, data); err != nil {
+		if errors.Is(err, errInvalidPassword) {
+			return api.Response{
+				Error:   fmt.Errorf("change password: %w", err),
+				Code:    http.StatusUnauthorized,
+				Message: "Invalid password.",
+			}
+		}
+
+		return api.Response{
+			Error:   fmt.Errorf("change password: %w", err),
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to change password.",
+		}
+	}
+
+	return api.Response{
+		Code:    http.StatusOK,
+		Message: "Successfully changed password.",
+	}
+}
+
+type personalDataExport struct {
+	ExportedAt             time.Time               `json:"exportedAt"`
+	User                   userResponse            `json:"user"`
+	Sessions               []session               `json:"sessions"`
+	EmergencyContacts      []emergencyContact      `json:"emergencyContacts"`
+	MedicalProfile         *medicalProfileResponse `json:"medicalProfile"`
+	MedicalProfileAccesses []medicalProfileAccess  `json:"medicalProfileAccesses"`
+	Reports                any                     `json:"reports"`
+}
+
+func (s *Server) ExportPersonalData(w http.ResponseWriter, r *http.Request) api.Response {
+	ctx := r.Context()
+
+	caller, ok := SessionFromContext(ctx)
+	if !ok {
+		return api.Response{
+			Error:   fmt.Errorf("export personal data: %w", errNoSession),
+			Code:    http.StatusUnauthorized,
+			Message: "Unauthorized.",
+		}
+	}
+
+	user, err := s.repository.Get(ctx, caller.User.UserID)
+	if err != nil {
+		return api.Response{
+			Error:   fmt.Errorf("export personal data: %w", err),
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to export personal data.",
+		}
+	}
+
+	sessions, err := s.repository.ListSessions(ctx, caller.User.UserID)
+	if err != nil {
+		return api.Response{
+			Error:   fmt.Errorf("export personal data: %w", err),
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to export personal data.",
+		}
+	}
+
+	contacts, err := s.repository.ListEmergencyContacts(ctx, caller.User.UserID)
+	if err != nil {
+		return api.Response{
+			Error:   fmt.Errorf("export personal data: %w", err),
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to export personal data.",
+		}
+	}
+
+	var medical *medicalProfileResponse
+
+	profile, err := s.repository.GetMedicalProfile(ctx, caller.User.UserID)
+	if err != nil && !errors.Is(err, errMedicalProfileNotFound) {
+		return api.Response{
+			Error:   fmt.Errorf("export personal data: %w", err),
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to export personal data.",
+		}
+	}
+
+	if err == nil {
+		medical = &profile
+	}
+
+	accesses, err := s.repository.ListMedicalProfileAccesses(ctx, caller.User.UserID)
+	if err != nil {
+		return api.Response{
+			Error:   fmt.Errorf("export personal data: %w", err),
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to export personal data.",
+		}
+	}
+
+	reports, err := s.personalData.ExportPersonalData(ctx, caller.User.UserID)
+	if err != nil {
+		return api.Response{
+			Error:   fmt.Errorf("export personal data: %w", err),
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to export personal data.",
+		}
+	}
+
+	w.Header().Set("Content-Disposition", `attachment; filename="resqlink-export.json"`)
+
+	return api.Response{
+		Code:    http.StatusOK,
+		Message: "Successfully exported personal data.",
+		Data: personalDataExport{
+			ExportedAt:             time.Now(),
+			User:                   user,
+			Sessions:               sessions,
+			EmergencyContacts:      contacts,
+			MedicalProfile:         medical,
+			MedicalProfileAccesses: accesses,
+			Reports:                reports,
+		},
+	}
+}
+
+// DeleteAccount erases the user's reports before the account itself, so a
+// failure halfway leaves an account that can simply be deleted again.
+func (s *Server) DeleteAccount(w http.ResponseWriter, r *http.Request) api.Response {
+	ctx := r.Context()
+
+	caller, ok := SessionFromContext(ctx)
+	if !ok {
+		return api.Response{
+			Error:   fmt.Errorf("delete account: %w", errNoSession),
+			Code:    http.StatusUnauthorized,
+			Message: "Unauthorized.",
+		}
+	}
+
+	var data reauthRequest
+
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&data); err != nil {
+		return api.Response{
+			Error:   fmt.Errorf("delete account: %w", err),
+			Code:    http.StatusBadRequest,
+			Message: "Invalid delete account request.",
+		}
+	}
+
+	if err := s.repository.Reauthenticate(ctx, caller.Session, data); err != nil {
+		switch {
+		case errors.Is(err, errInvalidPassword):
+			return api.Response{
+				Error:   fmt.Errorf("delete account: %w", err),
+				Code:    http.StatusUnauthorized,
+				Message: "Invalid password.",
+			}
+
+		case errors.Is(err, errInvalidTOTPCode), errors.Is(err, errTOTPNotEnabled):
+			return api.Response{
+				Error:   fmt.Errorf("delete account: %w", err),
+				Code:    http.StatusUnauthorized,
+				Message: "Invalid code.",
+			}
+
+		case errors.Is(err, errReauthRequired):
+			return api.Response{
+				Error:   fmt.Errorf("delete account: %w", err),
+				Code:    http.StatusUnauthorized,
+				Message: "Sign in again to delete your account.",
+			}
+		}
+
+		return api.Response{
+			Error:   fmt.Errorf("delete account: %w", err),
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to delete account.",
+		}
+	}
+
+	if err := s.personalData.ErasePersonalData(ctx, caller.User.UserID); err != nil {
+		return api.Response{
+			Error:   fmt.Errorf("delete account: %w", err),
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to delete account.",
+		}
+	}
+
+	if err := s.repository.Delete(ctx, caller.User); err != nil {
+		return api.Response{
+			Error:   fmt.Errorf("delete account: %w", err),
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to delete account.",
+		}
+	}
+
+	return api.Response{
+		Code:    http.StatusOK,
+		Message: "Successfully deleted account.",
+	}
+}
+
+func (s *Server) ListEmergencyContacts(w http.ResponseWriter, r *http.Request) api.Response {
+	ctx := r.Context()
+
+	caller, ok := SessionFromContext(ctx)
+	if !ok {
+		return api.Response{
+			Error:   fmt.Errorf("list emergency contacts: %w", errNoSession),
+			Code:    http.StatusUnauthorized,
+			Message: "Unauthorized.",
+		}
+	}
+
+	contacts, err := s.repository.ListEmergencyContacts(ctx, caller.User.UserID)
+	if err != nil {
+		return api.Response{
+			Error:   fmt.Errorf("list emergency contacts: %w", err),
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to get emergency contacts.",
+		}
+	}
+
+	return api.Response{
+		Code:    http.StatusOK,
+		Message: "Successfully fetched emergency contacts.",
+		Data:    contacts,
+	}
+}
+
+func (s *Server) CreateEmergencyContact(w http.ResponseWriter, r *http.Request) api.Response {
+	ctx := r.Context()
+
+	caller, ok := SessionFromContext(ctx)
+	if !ok {
+		return api.Response{
+			Error:   fmt.Errorf("create emergency contact: %w", errNoSession),
+			Code:    http.StatusUnauthorized,
+			Message: "Unauthorized.",
+		}
+	}
+
+	var data emergencyContactRequest
+
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&data); err != nil {
+		return api.Response{
+			Error:   fmt.Errorf("create emergency contact: %w", err),
+			Code:    http.StatusBadRequest,
+			Message: "Invalid create emergency contact request.",
+		}
+	}
+
+	if err := data.normalize(); err != nil {
+		return invalidEmergencyContact(fmt.Errorf("create emergency contact: %w", err))
+	}
+
+	contact, err := s.repository.CreateEmergencyContact(ctx, caller.User.UserID, data)
+	if err != nil {
+		if errors.Is(err, errTooManyEmergencyContacts) {
+			return api.Response{
+				Error:   fmt.Errorf("create emergency contact: %w", err),
+				Code:    http.StatusConflict,
+				Message: fmt.Sprintf("You can only have %d emergency contacts.", maxEmergencyContacts),
+			}
+		}
+
+		return api.Response{
+			Error:   fmt.Errorf("create emergency contact: %w", err),
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to create emergency contact.",
+		}
+	}
+
+	// Like the email verification on sign up, it can be sent again by saving
+	// the contact
+	if err := s.sendEmergencyContactVerification(ctx, caller.User, contact); err != nil {
+		slog.Error(fmt.Errorf("create emergency contact: %w", err).Error())
+	}
+
+	return api.Response{
+		Code:    http.StatusCreated,
+		Message: "Successfully created emergency contact.",
+		Data:    contact,
+	}
+}
+
+func (s *Server) UpdateEmergencyContact(w http.ResponseWriter, r *http.Request) api.Response {
+	ctx := r.Context()
+
+	caller, ok := SessionFromContext(ctx)
+	if !ok {
+		return api.Response{
+			Error:   fmt.Errorf("update emergency contact: %w", errNoSession),
+			Code:    http.StatusUnauthorized,
+			Message: "Unauthorized.",
+		}
+	}
+
+	var data emergencyContactRequest
+
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&data); err != nil {
+		return api.Response{
+			Error:   fmt.Errorf("update emergency contact: %w", err),
+			Code:    http.StatusBadRequest,
+			Message: "Invalid update emergency contact request.",
+		}
+	}
+
+	if err := data.normalize(); err != nil {
+		return invalidEmergencyContact(fmt.Errorf("update emergency contact: %w", err))
+	}
+
+	contact, err := s.repository.UpdateEmergencyContact(
+		ctx,
+		caller.User.UserID,
+		r.PathValue("contactId"),
+		data,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return api.Response{
+				Error:   fmt.Errorf("update emergency contact: %w", err),
+				Code:    http.StatusNotFound,
+				Message: "Emergency contact not found.",
+			}
+		}
+
+		return api.Response{
+			Error:   fmt.Errorf("update emergency contact: %w", err),
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to update emergency contact.",
+		}
+	}
+
+	if contact.VerifiedAt == nil {
+		if err := s.sendEmergencyContactVerification(ctx, caller.User, contact); err != nil {
+			slog.Error(fmt.Errorf("update emergency contact: %w", err).Error())
+		}
+	}
+
+	return api.Response{
+		Code:    http.StatusOK,
+		Message: "Successfully updated emergency contact.",
+		Data:    contact,
+	}
+}
+
+func (s *Server) DeleteEmergencyContact(w http.ResponseWriter, r *http.Request) api.Response {
+	ctx := r.Context()
+
+	caller, ok := SessionFromContext(ctx)
+	if !ok {
+		return api.Response{
+			Error:   fmt.Errorf("delete emergency contact: %w", errNoSession),
+			Code:    http.StatusUnauthorized,
+			Message: "Unauthorized.",
+		}
+	}
+
+	if err := s.repository.DeleteEmergencyContact(
+		ctx,
+		caller.User.UserID,
+		r.PathValue("contactId"),
+	); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return api.Response{
+				Error:   fmt.Errorf("delete emergency contact: %w", err),
+				Code:    http.StatusNotFound,
+				Message: "Emergency contact not found.",
+			}
+		}
+
+		return api.Response{
+			Error:   fmt.Errorf("delete emergency contact: %w", err),
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to delete emergency contact.",
+		}
+	}
+
+	return api.Response{
+		Code:    http.StatusOK,
+		Message: "Successfully deleted emergency contact.",
+	}
+}
+
+func invalidEmergencyContact(err error) api.Response {
+	if errors.Is(err, errInvalidPhoneNumber) {
+		return api.Response{
+			Error:   err,
+			Code:    http.StatusBadRequest,
+			Message: "Invalid phone number. Include the country code, e.g. +639171234567.",
+		}
+	}
+
+	return api.Response{
+		Error:   err,
+		Code:    http.StatusBadRequest,
+		Message: "A name and either a phone number or an email are required.",
+	}
+}
+
+// GetEmergencyStatus is opened from the link sent to emergency contacts, who
+// usually don't have an account.
+func (s *Server) GetEmergencyStatus(w http.ResponseWriter, r *http.Request) api.Response {
+	ctx := r.Context()
+
+	var data emergencyStatusRequest
+
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&data); err != nil {
+		return api.Response{
+			Error:   fmt.Errorf("get emergency status: %w", err),
+			Code:    http.StatusBadRequest,
+			Message: "Invalid emergency status request.",
+		}
+	}
+
+	status, err := s.repository.GetEmergencyStatus(ctx, data.Token)
+	if err != nil {
+		if errors.Is(err, errInvalidToken) {
+			return api.Response{
+				Error:   fmt.Errorf("get emergency status: %w", err),
+				Code:    http.StatusNotFound,
+				Message: "Invalid or expired status link.",
+			}
+		}
+
+		return api.Response{
+			Error:   fmt.Errorf("get emergency status: %w", err),
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to get status.",
+		}
+	}
+
+	return api.Response{
+		Code:    http.StatusOK,
+		Message: "Successfully fetched status.",
+		Data:    status,
+	}
+}
+
+// sendEmergencyContactVerification asks the contact to agree to being told when
+// the user is in danger.
+func (s *Server) sendEmergencyContactVerification(
+	ctx context.Context,
+	user userResponse,
+	contact emergencyContact,
+) error {
+	token, err := s.repository.CreateEmergencyContactVerification(ctx, contact)
+	if err != nil {
+		return err
+	}
+
+	name := redactedName(user.FirstName, user.LastName)
+	link := s.link("/verify-emergency-contact", token)
+
+	if contact.PhoneNumber != nil {
+		s.sendSMS(sms.Message{
+			To: *contact.PhoneNumber,
+			Body: fmt.Sprintf(
+				"ResQLink: %s added you as an emergency contact. To be told if they're in danger, open: %s",
+				name,
+				link,
+			),
+		})
+	}
+
+	if contact.Email != nil {
+		s.sendMail(mail.Message{
+			To:      *contact.Email,
+			Subject: fmt.Sprintf("%s added you as an emergency contact", name),
+			Body: fmt.Sprintf(
+				"%s added you as an emergency contact on ResQLink, so you can be "+
+					"told if they report being in danger during a disaster.\n\n"+
+					"Open the link below within a week to agree:\n%s\n\n"+
+					"If you don't know them, you can ignore this email.",
+				name,
+				link,
+			),
+		})
+	}
+
+	return nil
+}
+
+type verifyEmergencyContactRequest struct {
+	Token string `json:"token"`
+}
+
+// VerifyEmergencyContact is opened by the contact from the link they were sent,
+// so it doesn't need a session.
+func (s *Server) VerifyEmergencyContact(w http.ResponseWriter, r *http.Request) api.Response {
+	ctx := r.Context()
+
+	var data verifyEmergencyContactRequest
+
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&data); err != nil {
+		return api.Response{
+			Error:   fmt.Errorf("verify emergency contact: %w", err),
+			Code:    http.StatusBadRequest,
+			Message: "Invalid verify emergency contact request.",
+		}
+	}
+
+	if err := s.repository.VerifyEmergencyContact(ctx, data.Token); err != nil {
+		if errors.Is(err, errInvalidToken) {
+			return api.Response{
+				Error:   fmt.Errorf("verify emergency contact: %w", err),
+				Code:    http.StatusNotFound,
+				Message: "Invalid or expired link.",
+			}
+		}
+
+		return api.Response{
+			Error:   fmt.Errorf("verify emergency contact: %w", err),
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to verify emergency contact.",
+		}
+	}
+
+	return api.Response{
+		Code:    http.StatusOK,
+		Message: "Successfully verified emergency contact.",
+	}
+}
+
+// What contacts are told for each citizen status
+var emergencyStatusLabels = map[string]string{
+	"in_danger": "reported being in danger",
+	"at_risk":   "reported being at risk",
+	"safe":      "marked themselves safe",
+}
+
+// NotifyEmergencyContacts tells the user's contacts that they reported `status`,
+// with a link to follow their status. It's called by the disaster server, see
+// `disaster.EmergencyNotifier`.
+func (s *Server) NotifyEmergencyContacts(ctx context.Context, userID, status string) error {
+	label, ok := emergencyStatusLabels[status]
+	if !ok {
+		return fmt.Errorf("notify emergency contacts: unknown status %q", status)
+	}
+
+	contacts, err := s.repository.ListEmergencyContacts(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	contacts = slices.DeleteFunc(contacts, func(contact emergencyContact) bool {
+		return contact.VerifiedAt == nil
+	})
+
+	if len(contacts) == 0 {
+		return nil
+	}
+
+	isNew, err := s.repository.markEmergencyNotified(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if !isNew {
+		return nil
+	}
+
+	user, err := s.repository.Get(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	token, err := s.repository.createEmergencyStatusToken(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	name := redactedName(user.FirstName, user.LastName)
+	link := s.link("/emergency-status", token)
+	reportedAt := time.Now().Format("Jan 2, 3:04 PM MST")
+
+	for _, contact := range contacts {
+		if contact.PhoneNumber != nil {
+			s.sendSMS(sms.Message{
+				To: *contact.PhoneNumber,
+				Body: fmt.Sprintf(
+					"ResQLink: %s %s on %s. Follow their status: %s",
+					name,
+					label,
+					reportedAt,
+					link,
+				),
+			})
+		}
+
+		if contact.Email != nil {
+			s.sendMail(mail.Message{
+				To:      *contact.Email,
+				Subject: fmt.Sprintf("%s %s", name, label),
+				Body: fmt.Sprintf(
+					"%s %s on %s. You're receiving this because they listed you "+
+						"as an emergency contact on ResQLink.\n\n"+
+						"Open the link below to follow their status:\n%s",
+					name,
+					label,
+					reportedAt,
+					link,
+				),
+			})
+		}
+	}
+
+	return nil
+}
+
+func (s *Server) GetMedicalProfile(w http.ResponseWriter, r *http.Request) api.Response {
+	ctx := r.Context()
+
+	caller, ok := SessionFromContext(ctx)
+	if !ok {
+		return api.Response{
+			Error:   fmt.Errorf("get medical profile: %w", errNoSession),
+			Code:    http.StatusUnauthorized,
+			Message: "Unauthorized.",
+		}
+	}
+
+	profile, err := s.repository.GetMedicalProfile(ctx, caller.User.UserID)
+	if err != nil {
+		if errors.Is(err, errMedicalProfileNotFound) {
+			return api.Response{
+				Error:   fmt.Errorf("get medical profile: %w", err),
+				Code:    http.StatusNotFound,
+				Message: "No medical profile yet.",
+			}
+		}
+
+		return api.Response{
+			Error:   fmt.Errorf("get medical profile: %w", err),
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to get medical profile.",
+		}
+	}
+
+	return api.Response{
+		Code:    http.StatusOK,
+		Message: "Successfully fetched medical profile.",
+		Data:    profile,
+	}
+}
+
+func (s *Server) SaveMedicalProfile(w http.ResponseWriter, r *http.Request) api.Response {
+	ctx := r.Context()
+
+	caller, ok := SessionFromContext(ctx)
+	if !ok {
+		return api.Response{
+			Error:   fmt.Errorf("save medical profile: %w", errNoSession),
+			Code:    http.StatusUnauthorized,
+			Message: "Unauthorized.",
+		}
+	}
+
+	var data medicalProfile
+
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&data); err != nil {
+		return api.Response{
+			Error:   fmt.Errorf("save medical profile: %w", err),
+			Code:    http.StatusBadRequest,
+			Message: "Invalid save medical profile request.",
+		}
+	}
+
+	profile, err := s.repository.SaveMedicalProfile(ctx, caller.User.UserID, data)
+	if err != nil {
+		return api.Response{
+			Error:   fmt.Errorf("save medical profile: %w", err),
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to save medical profile.",
+		}
+	}
+
+	return api.Response{
+		Code:    http.StatusOK,
+		Message: "Successfully saved medical profile.",
+		Data:    profile,
+	}
+}
+
+func (s *Server) DeleteMedicalProfile(w http.ResponseWriter, r *http.Request) api.Response {
+	ctx := r.Context()
+
+	caller, ok := SessionFromContext(ctx)
+	if !ok {
+		return api.Response{
+			Error:   fmt.Errorf("delete medical profile: %w", errNoSession),
+			Code:    http.StatusUnauthorized,
+			Message: "Unauthorized.",
+		}
+	}
+
+	if err := s.repository.DeleteMedicalProfile(ctx, caller.User.UserID); err != nil {
+		if errors.Is(err, errMedicalProfileNotFound) {
+			return api.Response{
+				Error:   fmt.Errorf("delete medical profile: %w", err),
+				Code:    http.StatusNotFound,
+				Message: "No medical profile yet.",
+			}
+		}
+
+		return api.Response{
+			Error:   fmt.Errorf("delete medical profile: %w", err),
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to delete medical profile.",
+		}
+	}
+
+	return api.Response{
+		Code:    http.StatusOK,
+		Message: "Successfully deleted medical profile.",
+	}
+}
+
+func (s *Server) ListMedicalProfileAccesses(w http.ResponseWriter, r *http.Request) api.Response {
+	ctx := r.Context()
+
+	caller, ok := SessionFromContext(ctx)
+	if !ok {
+		return api.Response{
+			Error:   fmt.Errorf("list medical profile accesses: %w", errNoSession),
+			Code:    http.StatusUnauthorized,
+			Message: "Unauthorized.",
+		}
+	}
+
+	accesses, err := s.repository.ListMedicalProfileAccesses(ctx, caller.User.UserID)
+	if err != nil {
+		return api.Response{
+			Error:   fmt.Errorf("list medical profile accesses: %w", err),
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to get medical profile access log.",
+		}
+	}
+
+	return api.Response{
+		Code:    http.StatusOK,
+		Message: "Successfully fetched medical profile access log.",
+		Data:    accesses,
+	}
+}
+
+// GetAssignedMedicalProfile returns the medical profile of the reporter when
+// `responderUserID` is their assigned responder, or `nil` otherwise. It's called
+// by the disaster server, see `disaster.MedicalProfileStore`.
+func (s *Server) GetAssignedMedicalProfile(
+	ctx context.Context,
+	reporterID, responderUserID string,
+) (any, error) {
+	profile, err := s.repository.GetAssignedMedicalProfile(ctx, reporterID, responderUserID)
+	if errors.Is(err, errMedicalProfileNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return profile, nil
+}
+
+type forgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+// ForgotPassword always responds the same way whether or not the email exists,
+// so it can't be used to find out who has an account.
+func (s *Server) ForgotPassword(w http.ResponseWriter, r *http.Request) api.Response {
+	ctx := r.Context()
+
+	var data forgotPasswordRequest
+
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&data); err != nil {
+		return api.Response{
+			Error:   fmt.Errorf("forgot password: %w", err),
+			Code:    http.StatusBadRequest,
+			Message: "Invalid forgot password request.",
+		}
+	}
+
+	response := api.Response{
+		Code:    http.StatusOK,
+		Message: "If the email has an account, a password reset link was sent to it.",
+	}
+
+	token, err := s.repository.CreatePasswordReset(ctx, data.Email)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return response
+	}
+	if err != nil {
+		return api.Response{
+			Error:   fmt.Errorf("forgot password: %w", err),
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to request a password reset.",
+		}
+	}
+
+	s.sendMail(mail.Message{
+		To:      data.Email,
+		Subject: "Reset your ResQLink password",
+		Body: fmt.Sprintf(
+			"Someone asked to reset the password of your ResQLink account.\n\n"+
+				"Open the link below within an hour to choose a new password:\n%s\n\n"+
+				"If this wasn't you, you can ignore this email.",
+			s.link("/reset-password", token),
+		),
+	})
+
+	return response
+}
+
+func (s *Server) ResetPassword(w http.ResponseWriter, r *http.Request) api.Response {
+	ctx := r.Context()
+
+	var data resetPasswordRequest
+
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&data); err != nil {
+		return api.Response{
+			Error:   fmt.Errorf("reset password: %w", err),
+			Code:    http.StatusBadRequest,
+			Message: "Invalid reset password request.",
+		}
+	}
+
+	if data.Password == "" {
+		return api.Response{
+			Error:   fmt.Errorf("reset password: empty password"),
+			Code:    http.StatusBadRequest,
+			Message: "Password is required.",
+		}
+	}
+
+	if err := s.repository.ResetPassword(ctx, data); err != nil {
+		if errors.Is(err, errInvalidToken) {
+			return api.Response{
+				Error:   fmt.Errorf("reset password: %w", err),
+				Code:    http.StatusBadRequest,
+				Message: "Invalid or expired password reset link.",
+			}
+		}
+
+		return api.Response{
+			Error:   fmt.Errorf("reset password: %w", err),
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to reset password.",
+		}
+	}
+
+	return api.Response{
+		Code:    http.StatusOK,
+		Message: "Successfully reset password.",
+	}
+}
+
+type verifyEmailRequest struct {
+	Token string `json:"token"`
+}
+
+func (s *Server) VerifyEmail(w http.ResponseWriter, r *http.Request) api.Response {
+	ctx := r.Context()
+
+	var data verifyEmailRequest
+
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&data); err != nil {
+		return api.Response{
+			Error:   fmt.Errorf("verify email: %w", err),
+			Code:    http.StatusBadRequest,
+			Message: "Invalid verify email request.",
+		}
+	}
+
+	if err := s.repository.VerifyEmail(ctx, data.Token); err != nil {
+		if errors.Is(err, errInvalidToken) {
+			return api.Response{
+				Error:   fmt.Errorf("verify email: %w", err),
+				Code:    http.StatusBadRequest,
+				Message: "Invalid or expired verification link.",
+			}
+		}
+
+		return api.Response{
+			Error:   fmt.Errorf("verify email: %w", err),
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to verify email.",
+		}
+	}
+
+	return api.Response{
+		Code:    http.StatusOK,
+		Message: "Successfully verified email.",
+	}
+}
+
+func (s *Server) ResendEmailVerification(w http.ResponseWriter, r *http.Request) api.Response {
+	ctx := r.Context()
+
+	caller, ok := SessionFromContext(ctx)
+	if !ok {
+		return api.Response{
+			Error:   fmt.Errorf("resend email verification: %w", errNoSession),
+			Code:    http.StatusUnauthorized,
+			Message: "Unauthorized.",
+		}
+	}
+
+	if caller.User.Email == nil {
+		return api.Response{
+			Error:   fmt.Errorf("resend email verification: no email"),
+			Code:    http.StatusBadRequest,
+			Message: "Account has no email.",
+		}
+	}
+
+	if caller.User.EmailVerifiedAt != nil {
+		return api.Response{
+			Code:    http.StatusOK,
+			Message: "Email is already verified.",
+		}
+	}
+
+	if err := s.sendEmailVerification(ctx, caller.User.UserID, *caller.User.Email); err != nil {
+		return api.Response{
+			Error:   fmt.Errorf("resend email verification: %w", err),
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to send email verification.",
+		}
+	}
+
+	return api.Response{
+		Code:    http.StatusOK,
+		Message: "Successfully sent email verification.",
+	}
+}
+
+func (s *Server) sendEmailVerification(ctx context.Context, userID, email string) error {
+	token, err := s.repository.CreateEmailVerification(ctx, userID, email)
+	if err != nil {
+		return err
+	}
+
+	s.sendMail(mail.Message{
+		To:      email,
+		Subject: "Verify your ResQLink email",
+		Body: fmt.Sprintf(
+			"Open the link below within a day to verify your email:\n%s",
+			s.link("/verify-email", token),
+		),
+	})
+
+	return nil
+}
+
+// Mail is sent in the background so slow mail servers don't hold up requests,
+// and so response times don't reveal whether an email has an account.
+func (s *Server) sendMail(msg mail.Message) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		if err := s.mailer.Send(ctx, msg); err != nil {
+			slog.Error(fmt.Errorf("send mail: %w", err).Error())
+		}
+	}()
+}
+
+// Like mail, SMS is sent in the background so a slow gateway doesn't hold up
+// requests.
+func (s *Server) sendSMS(msg sms.Message) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		if err := s.smsSender.Send(ctx, msg); err != nil {
+			slog.Error(fmt.Errorf("send sms: %w", err).Error())
+		}
+	}()
+}
+
+func (s *Server) link(path, token string) string {
+	base := strings.TrimSuffix(s.appURL, "/")
+	return fmt.Sprintf("%s%s?token=%s", base, path, url.QueryEscape(token))
+}
+
+var errNotAnonymous = errors.New("session is not anonymous")
+
+// ClaimAnonymous links what the caller reported while signed in anonymously to
+// their account. The anonymous session token is required as proof, since the
+// anonymous ID alone is handed out in responses and WebSocket payloads.
+func (s *Server) ClaimAnonymous(w http.ResponseWriter, r *http.Request) api.Response {
+	ctx := r.Context()
+
+	caller, ok := SessionFromContext(ctx)
+	if !ok {
+		return api.Response{
+			Error:   fmt.Errorf("claim anonymous: %w", errNoSession),
+			Code:    http.StatusUnauthorized,
+			Message: "Unauthorized.",
+		}
+	}
+
+	var data claimAnonymousRequest
+
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&data); err != nil {
+		return api.Response{
+			Error:   fmt.Errorf("claim anonymous: %w", err),
+			Code:    http.StatusBadRequest,
+			Message: "Invalid claim anonymous request.",
+		}
+	}
+
+	anon, err := s.repository.validateSessionToken(ctx, data.AnonymousToken)
+	if err == nil && !anon.IsAnonymous {
+		err = errNotAnonymous
+	}
+	if err != nil {
+		return api.Response{
+			Error:   fmt.Errorf("claim anonymous: %w", err),
+			Code:    http.StatusBadRequest,
+			Message: "Invalid anonymous session.",
+		}
+	}
+
+	response, err := s.repository.ClaimAnonymous(ctx, caller.User.UserID, anon.User.UserID)
+	if err != nil {
+		return api.Response{
+			Error:   fmt.Errorf("claim anonymous: %w", err),
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to claim anonymous reports.",
+		}
+	}
+
+	return api.Response{
+		Code:    http.StatusOK,
+		Message: "Successfully claimed anonymous reports.",
+		Data:    response,
+	}
+}
+
+func (s *Server) Unlock(w http.ResponseWriter, r *http.Request) api.Response {
+	ctx := r.Context()
+
+	caller, ok := SessionFromContext(ctx)
+	if !ok {
+		return api.Response{
+			Error:   fmt.Errorf("unlock: %w", errNoSession),
+			Code:    http.StatusUnauthorized,
+			Message: "Unauthorized.",
+		}
+	}
+
+	if err := s.repository.Unlock(ctx, r.PathValue("userId"), caller.User.UserID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return api.Response{
+				Error:   fmt.Errorf("unlock: %w", err),
+				Code:    http.StatusNotFound,
+				Message: "User not found.",
+			}
+		}
+
+		return api.Response{
+			Error:   fmt.Errorf("unlock: %w", err),
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to unlock user.",
+		}
+	}
+
+	return api.Response{
+		Code:    http.StatusOK,
+		Message: "Successfully unlocked user.",
+	}
+}
+
+func (s *Server) StartTOTPEnrollment(w http.ResponseWriter, r *http.Request) api.Response {
+	ctx := r.Context()
+
+	caller, ok := SessionFromContext(ctx)
+	if !ok {
+		return api.Response{
+			Error:   fmt.Errorf("start totp enrollment: %w", errNoSession),
+			Code:    http.StatusUnauthorized,
+			Message: "Unauthorized.",
+		}
+	}
+
+	response, err := s.repository.StartTOTPEnrollment(ctx, caller.User)
+	if err != nil {
+		if errors.Is(err, errTOTPAlreadyEnabled) {
+			return api.Response{
+				Error:   fmt.Errorf("start totp enrollment: %w", err),
+				Code:    http.StatusConflict,
+				Message: "Two-factor authentication is already enabled.",
+			}
+		}
+
+		return api.Response{
+			Error:   fmt.Errorf("start totp enrollment: %w", err),
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to start two-factor authentication setup.",
+		}
+	}
+
+	return api.Response{
+		Code:    http.StatusOK,
+		Message: "Scan the QR code with an authenticator app, then confirm with a code.",
+		Data:    response,
+	}
+}
+
+func (s *Server) ConfirmTOTPEnrollment(w http.ResponseWriter, r *http.Request) api.Response {
+	ctx := r.Context()
+
+	caller, ok := SessionFromContext(ctx)
+	if !ok {
+		return api.Response{
+			Error:   fmt.Errorf("confirm totp enrollment: %w", errNoSession),
+			Code:    http.StatusUnauthorized,
+			Message: "Unauthorized.",
+		}
+	}
+
+	var data totpCodeRequest
+
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&data); err != nil {
+		return api.Response{
+			Error:   fmt.Errorf("confirm totp enrollment: %w", err),
+			Code:    http.StatusBadRequest,
+			Message: "Invalid confirm two-factor authentication request.",
+		}
+	}
+
+	response, err := s.repository.ConfirmTOTPEnrollment(ctx, caller.Session.UserID, data.Code)
+	if err != nil {
+		if errors.Is(err, errInvalidToken) {
+			return api.Response{
+				Error:   fmt.Errorf("confirm totp enrollment: %w", err),
+				Code:    http.StatusBadRequest,
+				Message: "Two-factor authentication setup expired. Start again.",
+			}
+		}
+
+		if errors.Is(err, errInvalidTOTPCode) {
+			return api.Response{
+				Error:   fmt.Errorf("confirm totp enrollment: %w", err),
+				Code:    http.StatusBadRequest,
+				Message: "Invalid code.",
+			}
+		}
+
+		return api.Response{
+			Error:   fmt.Errorf("confirm totp enrollment: %w", err),
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to enable two-factor authentication.",
+		}
+	}
+
+	return api.Response{
+		Code:    http.StatusOK,
+		Message: "Successfully enabled two-factor authentication.",
+		Data:    response,
+	}
+}
+
+func (s *Server) DisableTOTP(w http.ResponseWriter, r *http.Request) api.Response {
+	ctx := r.Context()
+
+	caller, ok := SessionFromContext(ctx)
+	if !ok {
+		return api.Response{
+			Error:   fmt.Errorf("disable totp: %w", errNoSession),
+			Code:    http.StatusUnauthorized,
+			Message: "Unauthorized.",
+		}
+	}
+
+	var data totpCodeRequest
+
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&data); err != nil {
+		return api.Response{
+			Error:   fmt.Errorf("disable totp: %w", err),
+			Code:    http.StatusBadRequest,
+			Message: "Invalid disable two-factor authentication request.",
+		}
+	}
+
+	if err := s.repository.DisableTOTP(ctx, caller.User.UserID, data.Code); err != nil {
+		if errors.Is(err, errTOTPNotEnabled) {
+			return api.Response{
+				Error:   fmt.Errorf("disable totp: %w", err),
+				Code:    http.StatusBadRequest,
+				Message: "Two-factor authentication is not enabled.",
+			}
+		}
+
+		if errors.Is(err, errTOTPRequired) {
+			return api.Response{
+				Error:   fmt.Errorf("disable totp: %w", err),
+				Code:    http.StatusForbidden,
+				Message: "Two-factor authentication is required for your role.",
+			}
+		}
+
+		if errors.Is(err, errInvalidTOTPCode) {
+			return api.Response{
+				Error:   fmt.Errorf("disable totp: %w", err),
+				Code:    http.StatusBadRequest,
+				Message: "Invalid code.",
+			}
+		}
+
+		return api.Response{
+			Error:   fmt.Errorf("disable totp: %w", err),
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to disable two-factor authentication.",
+		}
+	}
+
+	return api.Response{
+		Code:    http.StatusOK,
+		Message: "Successfully disabled two-factor authentication.",
+	}
+}
+
+func (s *Server) ListTOTPRequiredRoles(w http.ResponseWriter, r *http.Request) api.Response {
+	ctx := r.Context()
+
+	roles, err := s.repository.ListTOTPRequiredRoles(ctx)
+	if err != nil {
+		return api.Response{
+			Error:   fmt.Errorf("list totp required roles: %w", err),
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to get roles requiring two-factor authentication.",
+		}
+	}
+
+	return api.Response{
+		Code:    http.StatusOK,
+		Message: "Successfully fetched roles requiring two-factor authentication.",
+		Data:    totpRequiredRolesRequest{Roles: roles},
+	}
+}
+
+func (s *Server) SetTOTPRequiredRoles(w http.ResponseWriter, r *http.Request) api.Response {
+	ctx := r.Context()
+
+	var data totpRequiredRolesRequest
+
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&data); err != nil {
+		return api.Response{
+			Error:   fmt.Errorf("set totp required roles: %w", err),
+			Code:    http.StatusBadRequest,
+			Message: "Invalid set roles requiring two-factor authentication request.",
+		}
+	}
+
+	for _, role := range data.Roles {
+		switch role {
+		case Citizen, Responder, Dispatcher, Admin:
+		default:
+			return api.Response{
+				Error:   fmt.Errorf("set totp required roles: invalid role %q", role),
+				Code:    http.StatusBadRequest,
+				Message: "Invalid role.",
+			}
+		}
+	}
+
+	if err := s.repository.SetTOTPRequiredRoles(ctx, data.Roles); err != nil {
+		return api.Response{
+			Error:   fmt.Errorf("set totp required roles: %w", err),
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to set roles requiring two-factor authentication.",
+		}
+	}
+
+	return api.Response{
+		Code:    http.StatusOK,
+		Message: "Successfully set roles requiring two-factor authentication.",
+	}
+}
+
+func (s *Server) ListAPIKeys(w http.ResponseWriter, r *http.Request) api.Response {
+	ctx := r.Context()
+
+	keys, err := s.repository.ListAPIKeys(ctx)
+	if err != nil {
+		return api.Response{
+			Error:   fmt.Errorf("list api keys: %w", err),
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to get API keys.",
+		}
+	}
+
+	return api.Response{
+		Code:    http.StatusOK,
+		Message: "Successfully fetched API keys.",
+		Data:    keys,
+	}
+}
+
+func (s *Server) CreateAPIKey(w http.ResponseWriter, r *http.Request) api.Response {
+	ctx := r.Context()
+
+	caller, ok := SessionFromContext(ctx)
+	if !ok {
+		return api.Response{
+			Error:   fmt.Errorf("create api key: %w", errNoSession),
+			Code:    http.StatusUnauthorized,
+			Message: "Unauthorized.",
+		}
+	}
+
+	var data createAPIKeyRequest
+
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&data); err != nil {
+		return api.Response{
+			Error:   fmt.Errorf("create api key: %w", err),
+			Code:    http.StatusBadRequest,
+			Message: "Invalid create API key request.",
+		}
+	}
+
+	if data.Name == "" || (data.RateLimit != nil && *data.RateLimit <= 0) {
+		return api.Response{
+			Error:   fmt.Errorf("create api key: missing name or invalid rate limit"),
+			Code:    http.StatusBadRequest,
+			Message: "A name and a positive rate limit are required.",
+		}
+	}
+
+	key, err := s.repository.CreateAPIKey(ctx, data, caller.User.UserID)
+	if err != nil {
+		if errors.Is(err, errInvalidScope) {
+			return api.Response{
+				Error:   fmt.Errorf("create api key: %w", err),
+				Code:    http.StatusBadRequest,
+				Message: "Invalid scope.",
+			}
+		}
+
+		return api.Response{
+			Error:   fmt.Errorf("create api key: %w", err),
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to create API key.",
+		}
+	}
+
+	return api.Response{
+		Code:    http.StatusCreated,
+		Message: "Successfully created API key. Store it now, it won't be shown again.",
+		Data:    key,
+	}
+}
+
+func (s *Server) RotateAPIKey(w http.ResponseWriter, r *http.Request) api.Response {
+	ctx := r.Context()
+
+	key, err := s.repository.RotateAPIKey(ctx, r.PathValue("apiKeyId"))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return api.Response{
+				Error:   fmt.Errorf("rotate api key: %w", err),
+				Code:    http.StatusNotFound,
+				Message: "API key not found.",
+			}
+		}
+
+		return api.Response{
+			Error:   fmt.Errorf("rotate api key: %w", err),
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to rotate API key.",
+		}
+	}
+
+	return api.Response{
+		Code:    http.StatusOK,
+		Message: "Successfully rotated API key. Store it now, it won't be shown again.",
+		Data:    key,
+	}
+}
+
+func (s *Server) RevokeAPIKey(w http.ResponseWriter, r *http.Request) api.Response {
+	ctx := r.Context()
+
+	if err := s.repository.RevokeAPIKey(ctx, r.PathValue("apiKeyId")); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return api.Response{
+				Error:   fmt.Errorf("revoke api key: %w", err),
+				Code:    http.StatusNotFound,
+				Message: "API key not found.",
+			}
+		}
+
+		return api.Response{
+			Error:   fmt.Errorf("revoke api key: %w", err),
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to revoke API key.",
+		}
+	}
+
+	return api.Response{
+		Code:    http.StatusOK,
+		Message: "Successfully revoked API key.",
+	}
+}
+
+type sessionResponse struct {
+	session
+
+	IsCurrent bool `json:"isCurrent"`
+}
+
+// The same handlers serve `/api/sessions` for the caller and
+// `/api/users/{userId}/sessions` for admins, which policies restrict.
+func sessionsOwner(r *http.Request, caller SessionValidationResponse) string {
+	if userID := r.PathValue("userId"); userID != "" {
+		return userID
+	}
+
+	return caller.Session.UserID
+}
+
+func (s *Server) ListSessions(w http.ResponseWriter, r *http.Request) api.Response {
+	ctx := r.Context()
+
+	caller, ok := SessionFromContext(ctx)
+	if !ok {
+		return api.Response{
+			Error:   fmt.Errorf("list sessions: %w", errNoSession),
+			Code:    http.StatusUnauthorized,
+			Message: "Unauthorized.",
+		}
+	}
+
+	sessions, err := s.repository.ListSessions(ctx, sessionsOwner(r, caller))
+	if err != nil {
+		return api.Response{
+			Error:   fmt.Errorf("list sessions: %w", err),
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to get sessions.",
+		}
+	}
+
+	response := make([]sessionResponse, len(sessions))
+	for i, ses := range sessions {
+		response[i] = sessionResponse{
+			session:   ses,
+			IsCurrent: ses.SessionID == caller.Session.SessionID,
+		}
+	}
+
+	return api.Response{
+		Code:    http.StatusOK,
+		Message: "Successfully fetched sessions.",
+		Data:    response,
+	}
+}
+
+func (s *Server) GetUserSession(w http.ResponseWriter, r *http.Request) api.Response {
+	ctx := r.Context()
+
+	caller, ok := SessionFromContext(ctx)
+	if !ok {
+		return api.Response{
+			Error:   fmt.Errorf("get user session: %w", errNoSession),
+			Code:    http.StatusUnauthorized,
+			Message: "Unauthorized.",
+		}
+	}
+
+	ses, err := s.repository.GetUserSession(
+		ctx,
+		sessionsOwner(r, caller),
+		r.PathValue("sessionId"),
+	)
+	if err != nil {
+		if errors.Is(err, errSessionNotFound) {
+			return api.Response{
+				Error:   fmt.Errorf("get user session: %w", err),
+				Code:    http.StatusNotFound,
+				Message: "Session not found.",
+			}
+		}
+
+		return api.Response{
+			Error:   fmt.Errorf("get user session: %w", err),
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to get session.",
+		}
+	}
+
+	return api.Response{
+		Code:    http.StatusOK,
+		Message: "Successfully fetched session.",
+		Data: sessionResponse{
+			session:   ses,
+			IsCurrent: ses.SessionID == caller.Session.SessionID,
+		},
+	}
+}
+
+func (s *Server) RevokeSession(w http.ResponseWriter, r *http.Request) api.Response {
+	ctx := r.Context()
+
+	caller, ok := SessionFromContext(ctx)
+	if !ok {
+		return api.Response{
+			Error:   fmt.Errorf("revoke session: %w", errNoSession),
+			Code:    http.StatusUnauthorized,
+			Message: "Unauthorized.",
+		}
+	}
+
+	if err := s.repository.RevokeSession(
+		ctx,
+		sessionsOwner(r, caller),
+		r.PathValue("sessionId"),
+	); err != nil {
+		if errors.Is(err, errSessionNotFound) {
+			return api.Response{
+				Error:   fmt.Errorf("revoke session: %w", err),
+				Code:    http.StatusNotFound,
+				Message: "Session not found.",
+			}
+		}
+
+		return api.Response{
+			Error:   fmt.Errorf("revoke session: %w", err),
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to revoke session.",
+		}
+	}
+
+	return api.Response{
+		Code:    http.StatusOK,
+		Message: "Successfully revoked session.",
+	}
+}
+
+// RevokeAllSessions signs the user out everywhere, including the current session
+// when users revoke their own.
+func (s *Server) RevokeAllSessions(w http.ResponseWriter, r *http.Request) api.Response {
+	ctx := r.Context()
+
+	caller, ok := SessionFromContext(ctx)
+	if !ok {
+		return api.Response{
+			Error:   fmt.Errorf("revoke all sessions: %w", errNoSession),
+			Code:    http.StatusUnauthorized,
+			Message: "Unauthorized.",
+		}
+	}
+
+	if err := s.repository.RevokeAllSessions(ctx, sessionsOwner(r, caller)); err != nil {
+		return api.Response{
+			Error:   fmt.Errorf("revoke all sessions: %w", err),
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to revoke sessions.",
+		}
+	}
+
+	return api.Response{
+		Code:    http.StatusOK,
+		Message: "Successfully revoked all sessions.",
+	}
+}
+
+type sessionContextKey struct{}
+
+var errNoSession = errors.New("no session in request context")
+
+// SessionFromContext returns the caller that `AuthMiddleware` attached to the request.
+func SessionFromContext(ctx context.Context) (SessionValidationResponse, bool) {
+	caller, ok := ctx.Value(sessionContextKey{}).(SessionValidationResponse)
+	return caller, ok
+}
+
+// WithSession attaches `caller` to `ctx` the way `AuthMiddleware` does.
+func WithSession(ctx context.Context, caller SessionValidationResponse) context.Context {
+	return context.WithValue(ctx, sessionContextKey{}, caller)
+}
+
+// Mobile clients send `Authorization: Bearer <token>`, while the web dashboard
+// relies on the `session` cookie.
+func sessionToken(r *http.Request) (string, bool) {
+	if header := r.Header.Get("Authorization"); header != "" {
+		scheme, token, ok := strings.Cut(header, " ")
+		if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+			return "", false
+		}
+
+		return strings.TrimSpace(token), true
+	}
+
+	cookie, err := r.Cookie("session")
+	if err != nil || cookie.Value == "" {
+		return "", false
+	}
+
+	return cookie.Value, true
+}
+
+func (s *Server) AuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		token, ok := sessionToken(r)
+		if !ok {
+			unauthorized(w, errors.New("auth: missing session token"))
+			return
+		}
+
+		validate := s.repository.validateSessionToken
+		if strings.HasPrefix(token, apiKeyPrefix) {
+			validate = s.repository.validateAPIKey
+		}
+
+		caller, err := validate(ctx, token)
+		if err != nil {
+			var rateLimited *rateLimitedError
+			if errors.As(err, &rateLimited) {
+				tooManyRequests(w, rateLimited.retryAfter, fmt.Errorf("auth: %w", err))
+				return
+			}
+
+			unauthorized(w, fmt.Errorf("auth: %w", err))
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(WithSession(ctx, caller)))
+	})
+}
+
+func tooManyRequests(w http.ResponseWriter, retryAfter time.Duration, err error) {
+	slog.Error(err.Error())
+
+	setRetryAfter(w, retryAfter)
+
+	res := api.Response{
+		Code:    http.StatusTooManyRequests,
+		Message: "Too many requests. Try again later.",
+	}
+
+	if err := res.Encode(w); err != nil {
+		slog.Error(err.Error())
+	}
+}
+
+func setRetryAfter(w http.ResponseWriter, retryAfter time.Duration) {
+	seconds := int(retryAfter.Round(time.Second).Seconds())
+	w.Header().Set("Retry-After", strconv.Itoa(max(seconds, 1)))
+}
+
+func unauthorized(w http.ResponseWriter, err error) {
+	slog.Error(err.Error())
+
+	res := api.Response{
+		Code:    http.StatusUnauthorized,
+		Message: "Unauthorized.",
+	}
+
+	if err := res.Encode(w); err != nil {
+		slog.Error(err.Error())
+	}
 }
@@ -0,0 +1,503 @@
+package user
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/redis/go-redis/v9"
+)
+
+// RFC 6238 with the defaults every authenticator app supports
+const (
+	totpIssuer = "ResQLink"
+	totpDigits = 6
+	totpPeriod = 30 // Seconds
+	totpSkew   = 1  // Steps accepted before and after the current one, for clock drift
+
+	totpEnrollmentFmt = "totp_enrollment:%s"
+	totpLastStepFmt   = "totp_last_step:%s"
+	totpChallengeFmt  = "totp_challenge:%s"
+
+	totpEnrollmentTTL  = 10 * time.Minute
+	totpChallengeTTL   = 5 * time.Minute
+	maxTOTPAttempts    = 5
+	recoveryCodesCount = 10
+)
+
+var (
+	errTOTPAlreadyEnabled = errors.New("totp already enabled")
+	errTOTPNotEnabled     = errors.New("totp not enabled")
+	errTOTPRequired       = errors.New("totp required for role")
+	errInvalidTOTPCode    = errors.New("invalid totp code")
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+func generateTOTPSecret() (string, error) {
+	bytes := make([]byte, 20)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+
+	return totpEncoding.EncodeToString(bytes), nil
+}
+
+func totpCode(secret string, step int64) (string, error) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", err
+	}
+
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, uint64(step))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg)
+	sum := mac.Sum(nil)
+
+	// Dynamic truncation (RFC 4226 section 5.3)
+	offset := sum[len(sum)-1] & 0x0f
+	code := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	return fmt.Sprintf("%0*d", totpDigits, code%uint32(math.Pow10(totpDigits))), nil
+}
+
+// verifyTOTP returns the step `code` matched so it can't be used again.
+func verifyTOTP(secret, code string, now time.Time) (int64, bool) {
+	current := now.Unix() / totpPeriod
+
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		expected, err := totpCode(secret, step)
+		if err != nil {
+			return 0, false
+		}
+
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+
+	return 0, false
+}
+
+// Provisioning URI that authenticator apps read from a QR code
+func totpURI(secret, account string) string {
+	label := url.PathEscape(totpIssuer + ":" + account)
+
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", totpIssuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprint(totpDigits))
+	query.Set("period", fmt.Sprint(totpPeriod))
+
+	return fmt.Sprintf("otpauth://totp/%s?%s", label, query.Encode())
+}
+
+func (r *repository) getTOTPStatus(
+	ctx context.Context,
+	userID string,
+) (isEnabled, isRequired bool, err error) {
+	query := `
+    SELECT 
+        users.totp_enabled_at IS NOT NULL,
+        EXISTS (SELECT 1 FROM totp_required_roles WHERE role = users.role)
+    FROM users
+    WHERE user_id = ($1)
+    `
+
+	row := r.querier.QueryRow(ctx, query, userID)
+	if err := row.Scan(&isEnabled, &isRequired); err != nil {
+		return false, false, err
+	}
+
+	return isEnabled, isRequired, nil
+}
+
+type totpEnrollmentResponse struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+// StartTOTPEnrollment keeps the new secret aside until the user proves their
+// authenticator has it through `ConfirmTOTPEnrollment`.
+func (r *repository) StartTOTPEnrollment(
+	ctx context.Context,
+	user userResponse,
+) (totpEnrollmentResponse, error) {
+	isEnabled, _, err := r.getTOTPStatus(ctx, user.UserID)
+	if err != nil {
+		return totpEnrollmentResponse{}, err
+	}
+
+	if isEnabled {
+		return totpEnrollmentResponse{}, errTOTPAlreadyEnabled
+	}
+
+	secret, err := generateTOTPSecret()
+	if err != nil {
+		return totpEnrollmentResponse{}, err
+	}
+
+	key := fmt.Sprintf(totpEnrollmentFmt, user.UserID)
+	if err := r.redisClient.Set(ctx, key, secret, totpEnrollmentTTL).Err(); err != nil {
+		return totpEnrollmentResponse{}, err
+	}
+
+	return totpEnrollmentResponse{
+		Secret: secret,
+		URI:    totpURI(secret, user.account()),
+	}, nil
+}
+
+type totpCodeRequest struct {
+	Code string `json:"code"`
+}
+
+type recoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+// ConfirmTOTPEnrollment enables TOTP and returns the recovery codes, which are
+// only ever shown this once.
+func (r *repository) ConfirmTOTPEnrollment(
+	ctx context.Context,
+	userID, code string,
+) (recoveryCodesResponse, error) {
+	key := fmt.Sprintf(totpEnrollmentFmt, userID)
+
+	secret, err := r.redisClient.Get(ctx, key).Result()
+	if errors.Is(err, redis.Nil) {
+		return recoveryCodesResponse{}, errInvalidToken
+	}
+	if err != nil {
+		return recoveryCodesResponse{}, err
+	}
+
+	step, ok := verifyTOTP(secret, code, time.Now())
+	if !ok {
+		return recoveryCodesResponse{}, errInvalidTOTPCode
+	}
+
+	codes := make([]string, recoveryCodesCount)
+	for i := range codes {
+		token, err := generateToken()
+		if err != nil {
+			return recoveryCodesResponse{}, err
+		}
+
+		codes[i] = strings.ToLower(token[:5] + "-" + token[5:10])
+	}
+
+	encryptedSecret, err := seal(r.totpCipher, userID, []byte(secret))
+	if err != nil {
+		return recoveryCodesResponse{}, err
+	}
+
+	tx, err := r.querier.Begin(ctx)
+	if err != nil {
+		return recoveryCodesResponse{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+    UPDATE users
+    SET 
+        totp_secret_encrypted = ($1), 
+        totp_enabled_at = NOW(), 
+        updated_at = NOW()
+    WHERE user_id = ($2)
+    `
+
+	if _, err := tx.Exec(ctx, query, encryptedSecret, userID); err != nil {
+		return recoveryCodesResponse{}, err
+	}
+
+	query = `DELETE FROM totp_recovery_codes WHERE user_id = ($1)`
+
+	if _, err := tx.Exec(ctx, query, userID); err != nil {
+		return recoveryCodesResponse{}, err
+	}
+
+	query = `INSERT INTO totp_recovery_codes (user_id, code_hash) VALUES ($1, $2)`
+
+	for _, code := range codes {
+		if _, err := tx.Exec(ctx, query, userID, hashToken(code)); err != nil {
+			return recoveryCodesResponse{}, err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return recoveryCodesResponse{}, err
+	}
+
+	if err := r.redisClient.Del(ctx, key).Err(); err != nil {
+		return recoveryCodesResponse{}, err
+	}
+
+	// The step may already be marked used when TOTP was just disabled and set
+	// up again, which is fine since the code was checked against the new secret
+	if _, err := r.useTOTPStep(ctx, userID, step); err != nil {
+		return recoveryCodesResponse{}, err
+	}
+
+	return recoveryCodesResponse{RecoveryCodes: codes}, nil
+}
+
+func (r *repository) DisableTOTP(ctx context.Context, userID, code string) error {
+	isEnabled, isRequired, err := r.getTOTPStatus(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if !isEnabled {
+		return errTOTPNotEnabled
+	}
+
+	if isRequired {
+		return errTOTPRequired
+	}
+
+	if err := r.verifyUserTOTP(ctx, userID, code, ""); err != nil {
+		return err
+	}
+
+	tx, err := r.querier.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+    UPDATE users
+    SET 
+        totp_secret_encrypted = NULL, 
+        totp_enabled_at = NULL, 
+        updated_at = NOW()
+    WHERE user_id = ($1)
+    `
+
+	if _, err := tx.Exec(ctx, query, userID); err != nil {
+		return err
+	}
+
+	query = `DELETE FROM totp_recovery_codes WHERE user_id = ($1)`
+
+	if _, err := tx.Exec(ctx, query, userID); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// Keeps `step` as the last one used unless a later or the same one already is.
+// Done in one script so two requests with the same code can't both get through.
+var useTOTPStepScript = redis.NewScript(`
+local last = redis.call("GET", KEYS[1])
+if last and tonumber(last) >= tonumber(ARGV[1]) then
+    return 0
+end
+
+redis.call("SET", KEYS[1], ARGV[1], "EX", ARGV[2])
+return 1
+`)
+
+// useTOTPStep marks `step` used and reports whether it wasn't already.
+func (r *repository) useTOTPStep(ctx context.Context, userID string, step int64) (bool, error) {
+	key := fmt.Sprintf(totpLastStepFmt, userID)
+	ttl := totpPeriod * (2*totpSkew + 1)
+
+	isUnused, err := useTOTPStepScript.Run(ctx, r.redisClient, []string{key}, step, ttl).Bool()
+	if err != nil {
+		return false, err
+	}
+
+	return isUnused, nil
+}
+
+// getTOTPSecret returns the user's decrypted secret.
+func (r *repository) getTOTPSecret(ctx context.Context, userID string) (string, error) {
+	query := `
+    SELECT totp_secret_encrypted 
+    FROM users 
+    WHERE user_id = ($1) AND totp_enabled_at IS NOT NULL
+    `
+
+	var encryptedSecret []byte
+
+	row := r.querier.QueryRow(ctx, query, userID)
+	if err := row.Scan(&encryptedSecret); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", errTOTPNotEnabled
+		}
+
+		return "", err
+	}
+
+	secret, err := unseal(r.totpCipher, userID, encryptedSecret)
+	if err != nil {
+		return "", err
+	}
+
+	return string(secret), nil
+}
+
+// verifyUserTOTP accepts either a code from the authenticator, which can only be
+// used once, or an unused recovery code.
+func (r *repository) verifyUserTOTP(ctx context.Context, userID, code, recoveryCode string) error {
+	if recoveryCode != "" {
+		query := `
+        UPDATE totp_recovery_codes SET used_at = NOW()
+        WHERE user_id = ($1) AND code_hash = ($2) AND used_at IS NULL
+        `
+
+		tag, err := r.querier.Exec(
+			ctx,
+			query,
+			userID,
+			hashToken(strings.ToLower(strings.TrimSpace(recoveryCode))),
+		)
+		if err != nil {
+			return err
+		}
+
+		if tag.RowsAffected() == 0 {
+			return errInvalidTOTPCode
+		}
+
+		return nil
+	}
+
+	secret, err := r.getTOTPSecret(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	step, ok := verifyTOTP(secret, strings.TrimSpace(code), time.Now())
+	if !ok {
+		return errInvalidTOTPCode
+	}
+
+	isUnused, err := r.useTOTPStep(ctx, userID, step)
+	if err != nil {
+		return err
+	}
+
+	if !isUnused {
+		return errInvalidTOTPCode
+	}
+
+	return nil
+}
+
+type totpChallenge struct {
+	UserID   string `json:"userId"`
+	Attempts int    `json:"attempts"`
+}
+
+func (r *repository) createTOTPChallenge(ctx context.Context, userID string) (string, error) {
+	return r.createSingleUseToken(
+		ctx,
+		totpChallengeFmt,
+		totpChallenge{UserID: userID},
+		totpChallengeTTL,
+	)
+}
+
+type signInTOTPRequest struct {
+	Challenge    string `json:"challenge"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recoveryCode"`
+}
+
+// SignInTOTP completes a sign in that `SignIn` answered with a challenge. The
+// challenge survives a few wrong codes so typos don't restart the sign in.
+func (r *repository) SignInTOTP(
+	ctx context.Context,
+	arg signInTOTPRequest,
+	client clientInfo,
+) (signInResponse, error) {
+	var challenge totpChallenge
+
+	if err := r.consumeSingleUseToken(ctx, totpChallengeFmt, arg.Challenge, &challenge); err != nil {
+		return signInResponse{}, err
+	}
+
+	if err := r.verifyUserTOTP(ctx, challenge.UserID, arg.Code, arg.RecoveryCode); err != nil {
+		if !errors.Is(err, errInvalidTOTPCode) {
+			return signInResponse{}, err
+		}
+
+		challenge.Attempts++
+		if challenge.Attempts < maxTOTPAttempts {
+			byt, err := json.Marshal(challenge)
+			if err != nil {
+				return signInResponse{}, err
+			}
+
+			key := fmt.Sprintf(totpChallengeFmt, hashToken(arg.Challenge))
+			if err := r.redisClient.Set(ctx, key, string(byt), totpChallengeTTL).Err(); err != nil {
+				return signInResponse{}, err
+			}
+		}
+
+		return signInResponse{}, err
+	}
+
+	user, err := r.Get(ctx, challenge.UserID)
+	if err != nil {
+		return signInResponse{}, err
+	}
+
+	return r.issueSession(ctx, user, client)
+}
+
+func (r *repository) ListTOTPRequiredRoles(ctx context.Context) ([]Role, error) {
+	query := `SELECT role FROM totp_required_roles ORDER BY role`
+
+	rows, err := r.querier.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, pgx.RowTo[Role])
+}
+
+type totpRequiredRolesRequest struct {
+	Roles []Role `json:"roles"`
+}
+
+func (r *repository) SetTOTPRequiredRoles(ctx context.Context, roles []Role) error {
+	tx, err := r.querier.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `DELETE FROM totp_required_roles`); err != nil {
+		return err
+	}
+
+	query := `INSERT INTO totp_required_roles (role) VALUES ($1) ON CONFLICT DO NOTHING`
+
+	for _, role := range roles {
+		if _, err := tx.Exec(ctx, query, role); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
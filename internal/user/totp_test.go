@@ -0,0 +1,126 @@
+package user
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Base32 of the ASCII "12345678901234567890", the SHA1 seed of RFC 6238
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCode(t *testing.T) {
+	// RFC 6238 Appendix B gives 8 digit codes, the last 6 of which are ours
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{unix: 59, want: "287082"},
+		{unix: 1111111109, want: "081804"},
+		{unix: 1111111111, want: "050471"},
+		{unix: 1234567890, want: "005924"},
+		{unix: 2000000000, want: "279037"},
+		{unix: 20000000000, want: "353130"},
+	}
+
+	for _, tt := range tests {
+		t.Run(time.Unix(tt.unix, 0).UTC().Format(time.RFC3339), func(t *testing.T) {
+			got, err := totpCode(rfc6238Secret, tt.unix/totpPeriod)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got != tt.want {
+				t.Errorf("totpCode() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyTOTP(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := now.Unix() / totpPeriod
+
+	tests := []struct {
+		name     string
+		step     int64
+		wantStep int64
+		wantOK   bool
+	}{
+		{name: "current step", step: current, wantStep: current, wantOK: true},
+		{name: "one step behind", step: current - 1, wantStep: current - 1, wantOK: true},
+		{name: "one step ahead", step: current + 1, wantStep: current + 1, wantOK: true},
+		{name: "two steps behind", step: current - 2},
+		{name: "two steps ahead", step: current + 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, err := totpCode(rfc6238Secret, tt.step)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			step, ok := verifyTOTP(rfc6238Secret, code, now)
+			if ok != tt.wantOK || step != tt.wantStep {
+				t.Errorf("verifyTOTP() = (%d, %t), want (%d, %t)", step, ok, tt.wantStep, tt.wantOK)
+			}
+		})
+	}
+}
+
+// Needs a Redis to run the script against, the one from `REDIS_URL` is used and
+// its `totp_last_step` key for the test user is overwritten.
+func TestUseTOTPStep(t *testing.T) {
+	redisURL := os.Getenv("REDIS_URL")
+	if redisURL == "" {
+		t.Skip("REDIS_URL is not set")
+	}
+
+	opt, err := redis.ParseURL(redisURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := redis.NewClient(opt)
+	defer client.Close()
+
+	ctx := context.Background()
+	r := &repository{redisClient: client}
+
+	const userID = "totp-test-user"
+
+	key := fmt.Sprintf(totpLastStepFmt, userID)
+	if err := client.Del(ctx, key).Err(); err != nil {
+		t.Fatal(err)
+	}
+	defer client.Del(ctx, key)
+
+	current := time.Now().Unix() / totpPeriod
+
+	steps := []struct {
+		name       string
+		step       int64
+		wantUnused bool
+	}{
+		{name: "first use", step: current, wantUnused: true},
+		{name: "same step again", step: current, wantUnused: false},
+		{name: "earlier step in the window", step: current - 1, wantUnused: false},
+		{name: "next step", step: current + 1, wantUnused: true},
+	}
+
+	for _, tt := range steps {
+		isUnused, err := r.useTOTPStep(ctx, userID, tt.step)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if isUnused != tt.wantUnused {
+			t.Errorf("%s: useTOTPStep() = %t, want %t", tt.name, isUnused, tt.wantUnused)
+		}
+	}
+}
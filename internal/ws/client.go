@@ -5,26 +5,79 @@ import (
 	"encoding/json"
 	"fmt"
 	"log/slog"
+	"slices"
 	"strings"
 
 	"github.com/gorilla/websocket"
 )
 
 type client struct {
-	hub  *hub
-	conn *websocket.Conn
-	send chan Message
+	hub    *hub
+	conn   *websocket.Conn
+	send   chan Message
+	userID string // Empty for API keys, which aren't users
+
+	// Set when `userID` is an anonymous ID
+	isAnonymous bool
+
+	// Only staff and API keys are sent the broadcast report events
+	isFeedSubscriber bool
+
+	// Clients subscribed to an incident are only sent the messages about its
+	// reports, and the ones meant for them
+	incidentID string
 
 	handlers map[string]EventHandler
 }
 
-func NewClient(conn *websocket.Conn, hub *hub, handlers map[string]EventHandler) *client {
+func NewClient(
+	conn *websocket.Conn,
+	hub *hub,
+	handlers map[string]EventHandler,
+	userID string,
+	isAnonymous bool,
+	isFeedSubscriber bool,
+	incidentID string,
+) *client {
 	return &client{
-		conn:     conn,
-		hub:      hub,
-		handlers: handlers,
-		send:     make(chan Message),
+		conn:             conn,
+		hub:              hub,
+		handlers:         handlers,
+		send:             make(chan Message, sendBufferSize),
+		userID:           userID,
+		isAnonymous:      isAnonymous,
+		isFeedSubscriber: isFeedSubscriber,
+		incidentID:       incidentID,
+	}
+}
+
+// Messages queued for a client before new ones are dropped
+const sendBufferSize = 64
+
+// deliver never blocks, a client that can't keep up misses messages instead of
+// stalling everyone else's.
+func (c *client) deliver(msg Message) {
+	select {
+	case c.send <- msg:
+	default:
+		slog.Warn(fmt.Sprintf("dropped %s for slow client %s", msg.Event, c.userID))
+	}
+}
+
+func (c *client) isAddressedBy(direct DirectMessage) bool {
+	if c.userID == "" {
+		return false
+	}
+
+	if c.isAnonymous {
+		return slices.Contains(direct.AnonymousIDs, c.userID)
 	}
+
+	return slices.Contains(direct.UserIDs, c.userID)
+}
+
+func (c *client) isSubscribedTo(msg Message) bool {
+	return c.incidentID == "" || (msg.IncidentID != nil && *msg.IncidentID == c.incidentID)
 }
 
 func (c *client) readPump(ctx context.Context) {
@@ -61,6 +114,11 @@ func (c *client) readPump(ctx context.Context) {
 			continue
 		}
 
+		// Handlers that publish through `BroadcastChannel` have nothing left to send
+		if response.Event == "" {
+			continue
+		}
+
 		c.hub.Broadcast(response)
 	}
 }
@@ -5,6 +5,7 @@ import (
 	"log/slog"
 	"net/http"
 
+	"github.com/InternalPointerVariable/ResQLink-Backend/internal/user"
 	"github.com/gorilla/websocket"
 )
 
@@ -14,6 +15,9 @@ var upgrader = websocket.Upgrader{
 	WriteBufferSize: 1024,
 }
 
+// Policy action for receiving every broadcast report event
+const feedAction = "ws:feed"
+
 func upgrade(w http.ResponseWriter, r *http.Request) (*websocket.Conn, error) {
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
@@ -24,7 +28,9 @@ func upgrade(w http.ResponseWriter, r *http.Request) (*websocket.Conn, error) {
 }
 
 func (s *Server) HandleConnection(w http.ResponseWriter, r *http.Request) {
-	ctx := context.Background()
+	// Keep the values set by `AuthMiddleware`, but not the cancellation since the
+	// request context is done once the connection is hijacked.
+	ctx := context.WithoutCancel(r.Context())
 	conn, err := upgrade(w, r)
 	defer conn.Close()
 
@@ -33,9 +39,18 @@ func (s *Server) HandleConnection(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// TODO: Authenticate user
-
-	client := NewClient(conn, s.hub, s.handlers)
+	caller, _ := user.SessionFromContext(ctx)
+	incidentID := r.URL.Query().Get("incidentId")
+	isFeedSubscriber := user.Authorize(ctx, feedAction) == nil
+	client := NewClient(
+		conn,
+		s.hub,
+		s.handlers,
+		caller.User.UserID,
+		caller.IsAnonymous,
+		isFeedSubscriber,
+		incidentID,
+	)
 
 	s.hub.register <- client
 
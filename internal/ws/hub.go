@@ -56,15 +56,40 @@ func (h *hub) Start() {
 	}
 }
 
+// Broadcast sends `msg` to the feed, the clients allowed to follow every report.
 func (h *hub) Broadcast(msg Message) {
+	for _, client := range h.snapshot() {
+		if client.isFeedSubscriber && client.isSubscribedTo(msg) {
+			client.deliver(msg)
+		}
+	}
+}
+
+// sendTo only reaches the users connected to this hub, see `DirectChannel`.
+func (h *hub) sendTo(direct DirectMessage) {
+	for _, client := range h.snapshot() {
+		if client.isAddressedBy(direct) {
+			client.deliver(direct.Message)
+		}
+	}
+}
+
+// Clients are copied out so a slow one never holds the lock `Start` needs to
+// register and unregister others.
+func (h *hub) snapshot() []*client {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	clients := make([]*client, 0, len(h.clients))
 	for client := range h.clients {
-		client.send <- msg
+		clients = append(clients, client)
 	}
+
+	return clients
 }
 
 func (h *hub) listenToPubSub(ctx context.Context) {
-	// TODO: The event type for the WebSocket and channels for PubSub should be different types
-	sub := h.redisClient.Subscribe(ctx, "disaster:create_report")
+	sub := h.redisClient.Subscribe(ctx, BroadcastChannel, DirectChannel)
 	defer sub.Close()
 
 	if _, err := sub.Receive(ctx); err != nil {
@@ -75,12 +100,25 @@ func (h *hub) listenToPubSub(ctx context.Context) {
 	ch := sub.Channel()
 
 	for msg := range ch {
-		fmt.Println(msg.String())
-		foo := Message{
-			Event: msg.Channel,
-			Data:  json.RawMessage(msg.Payload),
+		if msg.Channel == BroadcastChannel {
+			var broadcast Message
+			if err := json.Unmarshal([]byte(msg.Payload), &broadcast); err != nil {
+				slog.Error(fmt.Errorf("broadcast message: %w", err).Error())
+				continue
+			}
+
+			h.Broadcast(broadcast)
+			continue
 		}
 
-		h.Broadcast(foo)
+		if msg.Channel == DirectChannel {
+			var direct DirectMessage
+			if err := json.Unmarshal([]byte(msg.Payload), &direct); err != nil {
+				slog.Error(fmt.Errorf("direct message: %w", err).Error())
+				continue
+			}
+
+			h.sendTo(direct)
+		}
 	}
 }
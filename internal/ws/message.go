@@ -5,6 +5,9 @@ import "encoding/json"
 type Message struct {
 	Event string          `json:"event"`
 	Data  json.RawMessage `json:"data"`
+
+	// Set on messages about an incident's reports, see `client.incidentID`
+	IncidentID *string `json:"incidentId,omitempty"`
 }
 
 // Returns a new Message with the given data on the same Event
@@ -21,3 +24,19 @@ func (m *Message) Response(data any) (Message, error) {
 
 	return msg, nil
 }
+
+// Redis PubSub channel for messages sent to everyone, as `Message`s. Unlike a
+// handler's response, they reach the users connected to every hub.
+const BroadcastChannel = "ws:broadcast"
+
+// Redis PubSub channel for messages meant for some users only. Every hub
+// receives them and passes them on to the users connected to it.
+const DirectChannel = "ws:direct"
+
+// Users and anonymous citizens are addressed apart, so an anonymous ID never
+// reaches a user's connections or the other way around.
+type DirectMessage struct {
+	UserIDs      []string `json:"userIds"`
+	AnonymousIDs []string `json:"anonymousIds"`
+	Message      Message  `json:"message"`
+}
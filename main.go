@@ -6,9 +6,15 @@ import (
 	"log/slog"
 	"net/http"
 	"os"
+	"strconv"
 
 	"github.com/InternalPointerVariable/ResQLink-Backend/internal/api"
 	"github.com/InternalPointerVariable/ResQLink-Backend/internal/disaster"
+	"github.com/InternalPointerVariable/ResQLink-Backend/internal/household"
+	"github.com/InternalPointerVariable/ResQLink-Backend/internal/mail"
+	"github.com/InternalPointerVariable/ResQLink-Backend/internal/situation"
+	"github.com/InternalPointerVariable/ResQLink-Backend/internal/sms"
+	"github.com/InternalPointerVariable/ResQLink-Backend/internal/storage"
 	"github.com/InternalPointerVariable/ResQLink-Backend/internal/user"
 	"github.com/InternalPointerVariable/ResQLink-Backend/internal/ws"
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -18,9 +24,10 @@ import (
 )
 
 type app struct {
-	user     user.Server
-	disaster disaster.Server
-	ws       ws.Server
+	user      user.Server
+	disaster  disaster.Server
+	household household.Server
+	ws        ws.Server
 }
 
 func main() {
@@ -61,40 +68,273 @@ func main() {
 	hub := ws.NewHub(redisClient)
 	go hub.Start()
 
-	disasterRepo := disaster.NewRepository(pool, redisClient)
+	photoStorage := newStorage()
+
+	disasterRepo := disaster.NewRepository(pool, redisClient, photoStorage, loadPriorityWeights())
+
+	summaryWorker := disaster.NewSummaryWorker(disasterRepo, redisClient, newSummarizer())
+	go summaryWorker.Start(ctx)
+
 	disasterWsServer := disaster.NewSocketServer(disasterRepo)
 	wsHandlers := map[string]ws.EventHandler{"disaster": disasterWsServer}
 
+	appURL, ok := os.LookupEnv("APP_URL")
+	if !ok {
+		panic("APP_URL not found.")
+	}
+
+	medicalCipher, err := user.NewCipher(os.Getenv("MEDICAL_PROFILE_KEY"))
+	if err != nil {
+		panic(fmt.Errorf("medical profile key: %w", err))
+	}
+
+	totpCipher, err := user.NewCipher(os.Getenv("TOTP_SECRET_KEY"))
+	if err != nil {
+		panic(fmt.Errorf("totp secret key: %w", err))
+	}
+
+	userServer := user.NewServer(
+		user.NewRepository(pool, redisClient, medicalCipher, totpCipher),
+		disasterRepo,
+		newMailer(),
+		newSMSSender(),
+		appURL,
+		loadOIDCConfig(),
+	)
+
+	householdServer := household.NewServer(household.NewRepository(pool, redisClient))
+
 	app := app{
-		user:     *user.NewServer(user.NewRepository(pool, redisClient)),
-		disaster: *disaster.NewServer(disasterRepo, baseURL),
-		ws:       *ws.NewServer(hub, wsHandlers),
+		user: *userServer,
+		disaster: *disaster.NewServer(
+			disasterRepo,
+			userServer,
+			userServer,
+			householdServer,
+			photoStorage,
+			baseURL,
+		),
+		household: *householdServer,
+		ws:        *ws.NewServer(hub, wsHandlers),
 	}
 
 	router := http.NewServeMux()
 
-	router.HandleFunc("GET /ws", app.ws.HandleConnection)
-	router.HandleFunc("GET /", health)
+	wsRouter := http.NewServeMux()
+	wsRouter.HandleFunc("GET /ws", app.ws.HandleConnection)
+	router.Handle("GET /ws", app.user.AuthMiddleware(app.user.PolicyMiddleware(wsRouter)))
+	router.HandleFunc("GET /{$}", health)
 
 	router.Handle("POST /api/sign-up", api.HTTPHandler(app.user.SignUp))
 	router.Handle("POST /api/sign-in", api.HTTPHandler(app.user.SignIn))
 	router.Handle("POST /api/sign-in/anonymous", api.HTTPHandler(app.user.SignInAnonymous))
-	router.Handle("POST /api/sign-out", api.HTTPHandler(app.user.SignOut))
-	router.Handle("GET /api/session", api.HTTPHandler(app.user.GetSession))
-
+	router.Handle("POST /api/sign-in/totp", api.HTTPHandler(app.user.SignInTOTP))
+	router.Handle("POST /api/password/forgot", api.HTTPHandler(app.user.ForgotPassword))
+	router.Handle("POST /api/password/reset", api.HTTPHandler(app.user.ResetPassword))
+	router.Handle("POST /api/email/verify", api.HTTPHandler(app.user.VerifyEmail))
+	router.Handle("POST /api/otp/request", api.HTTPHandler(app.user.RequestOTP))
+	router.Handle("POST /api/otp/verify", api.HTTPHandler(app.user.VerifyOTP))
+	router.Handle("POST /api/emergency-status", api.HTTPHandler(app.user.GetEmergencyStatus))
+	router.Handle(
+		"POST /api/emergency-contacts/verify",
+		api.HTTPHandler(app.user.VerifyEmergencyContact),
+	)
+	router.Handle("GET /api/oidc/providers", api.HTTPHandler(app.user.ListOIDCProviders))
 	router.Handle(
+		"POST /api/oidc/{provider}/authorize",
+		api.HTTPHandler(app.user.AuthorizeOIDC),
+	)
+	router.Handle("POST /api/oidc/{provider}/callback", api.HTTPHandler(app.user.SignInOIDC))
+
+	// Every other `/api` route requires a session
+	authRouter := http.NewServeMux()
+	router.Handle("/api/", app.user.AuthMiddleware(app.user.PolicyMiddleware(authRouter)))
+
+	authRouter.Handle("POST /api/sign-out", api.HTTPHandler(app.user.SignOut))
+	authRouter.Handle("GET /api/session", api.HTTPHandler(app.user.GetSession))
+	authRouter.Handle("GET /api/sessions", api.HTTPHandler(app.user.ListSessions))
+	authRouter.Handle("DELETE /api/sessions", api.HTTPHandler(app.user.RevokeAllSessions))
+	authRouter.Handle("GET /api/sessions/{sessionId}", api.HTTPHandler(app.user.GetUserSession))
+	authRouter.Handle("DELETE /api/sessions/{sessionId}", api.HTTPHandler(app.user.RevokeSession))
+
+	authRouter.Handle(
+		"POST /api/email/verification",
+		api.HTTPHandler(app.user.ResendEmailVerification),
+	)
+	authRouter.Handle("POST /api/totp/enroll", api.HTTPHandler(app.user.StartTOTPEnrollment))
+	authRouter.Handle("POST /api/totp/confirm", api.HTTPHandler(app.user.ConfirmTOTPEnrollment))
+	authRouter.Handle("DELETE /api/totp", api.HTTPHandler(app.user.DisableTOTP))
+	authRouter.Handle(
+		"GET /api/totp/required-roles",
+		api.HTTPHandler(app.user.ListTOTPRequiredRoles),
+	)
+	authRouter.Handle(
+		"PUT /api/totp/required-roles",
+		api.HTTPHandler(app.user.SetTOTPRequiredRoles),
+	)
+
+	authRouter.Handle("GET /api/users/me", api.HTTPHandler(app.user.GetProfile))
+	authRouter.Handle("PATCH /api/users/me", api.HTTPHandler(app.user.UpdateProfile))
+	authRouter.Handle("DELETE /api/users/me", api.HTTPHandler(app.user.DeleteAccount))
+	authRouter.Handle("POST /api/users/me/password", api.HTTPHandler(app.user.ChangePassword))
+	authRouter.Handle("POST /api/oidc/{provider}/link", api.HTTPHandler(app.user.LinkOIDC))
+	authRouter.Handle("GET /api/users/me/export", api.HTTPHandler(app.user.ExportPersonalData))
+	authRouter.Handle(
+		"POST /api/users/me/claim-anonymous",
+		api.HTTPHandler(app.user.ClaimAnonymous),
+	)
+
+	authRouter.Handle(
+		"GET /api/users/me/emergency-contacts",
+		api.HTTPHandler(app.user.ListEmergencyContacts),
+	)
+	authRouter.Handle(
+		"POST /api/users/me/emergency-contacts",
+		api.HTTPHandler(app.user.CreateEmergencyContact),
+	)
+	authRouter.Handle(
+		"PUT /api/users/me/emergency-contacts/{contactId}",
+		api.HTTPHandler(app.user.UpdateEmergencyContact),
+	)
+	authRouter.Handle(
+		"DELETE /api/users/me/emergency-contacts/{contactId}",
+		api.HTTPHandler(app.user.DeleteEmergencyContact),
+	)
+
+	authRouter.Handle("GET /api/users/me/medical-profile", api.HTTPHandler(app.user.GetMedicalProfile))
+	authRouter.Handle("PUT /api/users/me/medical-profile", api.HTTPHandler(app.user.SaveMedicalProfile))
+	authRouter.Handle(
+		"DELETE /api/users/me/medical-profile",
+		api.HTTPHandler(app.user.DeleteMedicalProfile),
+	)
+	authRouter.Handle(
+		"GET /api/users/me/medical-profile/accesses",
+		api.HTTPHandler(app.user.ListMedicalProfileAccesses),
+	)
+
+	authRouter.Handle("PATCH /api/users/{userId}/role", api.HTTPHandler(app.user.SetRole))
+	authRouter.Handle("DELETE /api/users/{userId}/lockout", api.HTTPHandler(app.user.Unlock))
+
+	authRouter.Handle("GET /api/api-keys", api.HTTPHandler(app.user.ListAPIKeys))
+	authRouter.Handle("POST /api/api-keys", api.HTTPHandler(app.user.CreateAPIKey))
+	authRouter.Handle("POST /api/api-keys/{apiKeyId}/rotate", api.HTTPHandler(app.user.RotateAPIKey))
+	authRouter.Handle("DELETE /api/api-keys/{apiKeyId}", api.HTTPHandler(app.user.RevokeAPIKey))
+	authRouter.Handle("GET /api/users/{userId}/sessions", api.HTTPHandler(app.user.ListSessions))
+	authRouter.Handle(
+		"DELETE /api/users/{userId}/sessions",
+		api.HTTPHandler(app.user.RevokeAllSessions),
+	)
+	authRouter.Handle(
+		"DELETE /api/users/{userId}/sessions/{sessionId}",
+		api.HTTPHandler(app.user.RevokeSession),
+	)
+
+	authRouter.Handle("GET /api/households", api.HTTPHandler(app.household.ListHouseholds))
+	authRouter.Handle("POST /api/households", api.HTTPHandler(app.household.CreateHousehold))
+	authRouter.Handle("POST /api/households/join", api.HTTPHandler(app.household.JoinHousehold))
+	authRouter.Handle(
+		"GET /api/households/{householdId}",
+		api.HTTPHandler(app.household.GetHousehold),
+	)
+	authRouter.Handle(
+		"POST /api/households/{householdId}/invite-code",
+		api.HTTPHandler(app.household.RotateInviteCode),
+	)
+	authRouter.Handle(
+		"DELETE /api/households/{householdId}/members/{userId}",
+		api.HTTPHandler(app.household.RemoveMember),
+	)
+
+	authRouter.Handle(
 		"GET /api/reporters/{reporterId}/reports",
 		api.HTTPHandler(app.disaster.ListDisasterReportsByReporter),
 	)
-	router.Handle(
+	authRouter.Handle(
 		"PATCH /api/reporters/{reporterId}/reports",
 		api.HTTPHandler(app.disaster.SetResponder),
 	)
-	router.Handle("GET /api/reports", api.HTTPHandler(app.disaster.ListDisasterReports))
-	router.Handle(
+	authRouter.Handle("GET /api/reports", api.HTTPHandler(app.disaster.ListDisasterReports))
+	authRouter.Handle(
+		"GET /api/reports/{reportId}",
+		api.HTTPHandler(app.disaster.GetDisasterReport),
+	)
+	authRouter.Handle(
+		"POST /api/reports/{reportId}/transitions",
+		api.HTTPHandler(app.disaster.TransitionReport),
+	)
+	authRouter.Handle(
+		"POST /api/reports/{reportId}/updates",
+		api.HTTPHandler(app.disaster.AddReportUpdate),
+	)
+	authRouter.Handle(
+		"GET /api/reports/{reportId}/messages",
+		api.HTTPHandler(app.disaster.ListMessages),
+	)
+	authRouter.Handle(
+		"POST /api/reports/{reportId}/messages",
+		api.HTTPHandler(app.disaster.SendMessage),
+	)
+	authRouter.Handle(
+		"POST /api/reports/{reportId}/messages/receipts",
+		api.HTTPHandler(app.disaster.MarkMessages),
+	)
+	authRouter.Handle(
 		"POST /api/reports",
 		api.HTTPHandler(app.disaster.CreateDisasterReportJson),
 	)
+	authRouter.Handle(
+		"POST /api/reports/multipart",
+		api.HTTPHandler(app.disaster.CreateDisasterReport),
+	)
+	authRouter.Handle("POST /api/photos", api.HTTPHandler(app.disaster.UploadPhoto))
+	authRouter.Handle("GET /api/photos/{photoId}", http.HandlerFunc(app.disaster.GetPhoto))
+
+	authRouter.Handle(
+		"PUT /api/reports/{reportId}/incident",
+		api.HTTPHandler(app.disaster.SetReportIncident),
+	)
+	authRouter.Handle(
+		"GET /api/reports/{reportId}/duplicates",
+		api.HTTPHandler(app.disaster.ListDuplicateCandidates),
+	)
+	authRouter.Handle(
+		"POST /api/reports/{reportId}/merge",
+		api.HTTPHandler(app.disaster.MergeReports),
+	)
+	authRouter.Handle(
+		"POST /api/reports/{reportId}/links",
+		api.HTTPHandler(app.disaster.LinkReports),
+	)
+	authRouter.Handle(
+		"DELETE /api/reports/{reportId}/links/{linkedReportId}",
+		api.HTTPHandler(app.disaster.UnlinkReports),
+	)
+	authRouter.Handle(
+		"GET /api/report-clusters",
+		api.HTTPHandler(app.disaster.ListReportClusters),
+	)
+
+	authRouter.Handle("GET /api/incidents", api.HTTPHandler(app.disaster.ListIncidents))
+	authRouter.Handle("POST /api/incidents", api.HTTPHandler(app.disaster.CreateIncident))
+	authRouter.Handle(
+		"GET /api/incidents/{incidentId}",
+		api.HTTPHandler(app.disaster.GetIncident),
+	)
+	authRouter.Handle(
+		"PATCH /api/incidents/{incidentId}",
+		api.HTTPHandler(app.disaster.UpdateIncident),
+	)
+	authRouter.Handle(
+		"DELETE /api/incidents/{incidentId}",
+		api.HTTPHandler(app.disaster.DeleteIncident),
+	)
+
+	authRouter.Handle("GET /api/hazard-zones", api.HTTPHandler(app.disaster.ListHazardZones))
+	authRouter.Handle("POST /api/hazard-zones", api.HTTPHandler(app.disaster.CreateHazardZone))
+	authRouter.Handle(
+		"DELETE /api/hazard-zones/{hazardZoneId}",
+		api.HTTPHandler(app.disaster.DeleteHazardZone),
+	)
 
 	host, ok := os.LookupEnv("HOST")
 	if !ok {
@@ -108,12 +348,13 @@ func main() {
 
 	c := cors.New(cors.Options{
 		AllowedOrigins: []string{"*"},
-		AllowedMethods: []string{"GET", "POST", "PATCH", "OPTIONS"},
+		AllowedMethods: []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowedHeaders: []string{"Authorization", "Content-Type"},
 	})
 
 	server := http.Server{
 		Addr:    host + ":" + port,
-		Handler: c.Handler(router), // TODO: Wrap authenticated routes with `AuthMiddleware`
+		Handler: c.Handler(router),
 	}
 
 	slog.Info(fmt.Sprintf("Starting server on port: %s", port))
@@ -121,6 +362,116 @@ func main() {
 	server.ListenAndServe()
 }
 
+// SMTP is used when configured, otherwise mail is written to `MAIL_DIR`. Mail is
+// only logged in development, since it carries sign in links and codes.
+func newMailer() mail.Mailer {
+	if host := os.Getenv("SMTP_HOST"); host != "" {
+		return mail.NewSMTPMailer(
+			host,
+			os.Getenv("SMTP_PORT"),
+			os.Getenv("SMTP_USERNAME"),
+			os.Getenv("SMTP_PASSWORD"),
+			os.Getenv("MAIL_FROM"),
+		)
+	}
+
+	if dir := os.Getenv("MAIL_DIR"); dir != "" {
+		return mail.NewFileMailer(dir, os.Getenv("MAIL_FROM"))
+	}
+
+	if os.Getenv("ENVIRONMENT") != "development" {
+		panic("SMTP_HOST or MAIL_DIR not found.")
+	}
+
+	return mail.LogMailer{}
+}
+
+// Text messages are written to `SMS_DIR` or just logged until the telco gateway
+// is plugged in.
+func newSMSSender() sms.Sender {
+	if dir := os.Getenv("SMS_DIR"); dir != "" {
+		return sms.NewFileSender(dir)
+	}
+
+	return sms.LogSender{}
+}
+
+// Photos are kept in an S3 compatible bucket when `S3_ENDPOINT` is set,
+// otherwise in `STORAGE_DIR` on this server.
+func newStorage() storage.Storage {
+	if endpoint := os.Getenv("S3_ENDPOINT"); endpoint != "" {
+		s3, err := storage.NewS3(
+			endpoint,
+			os.Getenv("S3_BUCKET"),
+			os.Getenv("S3_REGION"),
+			os.Getenv("S3_ACCESS_KEY"),
+			os.Getenv("S3_SECRET_KEY"),
+		)
+		if err != nil {
+			panic(fmt.Errorf("storage: %w", err))
+		}
+
+		return s3
+	}
+
+	dir := os.Getenv("STORAGE_DIR")
+	if dir == "" {
+		dir = "_temp/photos"
+	}
+
+	return storage.NewLocal(dir)
+}
+
+// Situations are summarized by a model only when `AI_API_KEY` is set, otherwise
+// by keywords for local development.
+func newSummarizer() disaster.SituationSummarizer {
+	apiKey := os.Getenv("AI_API_KEY")
+	if apiKey == "" {
+		return situation.Stub{}
+	}
+
+	withPhotos, _ := strconv.ParseBool(os.Getenv("AI_SUMMARIZE_PHOTOS"))
+
+	return situation.NewOpenAISummarizer(
+		os.Getenv("AI_API_URL"),
+		apiKey,
+		os.Getenv("AI_MODEL"),
+		withPhotos,
+	)
+}
+
+// Reports are prioritized with the default weights unless `PRIORITY_WEIGHTS`
+// points to a file changing some of them.
+func loadPriorityWeights() disaster.PriorityWeights {
+	path := os.Getenv("PRIORITY_WEIGHTS")
+	if path == "" {
+		return disaster.DefaultPriorityWeights()
+	}
+
+	weights, err := disaster.LoadPriorityWeights(path)
+	if err != nil {
+		panic(fmt.Errorf("priority weights: %w", err))
+	}
+
+	return weights
+}
+
+// Staff sign in with their agency's identity provider only when `OIDC_CONFIG`
+// points to the providers' file.
+func loadOIDCConfig() []user.OIDCConfig {
+	path := os.Getenv("OIDC_CONFIG")
+	if path == "" {
+		return nil
+	}
+
+	configs, err := user.LoadOIDCConfig(path)
+	if err != nil {
+		panic(fmt.Errorf("oidc config: %w", err))
+	}
+
+	return configs
+}
+
 func health(w http.ResponseWriter, r *http.Request) {
 	slog.Info("Hello, World!")
 }